@@ -1,62 +1,41 @@
 package main
 
 import (
-	//"encoding/json"
-	//"fmt"A
-	"log"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
 
-	//"strings"
+	"github.com/seebasoft/prompter/goback/auth"
+	"github.com/seebasoft/prompter/goback/config"
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/database"
+	"github.com/seebasoft/prompter/goback/gql"
+	"github.com/seebasoft/prompter/goback/logging"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/seebasoft/prompter/goback/problem"
+	"github.com/seebasoft/prompter/goback/registry"
+	"github.com/seebasoft/prompter/goback/stack"
+	"github.com/seebasoft/prompter/goback/telemetry"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/gin-gonic/gin"
 )
 
-// User represents a user object
-type User struct {
-	ID       int    `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-}
-
-// handleRoot serves the root endpoint
-func handleRoot(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"title": "Hello API Handler",
-		"body":  "API Response",
-	})
-}
-
-// handleText serves the text endpoint
-func handleText(c *gin.Context) {
-	c.Header("Content-Type", "text/html")
-	c.String(http.StatusOK, `
-        <!DOCTYPE html>
-        <html>
-        <head>
-        <title>Hello</title>
-        </head>
-        <body>
-        <h1>Hello, World!</h1>
-        </body>
-        </html>
-        `)
-}
+var ginEngine *gin.Engine
+var dbClient *mongo.Client
+var telemetryProviders *telemetry.Providers
 
-// handleGetUsers serves the users endpoint
-func handleGetUsers(c *gin.Context) {
-	users := []User{
-		{ID: 1, Username: "John Doe", Email: "john_doe@gmail.com"},
-		{ID: 2, Username: "Jane Smith", Email: "jane_smith@gmail.com"},
-	}
-	c.JSON(http.StatusOK, users)
-	// c.JSON(http.StatusOK, gin.H{
-	// 	"message": "Hello3,  World!",
-	// })
-}
+// cfg holds the loaded configuration.
+var cfg = config.Default()
 
 func convertHeader(header http.Header) map[string]string {
 	result := make(map[string]string)
@@ -66,21 +45,37 @@ func convertHeader(header http.Header) map[string]string {
 	return result
 }
 
+func toHeader(headers map[string]string) http.Header {
+	result := make(http.Header, len(headers))
+	for k, v := range headers {
+		result.Set(k, v)
+	}
+	return result
+}
+
 // lambdaHandler handles Lambda requests and routes them using Gin
 func lambdaHandler(req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	log.Println("Received request path:", req.RawPath)
-	log.Println("HTTP Method:", req.RequestContext.HTTP.Method)
-	log.Println("Request Headers:", req.Headers)
+	slog.Debug("received request", "path", req.RawPath, "method", req.RequestContext.HTTP.Method,
+		"headers", logging.Redact(toHeader(req.Headers)))
 
 	w := httptest.NewRecorder()
 	ctx, _ := gin.CreateTestContext(w)
-	httpReq, _ := http.NewRequest(req.RequestContext.HTTP.Method, req.RawPath, nil)
+	target := req.RawPath
+	if req.RawQueryString != "" {
+		target += "?" + req.RawQueryString
+	}
+	httpReq, _ := http.NewRequest(req.RequestContext.HTTP.Method, target, bytes.NewBufferString(req.Body))
+	httpReq.Header = toHeader(req.Headers)
+	if claims := auth.AuthorizerClaims(req.RequestContext.Authorizer); claims != nil {
+		httpReq = httpReq.WithContext(auth.WithClaims(httpReq.Context(), claims))
+	}
 	ctx.Request = httpReq
 	ginEngine.ServeHTTP(w, ctx.Request)
+	if err := telemetryProviders.ForceFlush(context.Background()); err != nil {
+		slog.Error("flushing telemetry", "error", err)
+	}
 
-	log.Println("Response Status Code:", w.Code)
-	log.Println("Response Headers:", w.Header())
-	log.Println("Response Body: ", w.Body.String())
+	slog.Debug("sent response", "status", w.Code, "headers", w.Header(), "body", logging.RedactJSON(w.Body.Bytes()))
 
 	return events.APIGatewayV2HTTPResponse{
 		StatusCode: w.Code,
@@ -89,26 +84,105 @@ func lambdaHandler(req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPR
 	}, nil
 }
 
-var ginEngine *gin.Engine
-
 func main() {
-	ginEngine = initGin()
+	loaded, printOnly, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		logging.Fatal("failed to load configuration", "error", err)
+	}
+	if printOnly {
+		if err := loaded.Print(os.Stdout); err != nil {
+			logging.Fatal("failed to print configuration", "error", err)
+		}
+		return
+	}
+	cfg = loaded
+	if err := initialize(); err != nil {
+		logging.Fatal("failed to start", "error", err)
+	}
 
 	// Determine if running in Lambda or locally
-	if os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
+	if cfg.Server.Lambda {
 		// Running in Lambda
 		lambda.Start(lambdaHandler)
 	} else {
 		// Running locally
-		//r := initGin()
-		ginEngine.Run(":8080")
+		ginEngine.Run(cfg.Server.Addr)
+	}
+}
+
+func initialize() error {
+	level, _ := cfg.Log.SlogLevel() // checked by config.Load
+	logging.Setup(level, cfg.JSONLogs())
+	if cfg.Mongo.URI == "" {
+		return errors.New("mongo.uri must be set (env MONGODB_URI or --mongo-uri)")
+	}
+	var err error
+	if telemetryProviders, err = telemetry.Setup(context.Background(), "goback-graphql"); err != nil {
+		return fmt.Errorf("setting up telemetry: %w", err)
+	}
+	if dbClient, err = database.MongoConnect(context.Background(), cfg.Mongo.URI.Reveal(), cfg.Mongo.ConnectAttempts, cfg.Mongo.ConnectTimeout); err != nil {
+		return err
+	}
+	resources, err := models.Resources()
+	if err != nil {
+		return fmt.Errorf("registering resources: %w", err)
+	}
+	server, err := newServer(resources)
+	if err != nil {
+		return err
+	}
+	ginEngine = initGin(server)
+	return nil
+}
+
+// newServer resolves GraphQL requests through the same store stack as the
+// REST API, so both record history, outbox events and audit fields alike.
+// The REST API ensures the indexes and relays the outbox.
+func newServer(resources *registry.Registry) (*gql.Server, error) {
+	stores := stack.New(dbClient, cfg)
+	options := gql.Options{
+		GraphiQL: !cfg.Server.Lambda,
+		Limits: gql.Limits{
+			MaxDepth:      cfg.GraphQL.MaxDepth,
+			MaxComplexity: cfg.GraphQL.MaxComplexity,
+			Timeout:       cfg.GraphQL.Timeout,
+		},
+	}
+	if !cfg.Server.Lambda {
+		// Lambda can't hold WebSockets open
+		options.Watcher = stores.Mongo
+	}
+	if cfg.GraphQL.PersistedQueries > 0 {
+		options.PersistedQueries = dal.NewLRUCache(cfg.GraphQL.PersistedQueries)
+	}
+	if cfg.GraphQL.Allowlist != "" {
+		allowlist, err := readAllowlist(cfg.GraphQL.Allowlist)
+		if err != nil {
+			return nil, err
+		}
+		options.Allowlist = allowlist
+	}
+	return gql.NewServer(stores.Store, resources, options)
+}
+
+func readAllowlist(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening allowlist: %w", err)
 	}
+	defer f.Close()
+	return gql.ReadAllowlist(f)
 }
 
-func initGin() *gin.Engine {
-	engine := gin.Default()
-	engine.GET("/graphql", handleRoot)
-	engine.GET("/graphql/text", handleText)
-	engine.GET("/graphql/users", handleGetUsers)
+func initGin(server *gql.Server) *gin.Engine {
+	engine := gin.New()
+	engine.Use(telemetry.Middleware(otel.GetTracerProvider(), otel.GetMeterProvider()))
+	engine.Use(logging.Middleware(slog.Default()), problem.Recovery())
+	engine.Use(auth.Middleware(auth.Options{Secret: []byte(cfg.Auth.JWTSecret.Reveal()), ActorClaim: cfg.Auth.ActorClaim}))
+	engine.GET("/graphql", server.Handler)
+	engine.POST("/graphql", server.Handler)
 	return engine
 }
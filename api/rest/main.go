@@ -2,17 +2,29 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
-	"strings"
 
-	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/auth"
+	"github.com/seebasoft/prompter/goback/config"
 	"github.com/seebasoft/prompter/goback/database"
+	"github.com/seebasoft/prompter/goback/logging"
 	"github.com/seebasoft/prompter/goback/models"
+	"github.com/seebasoft/prompter/goback/openapi"
+	"github.com/seebasoft/prompter/goback/problem"
+	"github.com/seebasoft/prompter/goback/registry"
+	"github.com/seebasoft/prompter/goback/rest"
+	"github.com/seebasoft/prompter/goback/stack"
+	"github.com/seebasoft/prompter/goback/telemetry"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -22,25 +34,73 @@ import (
 
 var ginEngine *gin.Engine
 var dbClient *mongo.Client
+var telemetryProviders *telemetry.Providers
+
+// cfg holds the loaded configuration; tests run with the defaults.
+var cfg = config.Default()
+
+// basePath prefixes the REST routes.
+const basePath = "/rest/v1"
+
+// apiInfo describes the API in its OpenAPI document.
+var apiInfo = openapi.Info{Title: "Prompter REST API", Version: "1"}
 
 func main() {
-	initialize()
+	if len(os.Args) > 1 && os.Args[1] == "openapi" {
+		if err := writeOpenAPI(os.Args[2:]); err != nil {
+			logging.Fatal("failed to write the OpenAPI document", "error", err)
+		}
+		return
+	}
+
+	loaded, printOnly, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		logging.Fatal("failed to load configuration", "error", err)
+	}
+	if printOnly {
+		if err := loaded.Print(os.Stdout); err != nil {
+			logging.Fatal("failed to print configuration", "error", err)
+		}
+		return
+	}
+	cfg = loaded
+	if err := initialize(); err != nil {
+		logging.Fatal("failed to start", "error", err)
+	}
 	run()
 }
 
-func initialize() {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	ginEngine = initGin()
-	dbClient = initDb()
+func initialize() error {
+	level, _ := cfg.Log.SlogLevel() // checked by config.Load
+	logging.Setup(level, cfg.JSONLogs())
+	if cfg.Mongo.URI == "" {
+		return errors.New("mongo.uri must be set (env MONGODB_URI or --mongo-uri)")
+	}
+	var err error
+	if telemetryProviders, err = initTelemetry(); err != nil {
+		return err
+	}
+	if dbClient, err = initDb(); err != nil {
+		return err
+	}
+	resources, err := models.Resources()
+	if err != nil {
+		return fmt.Errorf("registering resources: %w", err)
+	}
+	ginEngine = initGin(newServer(), resources)
+	return nil
 }
 
 func run() {
-	if os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
+	if cfg.Server.Lambda {
 		// Running in Lambda
 		lambda.Start(lambdaHandler)
 	} else {
 		// Running locally
-		ginEngine.Run(":8080")
+		ginEngine.Run(cfg.Server.Addr)
 	}
 }
 
@@ -56,9 +116,22 @@ func convertHeader(header http.Header) map[string]string {
 func lambdaHandler(req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
 	w := httptest.NewRecorder()
 	ctx, _ := gin.CreateTestContext(w)
-	httpReq, _ := http.NewRequest(req.RequestContext.HTTP.Method, req.RawPath, bytes.NewBufferString(req.Body))
+	target := req.RawPath
+	if req.RawQueryString != "" {
+		target += "?" + req.RawQueryString
+	}
+	httpReq, _ := http.NewRequest(req.RequestContext.HTTP.Method, target, bytes.NewBufferString(req.Body))
+	for k, v := range req.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	if claims := auth.AuthorizerClaims(req.RequestContext.Authorizer); claims != nil {
+		httpReq = httpReq.WithContext(auth.WithClaims(httpReq.Context(), claims))
+	}
 	ctx.Request = httpReq
 	ginEngine.ServeHTTP(w, ctx.Request)
+	if err := telemetryProviders.ForceFlush(context.Background()); err != nil {
+		slog.Error("flushing telemetry", "error", err)
+	}
 
 	return events.APIGatewayV2HTTPResponse{
 		StatusCode: w.Code,
@@ -67,58 +140,95 @@ func lambdaHandler(req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPR
 	}, nil
 }
 
-func getRoot(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"title": "Hello API Handler",
-		"body":  "Endpoints: users",
-	})
+// newServer builds the REST handlers on the shared store stack and starts
+// relaying its outbox.
+func newServer() *rest.Server {
+	stores := stack.New(dbClient, cfg)
+	stores.StartRelay(context.Background(), cfg)
+	return rest.NewServer(stores.Store, rest.Options{History: stores.History})
 }
 
-func setDefaultRoutes(engine *gin.RouterGroup, resourceName string, item dal.Item) {
-	engine.POST(resourceName, func(c *gin.Context) { Create(c, item) })
-	engine.GET(fmt.Sprintf("%s/:id", resourceName), func(c *gin.Context) { ReadByKey(c, item) })
-	engine.GET(resourceName, func(c *gin.Context) { ReadByFilter(c, item) })
-	engine.PUT(fmt.Sprintf("%s/:id", resourceName), func(c *gin.Context) { UpdateByKey(c, item) })
-	engine.DELETE(fmt.Sprintf("%s/:id", resourceName), func(c *gin.Context) { DeleteByKey(c, item) })
-}
-
-func initGin() *gin.Engine {
-	engine := gin.Default()
+func initGin(server *rest.Server, resources *registry.Registry) *gin.Engine {
+	engine := gin.New()
 
 	// CORS configuration
-	config := cors.DefaultConfig()
-
-	// Use environment variables for allowed origins (BEST PRACTICE)
-	allowedOrigins := os.Getenv("ALLOWED_ORIGINS")
-	if allowedOrigins == "" {
-		// Default for development (VERY IMPORTANT: DO NOT USE "*" IN PRODUCTION)
-		config.AllowOrigins = []string{"http://localhost:8000"} // Correct origin for your frontend
-		allowNullOrigin := os.Getenv("ALLOW_NULL_ORIGIN") == "true"
-		if allowNullOrigin {
-			config.AllowOrigins = append(config.AllowOrigins, "*") // Add "null" to allowed origins
-			log.Println("WARNING: Allowing requests from 'null' origin. ONLY FOR DEVELOPMENT/TESTING.")
-		}
-	} else {
-		config.AllowOrigins = strings.Split(allowedOrigins, ",")
+	corsConfig := cors.DefaultConfig()
+
+	// Allowed origins come from the configuration (VERY IMPORTANT: DO NOT USE "*" IN PRODUCTION)
+	corsConfig.AllowOrigins = cfg.CORS.AllowedOrigins
+	if cfg.CORS.AllowNullOrigin {
+		corsConfig.AllowOrigins = append(corsConfig.AllowOrigins, "*") // Add "null" to allowed origins
+		slog.Warn("Allowing requests from 'null' origin. ONLY FOR DEVELOPMENT/TESTING.")
 	}
 
-	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization"}
-	config.AllowCredentials = true // Only if you are using cookies or authorization headers
+	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", logging.RequestIDHeader}
+	corsConfig.AllowCredentials = true // Only if you are using cookies or authorization headers
+
+	engine.Use(cors.New(corsConfig))
+	engine.Use(telemetry.Middleware(otel.GetTracerProvider(), otel.GetMeterProvider()))
+	engine.Use(logging.Middleware(slog.Default()))
+	engine.Use(problem.Recovery())
+	engine.Use(auth.Middleware(auth.Options{Secret: []byte(cfg.Auth.JWTSecret.Reveal()), ActorClaim: cfg.Auth.ActorClaim}))
+
+	engine.HandleMethodNotAllowed = true
+	engine.NoRoute(problem.NoRoute)
+	engine.NoMethod(problem.NoMethod)
+
+	v1 := engine.Group(basePath)
+	engine.GET("/", rest.NewDiscovery("Hello API Handler", v1.BasePath(), resources).Handler)
+	apiDoc := openapi.Generate(resources, v1.BasePath(), apiInfo)
+	v1.GET("openapi.json", func(c *gin.Context) { c.JSON(http.StatusOK, apiDoc) })
+	server.SetRoutes(v1, resources)
+	if webhooks, ok := resources.Lookup("webhooks"); ok {
+		server.SetWebhookRoutes(v1, webhooks)
+	}
+	return engine
+}
 
-	engine.Use(cors.New(config))
+// writeOpenAPI handles "openapi [-o file]", writing the OpenAPI document to
+// a file or stdout without connecting to the database.
+func writeOpenAPI(args []string) error {
+	fs := flag.NewFlagSet("openapi", flag.ContinueOnError)
+	output := fs.String("o", "", "file to write; stdout by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	resources, err := models.Resources()
+	if err != nil {
+		return fmt.Errorf("registering resources: %w", err)
+	}
 
-	engine.GET("/", getRoot)
-	v1 := engine.Group("/rest/v1")
-	setDefaultRoutes(v1, "users", &models.User{})
-	return engine
+	data, err := json.MarshalIndent(openapi.Generate(resources, basePath, apiInfo), "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding OpenAPI document: %w", err)
+	}
+	data = append(data, '\n')
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(*output, data, 0o644)
 }
 
-func initDb() *mongo.Client {
-	var err error
-	client, err := database.MongoConnect()
+// initTelemetry installs the OpenTelemetry providers selected by the
+// OTEL_TRACES_EXPORTER and OTEL_METRICS_EXPORTER variables.
+func initTelemetry() (*telemetry.Providers, error) {
+	providers, err := telemetry.Setup(context.Background(), "goback-rest")
 	if err != nil {
-		log.Fatalf("failed to connect to MongoDB: %v", err)
+		return nil, fmt.Errorf("setting up telemetry: %w", err)
+	}
+	return providers, nil
+}
+
+func initDb() (*mongo.Client, error) {
+	ctx := context.Background()
+	client, err := database.MongoConnect(ctx, cfg.Mongo.URI.Reveal(), cfg.Mongo.ConnectAttempts, cfg.Mongo.ConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if err := stack.EnsureIndexes(ctx, client); err != nil {
+		return nil, err
 	}
-	return client
+	return client, nil
 }
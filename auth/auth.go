@@ -0,0 +1,103 @@
+// Package auth identifies who makes a request. The actor recorded in audit
+// fields and history only ever comes from verified credentials: the claims an
+// API Gateway authorizer passes to Lambda, or a bearer JWT signed with the
+// configured secret. Requests without credentials have no actor.
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gin-gonic/gin"
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/problem"
+)
+
+// DefaultActorClaim is the claim naming the actor unless configured otherwise.
+const DefaultActorClaim = "sub"
+
+// Claims are the verified claims of a request's credentials.
+type Claims map[string]interface{}
+
+type claimsKey struct{}
+
+// WithClaims returns a context carrying verified claims.
+func WithClaims(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFrom returns the claims stored in ctx, or nil if there are none.
+func ClaimsFrom(ctx context.Context) Claims {
+	claims, _ := ctx.Value(claimsKey{}).(Claims)
+	return claims
+}
+
+// AuthorizerClaims returns the claims of the authorizer that let an API
+// Gateway request through, or nil if the route has no authorizer.
+func AuthorizerClaims(authorizer *events.APIGatewayV2HTTPRequestContextAuthorizerDescription) Claims {
+	switch {
+	case authorizer == nil:
+		return nil
+	case authorizer.JWT != nil:
+		claims := make(Claims, len(authorizer.JWT.Claims))
+		for name, value := range authorizer.JWT.Claims {
+			claims[name] = value
+		}
+		return claims
+	case authorizer.Lambda != nil:
+		return Claims(authorizer.Lambda)
+	}
+	return nil
+}
+
+// Options configures the Middleware.
+type Options struct {
+	// Secret is the HS256 key of bearer tokens. Without one, bearer tokens
+	// are refused and only authorizer claims identify callers.
+	Secret []byte
+	// ActorClaim names the claim holding the actor; DefaultActorClaim if empty.
+	ActorClaim string
+}
+
+// Middleware verifies the request's credentials and puts the actor they name
+// into the request context, where the Store decorators pick it up. Claims
+// already in the context, put there by the Lambda handler, are trusted;
+// otherwise a bearer token must verify or the request is refused with 401.
+func Middleware(options Options) gin.HandlerFunc {
+	if options.ActorClaim == "" {
+		options.ActorClaim = DefaultActorClaim
+	}
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		claims := ClaimsFrom(ctx)
+		if token, ok := bearer(c.GetHeader("Authorization")); claims == nil && ok {
+			var err error
+			if claims, err = Verify(token, options.Secret, time.Now()); err != nil {
+				unauthorized(c, err.Error())
+				return
+			}
+			ctx = WithClaims(ctx, claims)
+		}
+		if actor, _ := claims[options.ActorClaim].(string); actor != "" {
+			ctx = dal.WithActor(ctx, actor)
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+func bearer(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+func unauthorized(c *gin.Context, detail string) {
+	c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+	problem.Write(c, problem.New(http.StatusUnauthorized, detail))
+}
@@ -0,0 +1,78 @@
+package auth_test
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gin-gonic/gin"
+	"github.com/seebasoft/prompter/goback/auth"
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Unix(1700000000, 0)
+	token, err := auth.Sign(auth.Claims{"sub": "alice", "exp": now.Add(time.Minute).Unix()}, secret)
+	require.NoError(t, err)
+
+	claims, err := auth.Verify(token, secret, now)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", claims["sub"])
+
+	_, err = auth.Verify(token, secret, now.Add(time.Hour))
+	assert.ErrorContains(t, err, "expired")
+	_, err = auth.Verify(token, []byte("other"), now)
+	assert.ErrorContains(t, err, "signature")
+	_, err = auth.Verify(token, nil, now)
+	assert.Error(t, err, "no secret, no tokens")
+
+	// unsigned tokens don't get around the signature
+	parts := strings.Split(token, ".")
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."
+	_, err = auth.Verify(none, secret, now)
+	assert.ErrorContains(t, err, "algorithm")
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	secret := []byte("secret")
+	engine := gin.New()
+	engine.Use(auth.Middleware(auth.Options{Secret: secret}))
+	engine.GET("/", func(c *gin.Context) { c.String(http.StatusOK, dal.ActorFrom(c.Request.Context())) })
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String(), "anonymous")
+
+	token, err := auth.Sign(auth.Claims{"sub": "alice"}, secret)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	assert.Equal(t, "alice", serve(req).Body.String())
+
+	req.Header.Set("Authorization", "Bearer "+token+"x")
+	w = serve(req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+
+	// claims of an API Gateway authorizer are trusted as they are
+	claims := auth.AuthorizerClaims(&events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+		JWT: &events.APIGatewayV2HTTPRequestContextAuthorizerJWTDescription{Claims: map[string]string{"sub": "bob"}},
+	})
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(auth.WithClaims(req.Context(), claims))
+	assert.Equal(t, "bob", serve(req).Body.String())
+}
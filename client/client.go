@@ -0,0 +1,295 @@
+// Package client calls the REST API from other Go services. A Client holds
+// the connection settings; a Resource[T] gives typed access to one resource
+// using the same Item types the server stores:
+//
+//	c := client.New("https://api.example.com/rest/v1", client.DefaultOptions())
+//	users := client.NewResource[*models.User](c, "users", nil)
+//	for user, err := range users.All(ctx, client.NewQuery().Where("username", client.StartsWith, "j")) {
+//		...
+//	}
+//
+// Error responses are returned as *problem.Problem.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/internal/backoff"
+	"github.com/seebasoft/prompter/goback/problem"
+	"github.com/seebasoft/prompter/goback/registry"
+)
+
+// MergePatchType is the media type of Patch request bodies.
+const MergePatchType = "application/merge-patch+json"
+
+// Options configures a Client.
+type Options struct {
+	HTTPClient  *http.Client
+	Token       string        // Bearer token identifying the caller; its subject is the actor
+	MaxAttempts int           // Attempts per request, including the first
+	BaseBackoff time.Duration // Delay before the first retry; doubles per retry
+	MaxBackoff  time.Duration // Also caps how long a Retry-After is honoured
+}
+
+// DefaultOptions retries a couple of times within a few seconds.
+func DefaultOptions() Options {
+	return Options{
+		HTTPClient:  &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 3,
+		BaseBackoff: 100 * time.Millisecond,
+		MaxBackoff:  5 * time.Second,
+	}
+}
+
+// Client sends requests to an API base URL such as
+// "https://api.example.com/rest/v1".
+type Client struct {
+	baseURL string
+	options Options
+}
+
+// New creates a Client for baseURL.
+func New(baseURL string, options Options) *Client {
+	if options.HTTPClient == nil {
+		options.HTTPClient = http.DefaultClient
+	}
+	if options.MaxAttempts < 1 {
+		options.MaxAttempts = 1
+	}
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), options: options}
+}
+
+// Resource is a typed handle on one resource. T is a pointer to an Item
+// struct, e.g. *models.User.
+type Resource[T dal.Item] struct {
+	client *Client
+	name   string
+	keys   registry.KeyCodec
+}
+
+// NewResource returns the resource served under name. keys formats item keys
+// in paths; nil means registry.ObjectIDKeys.
+func NewResource[T dal.Item](c *Client, name string, keys registry.KeyCodec) *Resource[T] {
+	if keys == nil {
+		keys = registry.ObjectIDKeys
+	}
+	return &Resource[T]{client: c, name: name, keys: keys}
+}
+
+// Create adds an item and returns it as stored.
+func (r *Resource[T]) Create(ctx context.Context, item T) (T, error) {
+	return r.send(ctx, http.MethodPost, r.name, nil, item, "")
+}
+
+// Get reads the item with key.
+func (r *Resource[T]) Get(ctx context.Context, key interface{}) (T, error) {
+	return r.send(ctx, http.MethodGet, r.itemPath(key), nil, nil, "")
+}
+
+// Update replaces the item with key.
+func (r *Resource[T]) Update(ctx context.Context, key interface{}, item T) (T, error) {
+	return r.send(ctx, http.MethodPut, r.itemPath(key), nil, item, "")
+}
+
+// Patch applies a JSON merge patch, given as a map or a struct with
+// omitempty fields, to the item with key and returns the result.
+func (r *Resource[T]) Patch(ctx context.Context, key interface{}, patch interface{}) (T, error) {
+	return r.send(ctx, http.MethodPatch, r.itemPath(key), nil, patch, MergePatchType)
+}
+
+// Delete deletes the item with key; soft deletable items can be restored.
+func (r *Resource[T]) Delete(ctx context.Context, key interface{}) error {
+	return r.client.do(ctx, http.MethodDelete, r.itemPath(key), nil, nil, "", nil)
+}
+
+// List reads one page of the items matching query; a nil query reads the
+// first page of everything.
+func (r *Resource[T]) List(ctx context.Context, query *Query) ([]T, error) {
+	var items []T
+	if err := r.client.do(ctx, http.MethodGet, r.name, query.Values(), nil, "", &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// All iterates over every item matching query, fetching page after page
+// starting at the query's page. Iteration stops after the first error.
+func (r *Resource[T]) All(ctx context.Context, query *Query) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		values := query.Values()
+		page, pageSize := query.page(), query.pageSize()
+		for {
+			values.Set("page", strconv.Itoa(page))
+			values.Set("pageSize", strconv.Itoa(pageSize))
+			var items []T
+			if err := r.client.do(ctx, http.MethodGet, r.name, values, nil, "", &items); err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+			if len(items) < pageSize {
+				return
+			}
+			page++
+		}
+	}
+}
+
+func (r *Resource[T]) itemPath(key interface{}) string {
+	return r.name + "/" + url.PathEscape(r.keys.Format(key))
+}
+
+// send makes a request answered with a single item.
+func (r *Resource[T]) send(ctx context.Context, method, path string, query url.Values, body interface{}, contentType string) (T, error) {
+	item := reflect.New(reflect.TypeFor[T]().Elem()).Interface().(T)
+	if err := r.client.do(ctx, method, path, query, body, contentType, item); err != nil {
+		var zero T
+		return zero, err
+	}
+	return item, nil
+}
+
+// do sends a request, retrying it while that's safe, and decodes a
+// successful response into out unless it's nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{}, contentType string, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("encoding request: %w", err)
+		}
+		if contentType == "" {
+			contentType = "application/json"
+		}
+	}
+	target := c.baseURL + "/" + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.attempt(ctx, method, target, payload, contentType)
+		if err == nil && resp.StatusCode < 300 {
+			defer resp.Body.Close()
+			if out == nil {
+				return nil
+			}
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				return fmt.Errorf("decoding response: %w", err)
+			}
+			return nil
+		}
+
+		var retryAfter time.Duration
+		retry := false
+		if err != nil {
+			retry = ctx.Err() == nil && idempotent(method)
+		} else {
+			err = readProblem(resp)
+			retry = retryable(method, resp.StatusCode)
+			retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		}
+		if !retry || attempt >= c.options.MaxAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(c.backoff(attempt, retryAfter)):
+		}
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, method, target string, payload []byte, contentType string) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("building request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json, "+problem.ContentType)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.options.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.options.Token)
+	}
+	return c.options.HTTPClient.Do(req)
+}
+
+// readProblem turns an error response into a *problem.Problem. Bodies that
+// aren't problem documents, e.g. from a proxy, become a problem of the
+// status code with the body as detail.
+func readProblem(resp *http.Response) error {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("reading %s response: %w", resp.Status, err)
+	}
+	p := &problem.Problem{}
+	if err := json.Unmarshal(body, p); err != nil || p.Status == 0 {
+		p = problem.New(resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	p.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	return p
+}
+
+func idempotent(method string) bool {
+	return method != http.MethodPost
+}
+
+// retryable reports whether a request failing with status is worth sending
+// again. 429 and 503 mean the server turned the request away, so even a
+// create can be retried; gateway errors leave it unknown whether it ran.
+func retryable(method string, status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent(method)
+	}
+	return false
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// backoff waits at least as long as the server asked, up to MaxBackoff.
+func (c *Client) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	delay := backoff.Delay(attempt, c.options.BaseBackoff, c.options.MaxBackoff)
+	return min(max(delay, retryAfter), c.options.MaxBackoff)
+}
+
+// IsNotFound reports whether err is a 404 problem.
+func IsNotFound(err error) bool {
+	var p *problem.Problem
+	return errors.As(err, &p) && p.Status == http.StatusNotFound
+}
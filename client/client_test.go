@@ -0,0 +1,179 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/seebasoft/prompter/goback/auth"
+	"github.com/seebasoft/prompter/goback/client"
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/database"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/seebasoft/prompter/goback/problem"
+	"github.com/seebasoft/prompter/goback/rest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAPI(t *testing.T) http.Handler {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	resources, err := models.Resources()
+	require.NoError(t, err)
+	engine := gin.New()
+	engine.Use(auth.Middleware(auth.Options{Secret: testSecret}))
+	rest.NewServer(dal.NewAuditingStore(database.NewMemoryStore()), rest.Options{}).SetRoutes(engine.Group("/rest/v1"), resources)
+	return engine
+}
+
+var testSecret = []byte("test-secret")
+
+func testOptions() client.Options {
+	options := client.DefaultOptions()
+	options.Token, _ = auth.Sign(auth.Claims{"sub": "alice"}, testSecret)
+	options.BaseBackoff = time.Millisecond
+	options.MaxBackoff = 5 * time.Millisecond
+	return options
+}
+
+func TestResource(t *testing.T) {
+	server := httptest.NewServer(newAPI(t))
+	defer server.Close()
+	ctx := context.Background()
+	users := client.NewResource[*models.User](client.New(server.URL+"/rest/v1", testOptions()), "users", nil)
+
+	birthdate := time.Date(1990, 5, 1, 0, 0, 0, 0, time.UTC)
+	created, err := users.Create(ctx, &models.User{Username: "jdoe", Email: "jdoe@example.com", Birthdate: birthdate})
+	require.NoError(t, err)
+	assert.False(t, created.ID.IsZero())
+	assert.Equal(t, "alice", created.CreatedBy, "the token names the actor")
+
+	got, err := users.Get(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "jdoe", got.Username)
+
+	got.Email = "john@example.com"
+	updated, err := users.Update(ctx, got.ID, got)
+	require.NoError(t, err)
+	assert.Equal(t, "john@example.com", updated.Email)
+
+	patched, err := users.Patch(ctx, got.ID, map[string]interface{}{"username": "johndoe"})
+	require.NoError(t, err)
+	assert.Equal(t, "johndoe", patched.Username)
+	assert.Equal(t, "john@example.com", patched.Email)
+
+	// errors come back as problems with their field paths
+	_, err = users.Create(ctx, &models.User{Username: "x", Email: "x@example.com"})
+	var p *problem.Problem
+	require.True(t, errors.As(err, &p), "got %v", err)
+	assert.Equal(t, http.StatusUnprocessableEntity, p.Status)
+	assert.Equal(t, "username", p.Errors[0].Field)
+
+	require.NoError(t, users.Delete(ctx, got.ID))
+	_, err = users.Get(ctx, got.ID)
+	assert.True(t, client.IsNotFound(err))
+}
+
+func TestListAndAll(t *testing.T) {
+	server := httptest.NewServer(newAPI(t))
+	defer server.Close()
+	ctx := context.Background()
+	users := client.NewResource[*models.User](client.New(server.URL+"/rest/v1", testOptions()), "users", nil)
+
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 7; i++ {
+		_, err := users.Create(ctx, &models.User{
+			Username:  fmt.Sprintf("user%d", i),
+			Email:     fmt.Sprintf("user%d@example.com", i),
+			Birthdate: start.AddDate(i, 0, 0),
+		})
+		require.NoError(t, err)
+	}
+
+	query := client.NewQuery().
+		Where("username", client.StartsWith, "USER").
+		Between("birthdate", start.AddDate(1, 0, 0), start.AddDate(5, 0, 0)).
+		OrderByDesc("birthdate").
+		PageSize(2)
+	assert.Equal(t, "birthdate_between=2001-01-01T00%3A00%3A00Z%2C2005-01-01T00%3A00%3A00Z&pageSize=2&sort=-birthdate&username_startswith=USER", query.Encode())
+
+	page, err := users.List(ctx, query)
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	assert.Equal(t, "user5", page[0].Username)
+
+	var names []string
+	for user, err := range users.All(ctx, query) {
+		require.NoError(t, err)
+		names = append(names, user.Username)
+	}
+	assert.Equal(t, []string{"user5", "user4", "user3", "user2", "user1"}, names)
+
+	// two conditions on one field
+	page, err = users.List(ctx, client.NewQuery().
+		Where("birthdate", client.Gte, start.AddDate(2, 0, 0)).
+		Where("birthdate", client.Lt, start.AddDate(4, 0, 0)).
+		Where("username", client.StartsWith, "user").
+		Where("username", client.EndsWith, "3").
+		OrderBy("birthdate"))
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, "user3", page[0].Username)
+
+	_, err = users.List(ctx, client.NewQuery().Where("birthdate", client.After, "yesterday"))
+	var p *problem.Problem
+	require.True(t, errors.As(err, &p))
+	assert.Equal(t, problem.TypeInvalidFilter, p.TypeName())
+}
+
+func TestRetries(t *testing.T) {
+	api := newAPI(t)
+	var calls, failures atomic.Int32
+	failures.Store(2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if failures.Add(-1) >= 0 {
+			w.Header().Set("Content-Type", problem.ContentType)
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"type": "/problems/unavailable", "title": "Service unavailable", "status": 503}`)
+			return
+		}
+		api.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	users := client.NewResource[*models.User](client.New(server.URL+"/rest/v1", testOptions()), "users", nil)
+	_, err := users.Create(ctx, &models.User{Username: "jdoe", Email: "jdoe@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), calls.Load())
+
+	// gateway errors aren't retried for creates, which may have gone through
+	calls.Store(0)
+	options := testOptions()
+	options.MaxAttempts = 2
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "upstream timed out", http.StatusGatewayTimeout)
+	}))
+	defer failing.Close()
+	users = client.NewResource[*models.User](client.New(failing.URL, options), "users", nil)
+	_, err = users.Create(ctx, &models.User{Username: "jdoe", Email: "jdoe@example.com"})
+	var p *problem.Problem
+	require.True(t, errors.As(err, &p))
+	assert.Equal(t, http.StatusGatewayTimeout, p.Status)
+	assert.Equal(t, "upstream timed out", p.Detail)
+	assert.Equal(t, int32(1), calls.Load())
+
+	_, err = users.List(ctx, nil)
+	assert.Error(t, err)
+	assert.Equal(t, int32(3), calls.Load())
+}
@@ -0,0 +1,154 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Operator compares a field with a value in a filter.
+type Operator string
+
+// Filter operators, as understood by the list endpoints.
+const (
+	Eq         Operator = "eq"
+	Ne         Operator = "ne"
+	Gt         Operator = "gt"
+	Gte        Operator = "gte"
+	Lt         Operator = "lt"
+	Lte        Operator = "lte"
+	After      Operator = "after"  // time fields only
+	Before     Operator = "before" // time fields only
+	Contains   Operator = "contains"
+	StartsWith Operator = "startswith"
+	EndsWith   Operator = "endswith"
+)
+
+// Query builds the filter, sort and paging parameters of a list request. The
+// zero value and nil both match everything.
+type Query struct {
+	values url.Values
+}
+
+// NewQuery starts an empty query.
+func NewQuery() *Query {
+	return &Query{values: url.Values{}}
+}
+
+// Where adds the condition "field op value", field being the JSON name.
+// Times are sent as RFC 3339, ObjectIDs as hex and everything else as
+// formatted by fmt. A field can have several conditions, but only one per
+// operator; the last one wins.
+func (q *Query) Where(field string, op Operator, value interface{}) *Query {
+	q.set(field+"_"+string(op), formatValue(value))
+	return q
+}
+
+// Between matches times from start to end, both included.
+func (q *Query) Between(field string, start, end time.Time) *Query {
+	q.set(field+"_between", formatValue(start)+","+formatValue(end))
+	return q
+}
+
+// OrderBy sorts ascending by field; later calls break ties.
+func (q *Query) OrderBy(field string) *Query {
+	q.add("sort", field)
+	return q
+}
+
+// OrderByDesc sorts descending by field; later calls break ties.
+func (q *Query) OrderByDesc(field string) *Query {
+	q.add("sort", "-"+field)
+	return q
+}
+
+// Page selects a page, counting from 1.
+func (q *Query) Page(page int) *Query {
+	q.set("page", strconv.Itoa(page))
+	return q
+}
+
+// PageSize sets the number of items per page.
+func (q *Query) PageSize(size int) *Query {
+	q.set("pageSize", strconv.Itoa(size))
+	return q
+}
+
+// IncludeDeleted also returns soft deleted items.
+func (q *Query) IncludeDeleted() *Query {
+	q.set("includeDeleted", "true")
+	return q
+}
+
+// SkipUndecodable leaves out stored items that don't match the resource
+// schema instead of failing the request.
+func (q *Query) SkipUndecodable() *Query {
+	q.set("onDecodeError", "skip")
+	return q
+}
+
+// Values returns a copy of the query parameters.
+func (q *Query) Values() url.Values {
+	values := url.Values{}
+	if q != nil {
+		for name, v := range q.values {
+			values[name] = append([]string(nil), v...)
+		}
+	}
+	return values
+}
+
+// Encode returns the query string, without "?".
+func (q *Query) Encode() string {
+	return q.Values().Encode()
+}
+
+func (q *Query) set(name, value string) {
+	if q.values == nil {
+		q.values = url.Values{}
+	}
+	q.values.Set(name, value)
+}
+
+func (q *Query) add(name, value string) {
+	if q.values == nil {
+		q.values = url.Values{}
+	}
+	q.values.Add(name, value)
+}
+
+func (q *Query) page() int {
+	if page, err := strconv.Atoi(q.Values().Get("page")); err == nil && page > 0 {
+		return page
+	}
+	return 1
+}
+
+func (q *Query) pageSize() int {
+	if size, err := strconv.Atoi(q.Values().Get("pageSize")); err == nil && size > 0 {
+		return size
+	}
+	return defaultPageSize
+}
+
+// defaultPageSize matches the server's; All always sends a page size anyway.
+const defaultPageSize = 10
+
+func formatValue(value interface{}) string {
+	switch value := value.(type) {
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	case primitive.ObjectID:
+		return value.Hex()
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(value), 'f', -1, 32)
+	case fmt.Stringer:
+		return value.String()
+	}
+	return fmt.Sprint(value)
+}
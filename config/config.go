@@ -0,0 +1,227 @@
+// Package config loads the service configuration from, in increasing order of
+// precedence: defaults, a YAML or TOML file, environment variables and
+// command line flags.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration shared by the REST and GraphQL entrypoints.
+// Each field names its file key, environment variable and flag.
+type Config struct {
+	Server   ServerConfig   `yaml:"server" toml:"server"`
+	Auth     AuthConfig     `yaml:"auth" toml:"auth"`
+	Mongo    MongoConfig    `yaml:"mongo" toml:"mongo"`
+	CORS     CORSConfig     `yaml:"cors" toml:"cors"`
+	Log      LogConfig      `yaml:"log" toml:"log"`
+	Cache    CacheConfig    `yaml:"cache" toml:"cache"`
+	Outbox   OutboxConfig   `yaml:"outbox" toml:"outbox"`
+	Webhooks WebhooksConfig `yaml:"webhooks" toml:"webhooks"`
+	GraphQL  GraphQLConfig  `yaml:"graphql" toml:"graphql"`
+}
+
+type ServerConfig struct {
+	Addr   string `yaml:"addr" toml:"addr" env:"ADDR" flag:"addr" usage:"address to listen on when not in Lambda"`
+	Lambda bool   `yaml:"lambda" toml:"lambda" env:"AWS_LAMBDA_FUNCTION_NAME" flag:"lambda" usage:"serve API Gateway events instead of HTTP"`
+}
+
+type AuthConfig struct {
+	JWTSecret  Secret `yaml:"jwtSecret" toml:"jwtSecret" env:"JWT_SECRET" flag:"jwt-secret" usage:"HS256 key of bearer tokens; without it only API Gateway authorizer claims identify callers"`
+	ActorClaim string `yaml:"actorClaim" toml:"actorClaim" env:"JWT_ACTOR_CLAIM" flag:"jwt-actor-claim" usage:"claim naming the actor written to audit fields and history"`
+}
+
+type MongoConfig struct {
+	URI             Secret        `yaml:"uri" toml:"uri" env:"MONGODB_URI" flag:"mongo-uri" usage:"MongoDB connection string"`
+	ConnectAttempts int           `yaml:"connectAttempts" toml:"connectAttempts" env:"MONGODB_CONNECT_ATTEMPTS" flag:"mongo-connect-attempts" usage:"connection attempts at startup"`
+	ConnectTimeout  time.Duration `yaml:"connectTimeout" toml:"connectTimeout" env:"MONGODB_CONNECT_TIMEOUT" flag:"mongo-connect-timeout" usage:"timeout of each connection attempt"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins  []string `yaml:"allowedOrigins" toml:"allowedOrigins" env:"ALLOWED_ORIGINS" flag:"allowed-origins" usage:"comma separated origins allowed by CORS"`
+	AllowNullOrigin bool     `yaml:"allowNullOrigin" toml:"allowNullOrigin" env:"ALLOW_NULL_ORIGIN" flag:"allow-null-origin" usage:"allow any origin; development only"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL" flag:"log-level" usage:"debug, info, warn or error"`
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT" flag:"log-format" usage:"json or text; json by default in Lambda"`
+}
+
+type CacheConfig struct {
+	Size        int           `yaml:"size" toml:"size" env:"CACHE_SIZE" flag:"cache-size" usage:"items kept in the read cache; 0 disables it"`
+	TTL         time.Duration `yaml:"ttl" toml:"ttl" env:"CACHE_TTL" flag:"cache-ttl" usage:"how long items stay cached"`
+	NegativeTTL time.Duration `yaml:"negativeTTL" toml:"negativeTTL" env:"CACHE_NEGATIVE_TTL" flag:"cache-negative-ttl" usage:"how long missing items stay cached"`
+}
+
+type OutboxConfig struct {
+	WebhookURL string `yaml:"webhookURL" toml:"webhookURL" env:"OUTBOX_WEBHOOK_URL" flag:"outbox-webhook-url" usage:"publish outbox events to this URL"`
+	File       string `yaml:"file" toml:"file" env:"OUTBOX_FILE" flag:"outbox-file" usage:"append outbox events to this file"`
+}
+
+type WebhooksConfig struct {
+	MaxAttempts int `yaml:"maxAttempts" toml:"maxAttempts" env:"WEBHOOK_MAX_ATTEMPTS" flag:"webhook-max-attempts" usage:"delivery attempts per webhook and event before it is dead-lettered"`
+}
+
+type GraphQLConfig struct {
+	MaxDepth         int           `yaml:"maxDepth" toml:"maxDepth" env:"GRAPHQL_MAX_DEPTH" flag:"graphql-max-depth" usage:"deepest field nesting allowed; 0 for no limit"`
+	MaxComplexity    int           `yaml:"maxComplexity" toml:"maxComplexity" env:"GRAPHQL_MAX_COMPLEXITY" flag:"graphql-max-complexity" usage:"most fields a request may resolve, lists counted per item; 0 for no limit"`
+	Timeout          time.Duration `yaml:"timeout" toml:"timeout" env:"GRAPHQL_TIMEOUT" flag:"graphql-timeout" usage:"how long queries and mutations may run; 0 for no limit"`
+	PersistedQueries int           `yaml:"persistedQueries" toml:"persistedQueries" env:"GRAPHQL_PERSISTED_QUERIES" flag:"graphql-persisted-queries" usage:"automatic persisted queries kept in memory; 0 disables them"`
+	Allowlist        string        `yaml:"allowlist" toml:"allowlist" env:"GRAPHQL_ALLOWLIST" flag:"graphql-allowlist" usage:"JSON file of the only queries allowed, keyed by SHA-256 hash"`
+}
+
+// Default returns the configuration used when nothing overrides it.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{Addr: ":8080"},
+		Auth:   AuthConfig{ActorClaim: "sub"},
+		Mongo:  MongoConfig{ConnectAttempts: 3, ConnectTimeout: 5 * time.Second},
+		CORS:   CORSConfig{AllowedOrigins: []string{"http://localhost:8000"}},
+		Log:    LogConfig{Level: "info"},
+		Cache:  CacheConfig{Size: 1000, TTL: time.Minute, NegativeTTL: 10 * time.Second},
+		Webhooks: WebhooksConfig{
+			MaxAttempts: 5,
+		},
+		GraphQL: GraphQLConfig{
+			MaxDepth:         10,
+			MaxComplexity:    1000,
+			Timeout:          10 * time.Second,
+			PersistedQueries: 1000,
+		},
+	}
+}
+
+// Validate checks values that can't be checked by their type.
+func (c *Config) Validate() error {
+	var errs []error
+	if !c.Server.Lambda && c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr must be set"))
+	}
+	if c.Auth.ActorClaim == "" {
+		errs = append(errs, errors.New("auth.actorClaim must be set"))
+	}
+	if c.Mongo.ConnectAttempts < 1 {
+		errs = append(errs, errors.New("mongo.connectAttempts must be at least 1"))
+	}
+	if c.Mongo.ConnectTimeout <= 0 {
+		errs = append(errs, errors.New("mongo.connectTimeout must be positive"))
+	}
+	if _, err := c.Log.SlogLevel(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Log.Format != "" && c.Log.Format != "json" && c.Log.Format != "text" {
+		errs = append(errs, fmt.Errorf("log.format must be json or text, not %q", c.Log.Format))
+	}
+	if c.Cache.Size < 0 {
+		errs = append(errs, errors.New("cache.size can't be negative"))
+	}
+	if c.Webhooks.MaxAttempts < 1 {
+		errs = append(errs, errors.New("webhooks.maxAttempts must be at least 1"))
+	}
+	if c.GraphQL.MaxDepth < 0 || c.GraphQL.MaxComplexity < 0 || c.GraphQL.Timeout < 0 {
+		errs = append(errs, errors.New("graphql.maxDepth, graphql.maxComplexity and graphql.timeout can't be negative"))
+	}
+	if c.GraphQL.PersistedQueries < 0 {
+		errs = append(errs, errors.New("graphql.persistedQueries can't be negative"))
+	}
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" && !c.CORS.AllowNullOrigin {
+			errs = append(errs, errors.New("cors.allowedOrigins can't contain *; set allowNullOrigin for development"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SlogLevel parses the log level.
+func (c LogConfig) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+		return level, fmt.Errorf("log.level must be debug, info, warn or error, not %q", c.Level)
+	}
+	return level, nil
+}
+
+// JSONLogs reports whether logs should be written as JSON.
+func (c *Config) JSONLogs() bool {
+	if c.Log.Format == "" {
+		return c.Server.Lambda
+	}
+	return c.Log.Format == "json"
+}
+
+// Print writes the configuration as YAML, in the same layout the config file
+// uses, with secrets masked.
+func (c *Config) Print(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	sections := make(map[string]*yaml.Node)
+	for _, leaf := range fields(c) {
+		section, key, _ := strings.Cut(leaf.path, ".")
+		node, ok := sections[section]
+		if !ok {
+			node = &yaml.Node{Kind: yaml.MappingNode}
+			sections[section] = node
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: section}, node)
+		}
+		value := &yaml.Node{}
+		if err := value.Encode(printable(leaf.value.Interface())); err != nil {
+			return fmt.Errorf("printing %s: %w", leaf.path, err)
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return fmt.Errorf("printing config: %w", err)
+	}
+	return encoder.Close()
+}
+
+// printable formats values the way they are written in a config file.
+func printable(value interface{}) interface{} {
+	switch v := value.(type) {
+	case time.Duration:
+		return v.String()
+	case Secret:
+		return v.String()
+	}
+	return value
+}
+
+// Secret is a configuration value that must not be printed or logged. In a
+// file, the environment or a flag it can be given literally or as a
+// reference: "file:/run/secrets/mongo-uri" reads it from a file (trailing
+// newlines trimmed), "env:ATLAS_URI" from another environment variable.
+type Secret string
+
+const masked = "*****"
+
+// String masks the secret so it can't leak through fmt or slog.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return masked
+}
+
+// Reveal returns the secret value.
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// MarshalText masks the secret in JSON and other text encodings.
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// isReference reports whether a raw secret value points elsewhere.
+func isReference(value string) bool {
+	return strings.HasPrefix(value, "file:") || strings.HasPrefix(value, "env:")
+}
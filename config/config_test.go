@@ -0,0 +1,105 @@
+package config_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+server:
+  addr: ":9000"
+cache:
+  size: 10
+  ttl: 30s
+log:
+  level: warn
+cors:
+  allowedOrigins: [https://a.example, https://b.example]
+`)
+	cfg, printOnly, err := config.Load(
+		[]string{"--config", path, "--log-level", "debug"},
+		env(map[string]string{"CACHE_SIZE": "20", "LOG_LEVEL": "error", "AWS_LAMBDA_FUNCTION_NAME": "goback"}),
+	)
+	require.NoError(t, err)
+	assert.False(t, printOnly)
+
+	assert.Equal(t, ":9000", cfg.Server.Addr) // file over default
+	assert.Equal(t, 20, cfg.Cache.Size)       // env over file
+	assert.Equal(t, "debug", cfg.Log.Level)   // flag over env
+	assert.Equal(t, 30*time.Second, cfg.Cache.TTL)
+	assert.Equal(t, 10*time.Second, cfg.Cache.NegativeTTL) // default
+	assert.Equal(t, []string{"https://a.example", "https://b.example"}, cfg.CORS.AllowedOrigins)
+	assert.True(t, cfg.Server.Lambda)
+	assert.True(t, cfg.JSONLogs())
+}
+
+func TestLoadTOML(t *testing.T) {
+	path := writeFile(t, "config.toml", `
+[mongo]
+uri = "mongodb://localhost"
+connectAttempts = 5
+
+[webhooks]
+maxAttempts = 2
+`)
+	cfg, _, err := config.Load(nil, env(map[string]string{config.ConfigFileEnv: path}))
+	require.NoError(t, err)
+	assert.Equal(t, "mongodb://localhost", cfg.Mongo.URI.Reveal())
+	assert.Equal(t, 5, cfg.Mongo.ConnectAttempts)
+	assert.Equal(t, 2, cfg.Webhooks.MaxAttempts)
+}
+
+func TestLoadRejectsInvalidConfig(t *testing.T) {
+	path := writeFile(t, "config.yaml", "cache:\n  sise: 10\n")
+	_, _, err := config.Load([]string{"--config", path}, env(nil))
+	assert.ErrorContains(t, err, "unknown setting cache.sise")
+
+	_, _, err = config.Load(nil, env(map[string]string{"CACHE_TTL": "soon"}))
+	assert.ErrorContains(t, err, "CACHE_TTL")
+
+	_, _, err = config.Load([]string{"--webhook-max-attempts", "0", "--log-level", "loud"}, env(nil))
+	assert.ErrorContains(t, err, "webhooks.maxAttempts")
+	assert.ErrorContains(t, err, "log.level")
+}
+
+func TestSecrets(t *testing.T) {
+	secretFile := writeFile(t, "mongo-uri", "mongodb://from-file\n")
+	cfg, printOnly, err := config.Load([]string{"--print-config", "--mongo-uri", "file:" + secretFile}, env(nil))
+	require.NoError(t, err)
+	assert.True(t, printOnly)
+	assert.Equal(t, "mongodb://from-file", cfg.Mongo.URI.Reveal())
+
+	cfg, _, err = config.Load(nil, env(map[string]string{"MONGODB_URI": "env:ATLAS_URI", "ATLAS_URI": "mongodb://from-env"}))
+	require.NoError(t, err)
+	assert.Equal(t, "mongodb://from-env", cfg.Mongo.URI.Reveal())
+
+	var out bytes.Buffer
+	require.NoError(t, cfg.Print(&out))
+	assert.NotContains(t, out.String(), "from-env")
+	assert.Contains(t, out.String(), "uri: '*****'")
+	assert.Contains(t, out.String(), "ttl: 1m0s")
+
+	_, _, err = config.Load(nil, env(map[string]string{"MONGODB_URI": "env:MISSING"}))
+	assert.ErrorContains(t, err, "MISSING")
+}
@@ -0,0 +1,274 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv names the config file when --config isn't given.
+const ConfigFileEnv = "CONFIG_FILE"
+
+// field is a leaf configuration value with its sources.
+type field struct {
+	value reflect.Value
+	path  string // file key path, e.g. "mongo.uri"
+	env   string
+	flag  string
+	usage string
+}
+
+// fields lists the leaf values of cfg in declaration order.
+func fields(cfg *Config) []field {
+	var result []field
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			path := prefix + sf.Tag.Get("yaml")
+			if sf.Type.Kind() == reflect.Struct && sf.Type != reflect.TypeOf(time.Duration(0)) {
+				walk(v.Field(i), path+".")
+				continue
+			}
+			result = append(result, field{
+				value: v.Field(i),
+				path:  path,
+				env:   sf.Tag.Get("env"),
+				flag:  sf.Tag.Get("flag"),
+				usage: sf.Tag.Get("usage"),
+			})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "")
+	return result
+}
+
+// set parses raw into a leaf value.
+func (f field) set(raw string) error {
+	switch f.value.Interface().(type) {
+	case string, Secret:
+		f.value.SetString(raw)
+	case bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q isn't a boolean", f.path, raw)
+		}
+		f.value.SetBool(b)
+	case int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q isn't a number", f.path, raw)
+		}
+		f.value.SetInt(int64(n))
+	case time.Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q isn't a duration", f.path, raw)
+		}
+		f.value.SetInt(int64(d))
+	case []string:
+		var list []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		f.value.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("%s: unsupported type %s", f.path, f.value.Type())
+	}
+	return nil
+}
+
+// flagValue collects a flag's raw value; it is applied after the environment.
+type flagValue struct {
+	raw    *string
+	isBool bool
+}
+
+func (v flagValue) String() string {
+	if v.raw == nil {
+		return ""
+	}
+	return *v.raw
+}
+
+func (v flagValue) Set(raw string) error {
+	*v.raw = raw
+	return nil
+}
+
+func (v flagValue) IsBoolFlag() bool {
+	return v.isBool
+}
+
+// Load builds the configuration from args (without the program name) and the
+// environment. With --print-config it returns printOnly; the caller should
+// print the configuration and exit.
+func Load(args []string, lookupEnv func(string) (string, bool)) (cfg *Config, printOnly bool, err error) {
+	cfg = Default()
+	leaves := fields(cfg)
+
+	fs := flag.NewFlagSet("goback", flag.ContinueOnError)
+	configPath := fs.String("config", "", "YAML or TOML config file (env "+ConfigFileEnv+")")
+	printConfig := fs.Bool("print-config", false, "print the configuration, secrets masked, and exit")
+	flagValues := make(map[string]*string)
+	for _, leaf := range leaves {
+		raw := new(string)
+		flagValues[leaf.flag] = raw
+		usage := fmt.Sprintf("%s (env %s)", leaf.usage, leaf.env)
+		fs.Var(flagValue{raw: raw, isBool: leaf.value.Kind() == reflect.Bool}, leaf.flag, usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, false, err
+	}
+
+	path := *configPath
+	if path == "" {
+		path, _ = lookupEnv(ConfigFileEnv)
+	}
+	if path != "" {
+		if err := loadFile(cfg, path); err != nil {
+			return nil, false, err
+		}
+	}
+
+	for _, leaf := range leaves {
+		if raw, ok := lookupEnv(leaf.env); ok {
+			if leaf.value.Kind() == reflect.Bool && leaf.env == "AWS_LAMBDA_FUNCTION_NAME" {
+				raw = strconv.FormatBool(raw != "") // set to the function name in Lambda
+			}
+			if err := leaf.set(raw); err != nil {
+				return nil, false, fmt.Errorf("env %s: %w", leaf.env, err)
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		raw, ok := flagValues[f.Name]
+		if !ok || flagErr != nil {
+			return
+		}
+		for _, leaf := range leaves {
+			if leaf.flag == f.Name {
+				if err := leaf.set(*raw); err != nil {
+					flagErr = fmt.Errorf("flag --%s: %w", f.Name, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, false, flagErr
+	}
+
+	if err := resolveSecrets(leaves, lookupEnv); err != nil {
+		return nil, false, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, false, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, *printConfig, nil
+}
+
+// loadFile applies a YAML or TOML file. Its values use the same syntax as
+// environment variables and flags ("5s" for durations), and unknown settings
+// are rejected so typos don't go unnoticed.
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	doc := make(map[string]interface{})
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		return fmt.Errorf("config file %s must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := applyMap(cfg, doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func applyMap(cfg *Config, doc map[string]interface{}) error {
+	known := make(map[string]field)
+	for _, leaf := range fields(cfg) {
+		known[leaf.path] = leaf
+	}
+
+	var apply func(m map[string]interface{}, prefix string) error
+	apply = func(m map[string]interface{}, prefix string) error {
+		for key, value := range m {
+			path := prefix + key
+			if nested, ok := value.(map[string]interface{}); ok {
+				if err := apply(nested, path+"."); err != nil {
+					return err
+				}
+				continue
+			}
+			leaf, ok := known[path]
+			if !ok {
+				return fmt.Errorf("unknown setting %s", path)
+			}
+			if err := leaf.set(rawString(value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return apply(doc, "")
+}
+
+// rawString turns a decoded file value back into the string syntax field.set
+// parses; lists become comma separated.
+func rawString(value interface{}) string {
+	if list, ok := value.([]interface{}); ok {
+		items := make([]string, len(list))
+		for i, item := range list {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+func resolveSecrets(leaves []field, lookupEnv func(string) (string, bool)) error {
+	for _, leaf := range leaves {
+		secret, ok := leaf.value.Interface().(Secret)
+		if !ok || !isReference(string(secret)) {
+			continue
+		}
+		ref := string(secret)
+		var resolved string
+		if name, ok := strings.CutPrefix(ref, "env:"); ok {
+			if resolved, ok = lookupEnv(name); !ok {
+				return fmt.Errorf("%s: environment variable %s isn't set", leaf.path, name)
+			}
+		} else {
+			name := strings.TrimPrefix(ref, "file:")
+			data, err := os.ReadFile(name)
+			if err != nil {
+				return fmt.Errorf("%s: reading secret: %w", leaf.path, err)
+			}
+			resolved = strings.TrimRight(string(data), "\r\n")
+		}
+		leaf.value.SetString(resolved)
+	}
+	return nil
+}
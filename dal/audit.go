@@ -0,0 +1,79 @@
+package dal
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// AuditInfo records when and by whom an Item was created and last updated.
+type AuditInfo struct {
+	CreatedAt time.Time
+	CreatedBy string
+	UpdatedAt time.Time
+	UpdatedBy string
+}
+
+// Audited is implemented by Items whose audit fields are maintained by an
+// AuditingStore.
+type Audited interface {
+	GetAuditInfo() AuditInfo
+	SetAuditInfo(AuditInfo)
+}
+
+type actorKey struct{}
+
+// WithActor returns a context carrying the identity of whoever is making the
+// change.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor stored in ctx, or "" if there is none.
+func ActorFrom(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// AuditingStore is a Store decorator that stamps the audit fields of Audited
+// items. Whatever the caller put in those fields is overwritten, so they are
+// effectively read-only.
+type AuditingStore struct {
+	Store
+	now func() time.Time
+}
+
+// NewAuditingStore wraps store with audit stamping on Create and UpdateByKey.
+func NewAuditingStore(store Store) Store {
+	return &AuditingStore{Store: store, now: func() time.Time { return time.Now().UTC() }}
+}
+
+func (s *AuditingStore) Create(ctx context.Context, item Item) (Item, error) {
+	if audited, ok := item.(Audited); ok {
+		now, actor := s.now(), ActorFrom(ctx)
+		audited.SetAuditInfo(AuditInfo{CreatedAt: now, CreatedBy: actor, UpdatedAt: now, UpdatedBy: actor})
+	}
+	return s.Store.Create(ctx, item)
+}
+
+func (s *AuditingStore) UpdateByKey(ctx context.Context, key interface{}, item Item) (int64, error) {
+	audited, ok := item.(Audited)
+	if !ok {
+		return s.Store.UpdateByKey(ctx, key, item)
+	}
+
+	// Updates replace the whole item, so carry the creation stamps over from
+	// the stored version
+	existing := item.New()
+	if err := s.Store.ReadByKey(ctx, key, existing); err != nil {
+		return 0, fmt.Errorf("reading item before update: %w", err)
+	}
+	info := AuditInfo{UpdatedAt: s.now(), UpdatedBy: ActorFrom(ctx)}
+	if existingAudited, ok := existing.(Audited); ok {
+		info.CreatedAt = existingAudited.GetAuditInfo().CreatedAt
+		info.CreatedBy = existingAudited.GetAuditInfo().CreatedBy
+	}
+	audited.SetAuditInfo(info)
+
+	return s.Store.UpdateByKey(ctx, key, item)
+}
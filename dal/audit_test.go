@@ -0,0 +1,58 @@
+package dal_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// userStore keeps a single user; enough to exercise the decorators.
+type userStore struct {
+	dal.Store
+	stored *models.User
+}
+
+func (s *userStore) Create(ctx context.Context, item dal.Item) (dal.Item, error) {
+	copied := *item.(*models.User)
+	s.stored = &copied
+	return item, nil
+}
+
+func (s *userStore) ReadByKey(ctx context.Context, key interface{}, item dal.Item) error {
+	if s.stored == nil {
+		return dal.ErrNotFound
+	}
+	*item.(*models.User) = *s.stored
+	return nil
+}
+
+func (s *userStore) UpdateByKey(ctx context.Context, key interface{}, item dal.Item) (int64, error) {
+	copied := *item.(*models.User)
+	s.stored = &copied
+	return 1, nil
+}
+
+func TestAuditingStore(t *testing.T) {
+	inner := &userStore{}
+	store := dal.NewAuditingStore(inner)
+
+	ctx := dal.WithActor(context.Background(), "alice")
+	_, err := store.Create(ctx, &models.User{Username: "jdoe", CreatedBy: "mallory"})
+	require.NoError(t, err)
+	assert.Equal(t, "alice", inner.stored.CreatedBy)
+	assert.Equal(t, "alice", inner.stored.UpdatedBy)
+	assert.False(t, inner.stored.CreatedAt.IsZero())
+	created := inner.stored.CreatedAt
+
+	ctx = dal.WithActor(context.Background(), "bob")
+	_, err = store.UpdateByKey(ctx, inner.stored.ID, &models.User{Username: "jdoe2"})
+	require.NoError(t, err)
+	assert.Equal(t, "alice", inner.stored.CreatedBy)
+	assert.Equal(t, created, inner.stored.CreatedAt)
+	assert.Equal(t, "bob", inner.stored.UpdatedBy)
+	assert.False(t, inner.stored.UpdatedAt.Before(created))
+}
@@ -0,0 +1,362 @@
+package dal
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Cache is the storage behind a CachedStore. NewLRUCache provides an
+// in-process implementation; an external cache (Redis, Memcached, ...) can be
+// plugged in by implementing this interface. An empty, non-nil value marks a
+// cached "not found".
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(key string)
+}
+
+// LRUCache is a size-bounded in-memory Cache with per-entry TTLs.
+type LRUCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // front is most recently used
+	entries  map[string]*list.Element
+	now      func() time.Time
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRUCache creates a cache holding at most capacity entries.
+func NewLRUCache(capacity int) *LRUCache {
+	return &LRUCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+func (c *LRUCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if !entry.expires.IsZero() && c.now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (c *LRUCache) Set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var expires time.Time
+	if ttl > 0 {
+		expires = c.now().Add(ttl)
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = &lruEntry{key: key, value: value, expires: expires}
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (c *LRUCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// CacheOptions configures a CachedStore.
+type CacheOptions struct {
+	TTL         time.Duration // How long items stay cached
+	NegativeTTL time.Duration // How long "not found" stays cached; 0 disables negative caching
+	ReadTimeout time.Duration // Bounds a read shared by concurrent misses; 0 means DefaultCacheReadTimeout
+}
+
+// DefaultCacheReadTimeout bounds shared reads when CacheOptions has no
+// ReadTimeout.
+const DefaultCacheReadTimeout = 10 * time.Second
+
+// CacheStats counts how ReadByKey and ReadByKeys calls were served, per key.
+type CacheStats struct {
+	Hits          uint64 // served from the cache
+	NegativeHits  uint64 // answered "not found" from the cache
+	Misses        uint64 // read from the wrapped Store
+	Coalesced     uint64 // misses that shared a concurrent read of the same key
+	Invalidations uint64
+}
+
+// CachedStore is a Store decorator caching ReadByKey and ReadByKeys results.
+// Writes through it invalidate the affected key; writes that bypass it (other
+// processes, other Lambda instances) are only seen once the entry expires.
+// Concurrent ReadByKey misses for the same key share a single read of the
+// wrapped Store. That read isn't cancelled with the caller that started it,
+// so the others still get its result; each caller stops waiting when its own
+// context is done.
+type CachedStore struct {
+	Store
+	cache       Cache
+	options     CacheOptions
+	flight      singleflight.Group
+	generations [cacheStripes]generation
+
+	hits, negativeHits, misses, coalesced, invalidations atomic.Uint64
+}
+
+// cacheStripes is how many generations the keys are spread over.
+const cacheStripes = 256
+
+// generation counts the writes to the keys hashed to it. A read only caches
+// its result if the generation of its key didn't change meanwhile, so a read
+// that lost a race with a write can't cache the old version.
+type generation struct {
+	mu sync.Mutex
+	n  uint64
+}
+
+func (s *CachedStore) generation(ck string) *generation {
+	h := fnv.New32a()
+	h.Write([]byte(ck))
+	return &s.generations[h.Sum32()%cacheStripes]
+}
+
+// current returns the generation of ck, taken before reading it.
+func (s *CachedStore) current(ck string) uint64 {
+	g := s.generation(ck)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.n
+}
+
+// set caches value unless ck was written since generation n.
+func (s *CachedStore) set(ck string, n uint64, value []byte, ttl time.Duration) {
+	g := s.generation(ck)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.n == n {
+		s.cache.Set(ck, value, ttl)
+	}
+}
+
+// drop removes ck from the cache and keeps reads in flight from caching it.
+func (s *CachedStore) drop(ck string) {
+	g := s.generation(ck)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.n++
+	s.cache.Delete(ck)
+}
+
+// NewCachedStore wraps store with a read cache.
+func NewCachedStore(store Store, cache Cache, options CacheOptions) *CachedStore {
+	if options.ReadTimeout <= 0 {
+		options.ReadTimeout = DefaultCacheReadTimeout
+	}
+	return &CachedStore{Store: store, cache: cache, options: options}
+}
+
+// Stats returns the cache statistics so far.
+func (s *CachedStore) Stats() CacheStats {
+	return CacheStats{
+		Hits:          s.hits.Load(),
+		NegativeHits:  s.negativeHits.Load(),
+		Misses:        s.misses.Load(),
+		Coalesced:     s.coalesced.Load(),
+		Invalidations: s.invalidations.Load(),
+	}
+}
+
+func cacheKey(itemType Item, key interface{}) string {
+	return fmt.Sprintf("%s/%s/%v", itemType.Namespace(), itemType.ItemGroup(), key)
+}
+
+func (s *CachedStore) ReadByKey(ctx context.Context, key interface{}, item Item) error {
+	if IncludeDeleted(ctx) {
+		// Soft deleted items are never cached
+		return s.Store.ReadByKey(ctx, key, item)
+	}
+
+	ck := cacheKey(item, key)
+	if data, ok := s.cache.Get(ck); ok {
+		if len(data) == 0 {
+			s.negativeHits.Add(1)
+			return fmt.Errorf("getting entity by ID: %w", ErrNotFound)
+		}
+		s.hits.Add(1)
+		return item.Unmarshal(data)
+	}
+
+	s.misses.Add(1)
+	result := s.flight.DoChan(ck, func() (interface{}, error) {
+		// Values such as the actor and trace are kept, cancellation isn't
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.options.ReadTimeout)
+		defer cancel()
+		gen := s.current(ck)
+		fresh := item.New()
+		err := s.Store.ReadByKey(ctx, key, fresh)
+		if errors.Is(err, ErrNotFound) && s.options.NegativeTTL > 0 {
+			s.set(ck, gen, []byte{}, s.options.NegativeTTL)
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := fresh.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		s.set(ck, gen, data, s.options.TTL)
+		return data, nil
+	})
+
+	var res singleflight.Result
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("getting entity by ID: %w", ctx.Err())
+	case res = <-result:
+	}
+	if res.Shared {
+		s.coalesced.Add(1)
+	}
+	if res.Err != nil {
+		return res.Err
+	}
+	return item.Unmarshal(res.Val.([]byte))
+}
+
+// ReadByKeys serves the cached keys and reads the others from the wrapped
+// Store in one batch, caching what it finds and, with a NegativeTTL, what it
+// doesn't.
+func (s *CachedStore) ReadByKeys(ctx context.Context, keys []interface{}, itemType Item) ([]Item, error) {
+	if IncludeDeleted(ctx) {
+		return s.Store.ReadByKeys(ctx, keys, itemType)
+	}
+
+	items := make([]Item, len(keys))
+	var missing []interface{}
+	var positions []int
+	var gens []uint64
+	for i, key := range keys {
+		ck := cacheKey(itemType, key)
+		data, ok := s.cache.Get(ck)
+		switch {
+		case !ok:
+			s.misses.Add(1)
+			missing = append(missing, key)
+			positions = append(positions, i)
+			gens = append(gens, s.current(ck))
+		case len(data) == 0:
+			s.negativeHits.Add(1)
+		default:
+			s.hits.Add(1)
+			item := itemType.New()
+			if err := item.Unmarshal(data); err != nil {
+				return nil, fmt.Errorf("decoding cached entity: %w", err)
+			}
+			items[i] = item
+		}
+	}
+	if len(missing) == 0 {
+		return items, nil
+	}
+
+	read, err := s.Store.ReadByKeys(ctx, missing, itemType)
+	if err != nil {
+		return nil, err
+	}
+	for j, item := range read {
+		ck := cacheKey(itemType, missing[j])
+		if item == nil {
+			if s.options.NegativeTTL > 0 {
+				s.set(ck, gens[j], []byte{}, s.options.NegativeTTL)
+			}
+			continue
+		}
+		if data, err := item.Marshal(); err == nil {
+			s.set(ck, gens[j], data, s.options.TTL)
+		}
+		items[positions[j]] = item
+	}
+	return items, nil
+}
+
+// invalidate drops a key before and after a write. Reads that started before
+// the write finished don't cache what they read, and later misses don't join
+// them.
+func (s *CachedStore) invalidate(itemType Item, key interface{}, write func() error) error {
+	ck := cacheKey(itemType, key)
+	s.drop(ck)
+	err := write()
+	s.drop(ck)
+	s.flight.Forget(ck)
+	s.invalidations.Add(1)
+	return err
+}
+
+func (s *CachedStore) Create(ctx context.Context, item Item) (Item, error) {
+	created, err := s.Store.Create(ctx, item)
+	if err == nil {
+		// Drop a cached "not found" for the new key
+		s.drop(cacheKey(created, created.GetKey()))
+	}
+	return created, err
+}
+
+func (s *CachedStore) UpdateByKey(ctx context.Context, key interface{}, item Item) (count int64, err error) {
+	err = s.invalidate(item, key, func() error {
+		count, err = s.Store.UpdateByKey(ctx, key, item)
+		return err
+	})
+	return count, err
+}
+
+func (s *CachedStore) DeleteByKey(ctx context.Context, key interface{}, itemType Item) (count int64, err error) {
+	err = s.invalidate(itemType, key, func() error {
+		count, err = s.Store.DeleteByKey(ctx, key, itemType)
+		return err
+	})
+	return count, err
+}
+
+func (s *CachedStore) RestoreByKey(ctx context.Context, key interface{}, itemType Item) (count int64, err error) {
+	err = s.invalidate(itemType, key, func() error {
+		count, err = s.Store.RestoreByKey(ctx, key, itemType)
+		return err
+	})
+	return count, err
+}
+
+func (s *CachedStore) PurgeByKey(ctx context.Context, key interface{}, itemType Item) (count int64, err error) {
+	err = s.invalidate(itemType, key, func() error {
+		count, err = s.Store.PurgeByKey(ctx, key, itemType)
+		return err
+	})
+	return count, err
+}
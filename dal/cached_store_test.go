@@ -0,0 +1,139 @@
+package dal_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCachedStore(t *testing.T) {
+	ctx := context.Background()
+	inner := &userStore{}
+	store := dal.NewCachedStore(inner, dal.NewLRUCache(10), dal.CacheOptions{TTL: time.Minute, NegativeTTL: time.Minute})
+	id := primitive.NewObjectID()
+
+	// Not found is cached until the key is created
+	assert.True(t, errors.Is(store.ReadByKey(ctx, id, &models.User{}), dal.ErrNotFound))
+	assert.True(t, errors.Is(store.ReadByKey(ctx, id, &models.User{}), dal.ErrNotFound))
+	_, err := store.Create(ctx, &models.User{ID: id, Username: "jdoe"})
+	require.NoError(t, err)
+
+	read := &models.User{}
+	require.NoError(t, store.ReadByKey(ctx, id, read))
+	assert.Equal(t, "jdoe", read.Username)
+	inner.stored.Username = "changed behind the cache"
+	require.NoError(t, store.ReadByKey(ctx, id, read))
+	assert.Equal(t, "jdoe", read.Username)
+
+	// Updates through the store invalidate the entry
+	_, err = store.UpdateByKey(ctx, id, &models.User{ID: id, Username: "jdoe2"})
+	require.NoError(t, err)
+	require.NoError(t, store.ReadByKey(ctx, id, read))
+	assert.Equal(t, "jdoe2", read.Username)
+
+	stats := store.Stats()
+	assert.Equal(t, uint64(1), stats.NegativeHits)
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(3), stats.Misses)
+	assert.Equal(t, uint64(1), stats.Invalidations)
+}
+
+// slowStore holds reads until release is closed and fails those whose
+// context is done by then.
+type slowStore struct {
+	userStore
+	once    sync.Once
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *slowStore) ReadByKey(ctx context.Context, key interface{}, item dal.Item) error {
+	s.once.Do(func() { close(s.started) })
+	<-s.release
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.userStore.ReadByKey(ctx, key, item)
+}
+
+func TestCachedStoreSharedReadOutlivesFirstCaller(t *testing.T) {
+	inner := &slowStore{userStore: userStore{stored: &models.User{Username: "jdoe"}}, started: make(chan struct{}), release: make(chan struct{})}
+	store := dal.NewCachedStore(inner, dal.NewLRUCache(10), dal.CacheOptions{TTL: time.Minute})
+	id := primitive.NewObjectID()
+
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error)
+	go func() { firstErr <- store.ReadByKey(first, id, &models.User{}) }()
+	<-inner.started
+
+	second := make(chan error)
+	read := &models.User{}
+	go func() { second <- store.ReadByKey(context.Background(), id, read) }()
+	cancel()
+	assert.ErrorIs(t, <-firstErr, context.Canceled)
+
+	close(inner.release)
+	require.NoError(t, <-second)
+	assert.Equal(t, "jdoe", read.Username)
+}
+
+// staleStore reads an item, then holds on to it until release is closed, like
+// a read that loses a race with a write.
+type staleStore struct {
+	userStore
+	once    sync.Once
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *staleStore) ReadByKey(ctx context.Context, key interface{}, item dal.Item) error {
+	err := s.userStore.ReadByKey(ctx, key, item)
+	s.once.Do(func() { close(s.started) })
+	<-s.release
+	return err
+}
+
+func TestCachedStoreDoesNotCacheReadsOlderThanAWrite(t *testing.T) {
+	ctx := context.Background()
+	inner := &staleStore{userStore: userStore{stored: &models.User{Username: "old"}}, started: make(chan struct{}), release: make(chan struct{})}
+	store := dal.NewCachedStore(inner, dal.NewLRUCache(10), dal.CacheOptions{TTL: time.Minute})
+	id := primitive.NewObjectID()
+
+	stale := make(chan error)
+	go func() { stale <- store.ReadByKey(ctx, id, &models.User{}) }()
+	<-inner.started
+	_, err := store.UpdateByKey(ctx, id, &models.User{Username: "new"})
+	require.NoError(t, err)
+	close(inner.release)
+	require.NoError(t, <-stale)
+
+	read := &models.User{}
+	require.NoError(t, store.ReadByKey(ctx, id, read))
+	assert.Equal(t, "new", read.Username)
+}
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := dal.NewLRUCache(2)
+	cache.Set("a", []byte("1"), 0)
+	cache.Set("b", []byte("2"), 0)
+	cache.Get("a")
+	cache.Set("c", []byte("3"), 0)
+
+	_, ok := cache.Get("b")
+	assert.False(t, ok)
+	_, ok = cache.Get("a")
+	assert.True(t, ok)
+
+	cache.Set("d", []byte("4"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	_, ok = cache.Get("d")
+	assert.False(t, ok)
+}
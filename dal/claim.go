@@ -0,0 +1,13 @@
+package dal
+
+import "context"
+
+// Claimer is implemented by Stores that can update an item only while it
+// matches a filter, in one atomic step. Workers sharing a collection use it
+// to take items without two of them processing the same one.
+type Claimer interface {
+	// Claim sets fields on the first item matching the options' filter, in
+	// their sort order, and decodes the updated item into item. It returns
+	// ErrNotFound when no item matches.
+	Claim(ctx context.Context, options QueryOptions, fields map[string]interface{}, item Item) error
+}
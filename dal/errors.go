@@ -0,0 +1,55 @@
+package dal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned when no Item matches the given key.
+var ErrNotFound = errors.New("item not found")
+
+// ErrTransient marks failures that may go away on their own, such as network
+// errors and timeouts. A write failing with it may still have been applied,
+// so only reads are retried.
+var ErrTransient = errors.New("transient store error")
+
+// ErrRetryable marks failures known to have happened before anything was
+// written, e.g. no server being reachable or an aborted transaction. Retrying
+// is safe whatever the operation.
+var ErrRetryable = errors.New("retryable store error")
+
+// FilterError is returned when a query parameter can't be turned into a
+// filter: an unknown operator or a value of the wrong type.
+type FilterError struct {
+	Param  string // Query parameter, e.g. "birthdate_after"
+	Value  string
+	Reason string
+	Err    error
+}
+
+func (e *FilterError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("invalid filter %s=%q: %s: %v", e.Param, e.Value, e.Reason, e.Err)
+	}
+	return fmt.Sprintf("invalid filter %s=%q: %s", e.Param, e.Value, e.Reason)
+}
+
+func (e *FilterError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeError is returned by ItemIterator.Decode when a stored document
+// doesn't fit the Item type. The iterator stays usable, so callers can skip
+// the document and carry on.
+type DecodeError struct {
+	Key interface{} // Key of the document, if it could be read
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decoding item %v: %v", e.Key, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
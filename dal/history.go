@@ -0,0 +1,226 @@
+package dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Historied is implemented by Items whose changes are recorded by a
+// HistoryStore. Returning false turns history off without removing the method.
+type Historied interface {
+	TrackHistory() bool
+}
+
+// Operations recorded in an Item's history.
+const (
+	OpCreate  = "create"
+	OpUpdate  = "update"
+	OpDelete  = "delete"
+	OpRestore = "restore"
+	OpPurge   = "purge"
+	OpRevert  = "revert"
+)
+
+// Revision is one recorded change of an Item. Data holds the marshalled Item
+// as it was after the change; for deletes and purges it holds the last state
+// before the Item went away.
+type Revision struct {
+	Key    interface{}
+	Number int64
+	Op     string
+	Actor  string
+	At     time.Time
+	Data   []byte
+}
+
+// Removed reports whether the Item no longer existed after this revision.
+func (r *Revision) Removed() bool {
+	return r.Op == OpDelete || r.Op == OpPurge
+}
+
+// Decode unmarshals the revision's data into a new Item of itemType's type.
+func (r *Revision) Decode(itemType Item) (Item, error) {
+	item := itemType.New()
+	if err := item.Unmarshal(r.Data); err != nil {
+		return nil, fmt.Errorf("decoding revision %d: %w", r.Number, err)
+	}
+	return item, nil
+}
+
+// ErrRevisionNotFound is returned when a requested revision doesn't exist.
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// ErrRevertRemoved is returned when reverting to a revision in which the
+// Item had been deleted or purged.
+var ErrRevertRemoved = errors.New("cannot revert to a removed revision")
+
+// HistoryLog stores Item revisions. Implementations keep them next to the
+// Items, e.g. in a "<group>_history" collection.
+type HistoryLog interface {
+	// Append stores rev, assigning it the next revision number for its key.
+	Append(ctx context.Context, itemType Item, rev *Revision) error
+	// List returns all revisions of an Item, oldest first.
+	List(ctx context.Context, key interface{}, itemType Item) ([]Revision, error)
+	// Get returns a single revision.
+	Get(ctx context.Context, key interface{}, number int64, itemType Item) (*Revision, error)
+	// AsOf returns the latest revision recorded at or before at.
+	AsOf(ctx context.Context, key interface{}, at time.Time, itemType Item) (*Revision, error)
+}
+
+type historyOpKey struct{}
+
+// HistoryStore is a Store decorator recording every change of Historied items
+// in a HistoryLog. Each write and its revision run in one transaction, so a
+// write whose revision can't be recorded doesn't take effect either.
+type HistoryStore struct {
+	Store
+	history HistoryLog
+	tx      Transactor
+	now     func() time.Time
+}
+
+// NewHistoryStore wraps store so that changes are recorded in history. tx is
+// usually the backend at the bottom of the decorator stack, which history
+// must share.
+func NewHistoryStore(store Store, history HistoryLog, tx Transactor) Store {
+	return &HistoryStore{Store: store, history: history, tx: tx, now: func() time.Time { return time.Now().UTC() }}
+}
+
+func tracksHistory(item Item) bool {
+	historied, ok := item.(Historied)
+	return ok && historied.TrackHistory()
+}
+
+func (s *HistoryStore) record(ctx context.Context, op string, key interface{}, item Item) error {
+	data, err := item.Marshal()
+	if err != nil {
+		return fmt.Errorf("recording history: %w", err)
+	}
+	rev := &Revision{Key: key, Op: op, Actor: ActorFrom(ctx), At: s.now(), Data: data}
+	if err := s.history.Append(ctx, item, rev); err != nil {
+		return fmt.Errorf("recording history: %w", err)
+	}
+	return nil
+}
+
+func (s *HistoryStore) Create(ctx context.Context, item Item) (Item, error) {
+	if !tracksHistory(item) {
+		return s.Store.Create(ctx, item)
+	}
+	var created Item
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if created, err = s.Store.Create(ctx, item); err != nil {
+			return err
+		}
+		return s.record(ctx, OpCreate, created.GetKey(), created)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (s *HistoryStore) UpdateByKey(ctx context.Context, key interface{}, item Item) (int64, error) {
+	if !tracksHistory(item) {
+		return s.Store.UpdateByKey(ctx, key, item)
+	}
+	op, _ := ctx.Value(historyOpKey{}).(string)
+	if op == "" {
+		op = OpUpdate
+	}
+	var count int64
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if count, err = s.Store.UpdateByKey(ctx, key, item); err != nil {
+			return err
+		}
+		return s.record(ctx, op, key, item)
+	})
+	return count, err
+}
+
+func (s *HistoryStore) DeleteByKey(ctx context.Context, key interface{}, itemType Item) (int64, error) {
+	return s.remove(ctx, OpDelete, key, itemType, s.Store.DeleteByKey)
+}
+
+func (s *HistoryStore) PurgeByKey(ctx context.Context, key interface{}, itemType Item) (int64, error) {
+	return s.remove(ctx, OpPurge, key, itemType, s.Store.PurgeByKey)
+}
+
+// remove records the last state of an item that is deleted or purged.
+func (s *HistoryStore) remove(ctx context.Context, op string, key interface{}, itemType Item,
+	removeFn func(context.Context, interface{}, Item) (int64, error)) (int64, error) {
+	if !tracksHistory(itemType) {
+		return removeFn(ctx, key, itemType)
+	}
+
+	var count int64
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		previous := itemType.New()
+		if err := s.Store.ReadByKey(WithIncludeDeleted(ctx), key, previous); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		var err error
+		if count, err = removeFn(ctx, key, itemType); err != nil || count == 0 {
+			return err
+		}
+		return s.record(ctx, op, key, previous)
+	})
+	return count, err
+}
+
+func (s *HistoryStore) RestoreByKey(ctx context.Context, key interface{}, itemType Item) (int64, error) {
+	if !tracksHistory(itemType) {
+		return s.Store.RestoreByKey(ctx, key, itemType)
+	}
+	var count int64
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if count, err = s.Store.RestoreByKey(ctx, key, itemType); err != nil || count == 0 {
+			return err
+		}
+		restored := itemType.New()
+		if err := s.Store.ReadByKey(ctx, key, restored); err != nil {
+			return fmt.Errorf("recording history: %w", err)
+		}
+		return s.record(ctx, OpRestore, key, restored)
+	})
+	return count, err
+}
+
+// Revert replaces an Item with its state at the given revision. The revert is
+// written through store, so it is validated, audited and recorded as a new
+// "revert" revision like any other update.
+func Revert(ctx context.Context, store Store, history HistoryLog, key interface{}, number int64, itemType Item) (Item, error) {
+	rev, err := history.Get(ctx, key, number, itemType)
+	if err != nil {
+		return nil, err
+	}
+	if rev.Removed() {
+		return nil, fmt.Errorf("%w: revision %d is a %s", ErrRevertRemoved, number, rev.Op)
+	}
+
+	item, err := rev.Decode(itemType)
+	if err != nil {
+		return nil, err
+	}
+	if softDeletable, ok := item.(SoftDeletable); ok {
+		softDeletable.SetDeletedAt(nil)
+	}
+	if err := item.SetKey(key); err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, historyOpKey{}, OpRevert)
+	if _, err := store.UpdateByKey(ctx, key, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
@@ -0,0 +1,93 @@
+package dal_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/database"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type sliceHistory struct {
+	revisions []dal.Revision
+}
+
+func (h *sliceHistory) Append(ctx context.Context, itemType dal.Item, rev *dal.Revision) error {
+	rev.Number = int64(len(h.revisions) + 1)
+	h.revisions = append(h.revisions, *rev)
+	return nil
+}
+
+func (h *sliceHistory) List(ctx context.Context, key interface{}, itemType dal.Item) ([]dal.Revision, error) {
+	return h.revisions, nil
+}
+
+func (h *sliceHistory) Get(ctx context.Context, key interface{}, number int64, itemType dal.Item) (*dal.Revision, error) {
+	if number < 1 || number > int64(len(h.revisions)) {
+		return nil, dal.ErrRevisionNotFound
+	}
+	return &h.revisions[number-1], nil
+}
+
+func (h *sliceHistory) AsOf(ctx context.Context, key interface{}, at time.Time, itemType dal.Item) (*dal.Revision, error) {
+	return nil, dal.ErrRevisionNotFound
+}
+
+// failingHistory can't record anything.
+type failingHistory struct{ sliceHistory }
+
+func (h *failingHistory) Append(ctx context.Context, itemType dal.Item, rev *dal.Revision) error {
+	return errors.New("history unavailable")
+}
+
+// directTx runs transactions without isolation, for stores that have none.
+type directTx struct{}
+
+func (directTx) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func TestHistoryStoreRecordsAndReverts(t *testing.T) {
+	history := &sliceHistory{}
+	inner := &userStore{}
+	store := dal.NewHistoryStore(inner, history, directTx{})
+	ctx := dal.WithActor(context.Background(), "alice")
+
+	id := primitive.NewObjectID()
+	_, err := store.Create(ctx, &models.User{ID: id, Username: "first"})
+	require.NoError(t, err)
+	_, err = store.UpdateByKey(ctx, id, &models.User{ID: id, Username: "second"})
+	require.NoError(t, err)
+
+	require.Len(t, history.revisions, 2)
+	assert.Equal(t, dal.OpCreate, history.revisions[0].Op)
+	assert.Equal(t, dal.OpUpdate, history.revisions[1].Op)
+	assert.Equal(t, "alice", history.revisions[1].Actor)
+
+	reverted, err := dal.Revert(ctx, store, history, id, 1, &models.User{})
+	require.NoError(t, err)
+	assert.Equal(t, "first", reverted.(*models.User).Username)
+	assert.Equal(t, "first", inner.stored.Username)
+	require.Len(t, history.revisions, 3)
+	assert.Equal(t, dal.OpRevert, history.revisions[2].Op)
+}
+
+func TestHistoryStoreRollsBackUnrecordedWrites(t *testing.T) {
+	ctx := context.Background()
+	backend := database.NewMemoryStore()
+	store := dal.NewHistoryStore(backend, &failingHistory{}, backend)
+
+	id := primitive.NewObjectID()
+	_, err := store.Create(ctx, &models.User{ID: id, Username: "jdoe"})
+	require.Error(t, err)
+	assert.True(t, errors.Is(backend.ReadByKey(ctx, id, &models.User{}), dal.ErrNotFound))
+
+	_, err = dal.Revert(ctx, store, &sliceHistory{revisions: []dal.Revision{{Number: 1, Op: dal.OpDelete}}}, id, 1, &models.User{})
+	assert.True(t, errors.Is(err, dal.ErrRevertRemoved))
+}
@@ -0,0 +1,117 @@
+package dal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// IndexOrder is how a field participates in an index.
+type IndexOrder int
+
+const (
+	Ascending  IndexOrder = 1
+	Descending IndexOrder = -1
+	TextSearch IndexOrder = 0 // full-text index on a string field
+)
+
+// IndexField is one field of a (possibly compound) index.
+type IndexField struct {
+	Field string // stored (bson) field name
+	Order IndexOrder
+}
+
+// Asc, Desc and Text build IndexFields.
+func Asc(field string) IndexField  { return IndexField{Field: field, Order: Ascending} }
+func Desc(field string) IndexField { return IndexField{Field: field, Order: Descending} }
+func Text(field string) IndexField { return IndexField{Field: field, Order: TextSearch} }
+
+// Index describes an index an Item needs in its ItemGroup.
+type Index struct {
+	Name        string // optional; derived from the fields when empty
+	Fields      []IndexField
+	Unique      bool
+	Sparse      bool
+	ExpireAfter time.Duration // TTL; only valid on a single date field
+}
+
+// IndexName returns the index name, deriving one like "username_1" when no
+// explicit name was given.
+func (i Index) IndexName() string {
+	if i.Name != "" {
+		return i.Name
+	}
+	parts := make([]string, 0, len(i.Fields)*2)
+	for _, f := range i.Fields {
+		order := fmt.Sprint(int(f.Order))
+		if f.Order == TextSearch {
+			order = "text"
+		}
+		parts = append(parts, f.Field, order)
+	}
+	return strings.Join(parts, "_")
+}
+
+// FieldNames returns the names of the fields covered by the index.
+func (i Index) FieldNames() []string {
+	names := make([]string, 0, len(i.Fields))
+	for _, f := range i.Fields {
+		names = append(names, f.Field)
+	}
+	return names
+}
+
+// Indexed is implemented by Items that declare indexes and unique constraints.
+// Store.EnsureIndexes creates them.
+type Indexed interface {
+	Indexes() []Index
+}
+
+// RetiredIndexes is implemented by Indexed Items that replaced some of their
+// indexes. Store.EnsureIndexes drops the named indexes if they exist.
+type RetiredIndexes interface {
+	RetiredIndexes() []string
+}
+
+// ErrDuplicateKey is returned (wrapped in a *DuplicateKeyError) when a write
+// violates a unique index.
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// DuplicateKeyError reports which unique index, and which fields, a write
+// conflicted on.
+type DuplicateKeyError struct {
+	Index  string
+	Fields []string
+}
+
+func (e *DuplicateKeyError) Error() string {
+	if len(e.Fields) == 0 {
+		return fmt.Sprintf("duplicate key on index %s", e.Index)
+	}
+	return fmt.Sprintf("duplicate key for %s", strings.Join(e.Fields, ", "))
+}
+
+func (e *DuplicateKeyError) Is(target error) bool {
+	return target == ErrDuplicateKey
+}
+
+// NewDuplicateKeyError builds a DuplicateKeyError for the named index,
+// resolving its fields from the Item's declared indexes when possible.
+func NewDuplicateKeyError(item Item, indexName string) *DuplicateKeyError {
+	dupErr := &DuplicateKeyError{Index: indexName}
+	if indexed, ok := item.(Indexed); ok {
+		for _, idx := range indexed.Indexes() {
+			if idx.IndexName() == indexName {
+				// deletedAt only keeps deleted Items out of the way
+				for _, field := range idx.FieldNames() {
+					if field != DeletedAtField {
+						dupErr.Fields = append(dupErr.Fields, field)
+					}
+				}
+				break
+			}
+		}
+	}
+	return dupErr
+}
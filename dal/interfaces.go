@@ -64,7 +64,11 @@ type ItemIterator interface {
 type Store interface {
 	Create(ctx context.Context, item Item) (Item, error)
 	ReadByKey(ctx context.Context, key interface{}, item Item) error
+	ReadByKeys(ctx context.Context, keys []interface{}, itemType Item) ([]Item, error) // In the order of keys; nil where not found
 	ReadByFilter(ctx context.Context, options QueryOptions, itemType Item) (ItemIterator, error)
 	UpdateByKey(ctx context.Context, key interface{}, item Item) (int64, error)
-	DeleteByKey(ctx context.Context, key interface{}, itemType Item) (int64, error)
+	DeleteByKey(ctx context.Context, key interface{}, itemType Item) (int64, error) // Soft deletes SoftDeletable items
+	RestoreByKey(ctx context.Context, key interface{}, itemType Item) (int64, error)
+	PurgeByKey(ctx context.Context, key interface{}, itemType Item) (int64, error) // Always removes the item
+	EnsureIndexes(ctx context.Context, items ...Item) error // Creates indexes declared by Indexed items
 }
@@ -0,0 +1,137 @@
+package dal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// DefaultMaxBatch is the most keys a Loader reads with one ReadByKeys call
+// unless configured otherwise.
+const DefaultMaxBatch = 100
+
+// LoaderOptions configures a Loader.
+type LoaderOptions struct {
+	MaxBatch int // Keys per ReadByKeys call; DefaultMaxBatch if 0
+}
+
+// Loader coalesces ReadByKey lookups into ReadByKeys calls and caches their
+// results. Load queues a key and returns a thunk; calling any thunk reads all
+// keys queued for its item type so far with one query. Each key is read at
+// most once, so a Loader belongs to a single request: it doesn't see writes
+// made after a key was loaded. Loaded Items are shared between callers and
+// must not be modified.
+type Loader struct {
+	store    Store
+	maxBatch int
+
+	mu      sync.Mutex
+	pending map[string]*loaderBatch // by item type
+	results map[string]*loaderResult
+}
+
+// loaderBatch is a set of keys read together, with the context of the Load
+// that started it.
+type loaderBatch struct {
+	ctx      context.Context
+	itemType Item
+	keys     []interface{}
+	results  []*loaderResult
+	once     sync.Once
+}
+
+type loaderResult struct {
+	batch *loaderBatch
+	item  Item
+	err   error
+}
+
+// NewLoader creates a Loader reading from store.
+func NewLoader(store Store, options LoaderOptions) *Loader {
+	if options.MaxBatch < 1 {
+		options.MaxBatch = DefaultMaxBatch
+	}
+	return &Loader{
+		store:    store,
+		maxBatch: options.MaxBatch,
+		pending:  make(map[string]*loaderBatch),
+		results:  make(map[string]*loaderResult),
+	}
+}
+
+// Load queues key for reading and returns a function returning its Item, or
+// an error wrapping ErrNotFound if there is none.
+func (l *Loader) Load(ctx context.Context, key interface{}, itemType Item) func() (Item, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ck := cacheKey(itemType, key)
+	result, ok := l.results[ck]
+	if !ok {
+		group := itemType.Namespace() + "/" + itemType.ItemGroup()
+		batch := l.pending[group]
+		if batch == nil {
+			batch = &loaderBatch{ctx: ctx, itemType: itemType}
+			l.pending[group] = batch
+		}
+		result = &loaderResult{batch: batch}
+		batch.keys = append(batch.keys, key)
+		batch.results = append(batch.results, result)
+		if len(batch.keys) == l.maxBatch {
+			delete(l.pending, group)
+		}
+		l.results[ck] = result
+	}
+	return func() (Item, error) {
+		result.batch.once.Do(func() { l.read(result.batch) })
+		return result.item, result.err
+	}
+}
+
+// LoadMany loads keys in one go, returning their Items in the same order.
+func (l *Loader) LoadMany(ctx context.Context, keys []interface{}, itemType Item) ([]Item, []error) {
+	thunks := make([]func() (Item, error), len(keys))
+	for i, key := range keys {
+		thunks[i] = l.Load(ctx, key, itemType)
+	}
+	items := make([]Item, len(keys))
+	errs := make([]error, len(keys))
+	for i, thunk := range thunks {
+		items[i], errs[i] = thunk()
+	}
+	return items, errs
+}
+
+func (l *Loader) read(batch *loaderBatch) {
+	l.mu.Lock()
+	group := batch.itemType.Namespace() + "/" + batch.itemType.ItemGroup()
+	if l.pending[group] == batch {
+		delete(l.pending, group) // later keys start a new batch
+	}
+	l.mu.Unlock()
+
+	items, err := l.store.ReadByKeys(batch.ctx, batch.keys, batch.itemType)
+	for i, result := range batch.results {
+		switch {
+		case err != nil:
+			result.err = err
+		case items[i] == nil:
+			result.err = fmt.Errorf("getting entity by ID: %w", ErrNotFound)
+		default:
+			result.item = items[i]
+		}
+	}
+}
+
+type loaderKey struct{}
+
+// WithLoader returns a context carrying a request's Loader.
+func WithLoader(ctx context.Context, loader *Loader) context.Context {
+	return context.WithValue(ctx, loaderKey{}, loader)
+}
+
+// LoaderFrom returns the Loader of ctx, or nil if there is none.
+func LoaderFrom(ctx context.Context) *Loader {
+	loader, _ := ctx.Value(loaderKey{}).(*Loader)
+	return loader
+}
@@ -0,0 +1,70 @@
+package dal_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/database"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// batchCountingStore counts ReadByKeys calls.
+type batchCountingStore struct {
+	dal.Store
+	batches [][]interface{}
+}
+
+func (s *batchCountingStore) ReadByKeys(ctx context.Context, keys []interface{}, itemType dal.Item) ([]dal.Item, error) {
+	s.batches = append(s.batches, keys)
+	return s.Store.ReadByKeys(ctx, keys, itemType)
+}
+
+func TestLoader(t *testing.T) {
+	ctx := context.Background()
+	store := &batchCountingStore{Store: database.NewMemoryStore()}
+	var ids []interface{}
+	for _, name := range []string{"jane", "john", "mary"} {
+		created, err := store.Create(ctx, &models.User{Username: name})
+		require.NoError(t, err)
+		ids = append(ids, created.GetKey())
+	}
+	_, err := store.DeleteByKey(ctx, ids[2], &models.User{})
+	require.NoError(t, err)
+
+	loader := dal.NewLoader(store, dal.LoaderOptions{})
+	missing := primitive.NewObjectID()
+	thunks := []func() (dal.Item, error){
+		loader.Load(ctx, ids[1], &models.User{}),
+		loader.Load(ctx, missing, &models.User{}),
+		loader.Load(ctx, ids[0], &models.User{}),
+		loader.Load(ctx, ids[2], &models.User{}),
+		loader.Load(ctx, ids[1], &models.User{}),
+	}
+	var usernames []string
+	for _, thunk := range thunks {
+		item, err := thunk()
+		if errors.Is(err, dal.ErrNotFound) {
+			usernames = append(usernames, "")
+			continue
+		}
+		require.NoError(t, err)
+		usernames = append(usernames, item.(*models.User).Username)
+	}
+	// soft deleted items aren't found and duplicate keys are read once
+	assert.Equal(t, []string{"john", "", "jane", "", "john"}, usernames)
+	assert.Equal(t, [][]interface{}{{ids[1], missing, ids[0], ids[2]}}, store.batches)
+
+	// loaded keys are cached, new ones go in a new batch
+	items, errs := loader.LoadMany(ctx, []interface{}{ids[0], ids[2]}, &models.User{})
+	assert.Equal(t, "jane", items[0].(*models.User).Username)
+	assert.ErrorIs(t, errs[1], dal.ErrNotFound)
+	assert.Len(t, store.batches, 1)
+	small := dal.NewLoader(store, dal.LoaderOptions{MaxBatch: 2})
+	small.LoadMany(ctx, ids, &models.User{})
+	assert.Len(t, store.batches, 3)
+}
@@ -0,0 +1,235 @@
+package dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/internal/backoff"
+)
+
+// ErrUnavailable is returned (wrapped in an *UnavailableError) while the
+// circuit breaker of a ResilientStore is open.
+var ErrUnavailable = errors.New("store unavailable")
+
+// UnavailableError tells callers when the store is worth trying again.
+type UnavailableError struct {
+	RetryAfter time.Duration
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("store unavailable, retry after %s", e.RetryAfter)
+}
+
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrUnavailable
+}
+
+// ResilienceOptions configures a ResilientStore.
+type ResilienceOptions struct {
+	MaxAttempts      int           // Attempts per operation, including the first
+	BaseBackoff      time.Duration // Delay before the first retry; doubles per retry
+	MaxBackoff       time.Duration
+	Timeout          time.Duration // Per attempt; covers opening, not iterating, ReadByFilter cursors
+	FailureThreshold int           // Consecutive transient failures that open the breaker
+	OpenFor          time.Duration // How long the breaker stays open before a probe
+}
+
+// DefaultResilienceOptions suits a Lambda talking to Atlas: a few quick
+// retries, well within the API Gateway timeout.
+func DefaultResilienceOptions() ResilienceOptions {
+	return ResilienceOptions{
+		MaxAttempts:      3,
+		BaseBackoff:      50 * time.Millisecond,
+		MaxBackoff:       time.Second,
+		Timeout:          5 * time.Second,
+		FailureThreshold: 5,
+		OpenFor:          10 * time.Second,
+	}
+}
+
+// ResilientStore is a Store decorator retrying transient failures and failing
+// fast while the wrapped Store is down. Reads are retried on ErrTransient;
+// writes only on ErrRetryable, as a write that failed ambiguously may have
+// committed together with its history revision and outbox event, and a retry
+// would record them twice (or, for a delete, find nothing left and report
+// 0). Other errors (not found, validation, duplicate keys) pass through
+// untouched and don't count against the circuit breaker.
+type ResilientStore struct {
+	Store
+	options ResilienceOptions
+	breaker *circuitBreaker
+}
+
+// NewResilientStore wraps store with retries and a circuit breaker.
+func NewResilientStore(store Store, options ResilienceOptions) *ResilientStore {
+	if options.MaxAttempts < 1 {
+		options.MaxAttempts = 1
+	}
+	return &ResilientStore{
+		Store:   store,
+		options: options,
+		breaker: &circuitBreaker{threshold: options.FailureThreshold, openFor: options.OpenFor, now: time.Now},
+	}
+}
+
+func (s *ResilientStore) Create(ctx context.Context, item Item) (created Item, err error) {
+	err = s.do(ctx, false, func(ctx context.Context) error {
+		created, err = s.Store.Create(ctx, item)
+		return err
+	})
+	return created, err
+}
+
+func (s *ResilientStore) ReadByKey(ctx context.Context, key interface{}, item Item) error {
+	return s.do(ctx, true, func(ctx context.Context) error {
+		return s.Store.ReadByKey(ctx, key, item)
+	})
+}
+
+func (s *ResilientStore) ReadByKeys(ctx context.Context, keys []interface{}, itemType Item) (items []Item, err error) {
+	err = s.do(ctx, true, func(ctx context.Context) error {
+		items, err = s.Store.ReadByKeys(ctx, keys, itemType)
+		return err
+	})
+	return items, err
+}
+
+func (s *ResilientStore) ReadByFilter(ctx context.Context, opts QueryOptions, itemType Item) (iter ItemIterator, err error) {
+	err = s.do(ctx, true, func(ctx context.Context) error {
+		iter, err = s.Store.ReadByFilter(ctx, opts, itemType)
+		return err
+	})
+	return iter, err
+}
+
+func (s *ResilientStore) UpdateByKey(ctx context.Context, key interface{}, item Item) (count int64, err error) {
+	err = s.do(ctx, false, func(ctx context.Context) error {
+		count, err = s.Store.UpdateByKey(ctx, key, item)
+		return err
+	})
+	return count, err
+}
+
+func (s *ResilientStore) DeleteByKey(ctx context.Context, key interface{}, itemType Item) (count int64, err error) {
+	err = s.do(ctx, false, func(ctx context.Context) error {
+		count, err = s.Store.DeleteByKey(ctx, key, itemType)
+		return err
+	})
+	return count, err
+}
+
+func (s *ResilientStore) RestoreByKey(ctx context.Context, key interface{}, itemType Item) (count int64, err error) {
+	err = s.do(ctx, false, func(ctx context.Context) error {
+		count, err = s.Store.RestoreByKey(ctx, key, itemType)
+		return err
+	})
+	return count, err
+}
+
+func (s *ResilientStore) PurgeByKey(ctx context.Context, key interface{}, itemType Item) (count int64, err error) {
+	err = s.do(ctx, false, func(ctx context.Context) error {
+		count, err = s.Store.PurgeByKey(ctx, key, itemType)
+		return err
+	})
+	return count, err
+}
+
+func (s *ResilientStore) EnsureIndexes(ctx context.Context, items ...Item) error {
+	return s.do(ctx, true, func(ctx context.Context) error {
+		return s.Store.EnsureIndexes(ctx, items...)
+	})
+}
+
+// do runs op until it succeeds, fails for good or runs out of attempts. Only
+// reads should pass idempotent, letting ambiguous failures be retried.
+func (s *ResilientStore) do(ctx context.Context, idempotent bool, op func(ctx context.Context) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if retryAfter, ok := s.breaker.allow(); !ok {
+			return &UnavailableError{RetryAfter: retryAfter}
+		}
+
+		err = s.attempt(ctx, op)
+		transient := isTransient(ctx, err)
+		s.breaker.record(transient)
+
+		retry := errors.Is(err, ErrRetryable) || (idempotent && transient)
+		if !retry || attempt >= s.options.MaxAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff.Delay(attempt, s.options.BaseBackoff, s.options.MaxBackoff)):
+		}
+	}
+}
+
+func (s *ResilientStore) attempt(ctx context.Context, op func(ctx context.Context) error) error {
+	if s.options.Timeout <= 0 {
+		return op(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.options.Timeout)
+	defer cancel()
+	return op(ctx)
+}
+
+// isTransient reports whether err is worth retrying. A deadline hit by the
+// per-attempt timeout is transient; one set by the caller is not.
+func isTransient(ctx context.Context, err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrTransient) || errors.Is(err, ErrRetryable) {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil
+}
+
+// circuitBreaker opens after threshold consecutive failures. Once openFor has
+// passed it lets a single probe through: success closes it, failure opens it
+// again.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	openFor   time.Duration
+	now       func() time.Time
+
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func (b *circuitBreaker) allow() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return 0, true
+	}
+	if elapsed := b.now().Sub(b.openedAt); elapsed < b.openFor {
+		return b.openFor - elapsed, false
+	}
+	if b.probing {
+		return b.openFor, false
+	}
+	b.probing = true
+	return 0, true
+}
+
+func (b *circuitBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = b.now()
+	}
+}
@@ -0,0 +1,110 @@
+package dal_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyStore fails the first failures calls with err.
+type flakyStore struct {
+	dal.Store
+	failures int
+	err      error
+	calls    int
+}
+
+func (s *flakyStore) ReadByKey(ctx context.Context, key interface{}, item dal.Item) error {
+	s.calls++
+	if s.calls <= s.failures {
+		return s.err
+	}
+	return nil
+}
+
+func (s *flakyStore) DeleteByKey(ctx context.Context, key interface{}, itemType dal.Item) (int64, error) {
+	s.calls++
+	if s.calls <= s.failures {
+		return 0, s.err
+	}
+	return 1, nil
+}
+
+func (s *flakyStore) Create(ctx context.Context, item dal.Item) (dal.Item, error) {
+	s.calls++
+	if s.calls <= s.failures {
+		return nil, s.err
+	}
+	return item, nil
+}
+
+func fastOptions() dal.ResilienceOptions {
+	return dal.ResilienceOptions{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond, FailureThreshold: 2, OpenFor: time.Minute}
+}
+
+func TestResilientStoreRetriesTransientReads(t *testing.T) {
+	inner := &flakyStore{failures: 2, err: fmt.Errorf("reading: %w", dal.ErrTransient)}
+	options := fastOptions()
+	options.FailureThreshold = 5
+	store := dal.NewResilientStore(inner, options)
+
+	require.NoError(t, store.ReadByKey(context.Background(), 1, &models.User{}))
+	assert.Equal(t, 3, inner.calls)
+}
+
+func TestResilientStoreDoesNotRetryCreateOnTransientErrors(t *testing.T) {
+	inner := &flakyStore{failures: 1, err: dal.ErrTransient}
+	store := dal.NewResilientStore(inner, fastOptions())
+
+	_, err := store.Create(context.Background(), &models.User{})
+	assert.True(t, errors.Is(err, dal.ErrTransient))
+	assert.Equal(t, 1, inner.calls)
+
+	inner = &flakyStore{failures: 1, err: dal.ErrRetryable}
+	store = dal.NewResilientStore(inner, fastOptions())
+	_, err = store.Create(context.Background(), &models.User{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, inner.calls)
+}
+
+func TestResilientStoreDoesNotRetryAmbiguousWrites(t *testing.T) {
+	// the delete may have committed; a retry would find nothing left to delete
+	inner := &flakyStore{failures: 1, err: dal.ErrTransient}
+	store := dal.NewResilientStore(inner, fastOptions())
+	_, err := store.DeleteByKey(context.Background(), 1, &models.User{})
+	assert.True(t, errors.Is(err, dal.ErrTransient))
+	assert.Equal(t, 1, inner.calls)
+
+	inner = &flakyStore{failures: 1, err: dal.ErrRetryable}
+	store = dal.NewResilientStore(inner, fastOptions())
+	count, err := store.DeleteByKey(context.Background(), 1, &models.User{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	assert.Equal(t, 2, inner.calls)
+}
+
+func TestResilientStoreOpensCircuit(t *testing.T) {
+	inner := &flakyStore{failures: 100, err: dal.ErrTransient}
+	store := dal.NewResilientStore(inner, fastOptions())
+
+	err := store.ReadByKey(context.Background(), 1, &models.User{})
+	var unavailable *dal.UnavailableError
+	require.True(t, errors.As(err, &unavailable))
+	assert.True(t, errors.Is(err, dal.ErrUnavailable))
+	assert.Greater(t, unavailable.RetryAfter, time.Duration(0))
+	assert.Equal(t, 2, inner.calls)
+
+	// Errors that aren't transient don't trip the breaker
+	inner = &flakyStore{failures: 100, err: dal.ErrNotFound}
+	store = dal.NewResilientStore(inner, fastOptions())
+	for i := 0; i < 3; i++ {
+		assert.True(t, errors.Is(store.ReadByKey(context.Background(), 1, &models.User{}), dal.ErrNotFound))
+	}
+}
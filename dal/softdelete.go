@@ -0,0 +1,43 @@
+package dal
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// DeletedAtField is the stored field name SoftDeletable Items must use for
+// their deletion timestamp, so Stores can filter on it.
+const DeletedAtField = "deletedAt"
+
+// SoftDeletable is implemented by Items that are marked as deleted instead of
+// being removed. DeleteByKey sets the timestamp, RestoreByKey clears it and
+// PurgeByKey removes the Item for good.
+type SoftDeletable interface {
+	GetDeletedAt() *time.Time
+	SetDeletedAt(*time.Time)
+}
+
+// ErrNotSoftDeletable is returned by RestoreByKey for Item types that do not
+// implement SoftDeletable.
+var ErrNotSoftDeletable = errors.New("item type does not support soft delete")
+
+type includeDeletedKey struct{}
+
+// WithIncludeDeleted returns a context in which reads also return soft
+// deleted Items.
+func WithIncludeDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, includeDeletedKey{}, true)
+}
+
+// IncludeDeleted reports whether reads in ctx should return soft deleted Items.
+func IncludeDeleted(ctx context.Context) bool {
+	include, _ := ctx.Value(includeDeletedKey{}).(bool)
+	return include
+}
+
+// IsSoftDeletable reports whether Items of this type are soft deleted.
+func IsSoftDeletable(item Item) bool {
+	_, ok := item.(SoftDeletable)
+	return ok
+}
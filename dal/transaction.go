@@ -0,0 +1,10 @@
+package dal
+
+import "context"
+
+// Transactor is implemented by Stores that can run several operations
+// atomically. Store calls made with the context passed to fn are part of the
+// transaction; if fn returns an error, none of them take effect.
+type Transactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
@@ -0,0 +1,152 @@
+package dal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Validator is implemented by Items that need checks beyond what struct tags
+// can express (cross-field rules, lookups, ...). It is called after the
+// `validate` struct tags have passed.
+type Validator interface {
+	Validate(ctx context.Context) error
+}
+
+// FieldError describes a single failed validation rule.
+type FieldError struct {
+	Field   string `json:"field"`           // JSON path of the field, e.g. "address.city"
+	Rule    string `json:"rule"`            // Rule that failed, e.g. "required" or "email"
+	Param   string `json:"param,omitempty"` // Rule parameter, e.g. "20" for max=20
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when an Item fails validation. It carries every
+// failed rule so callers can report them all at once.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Message)
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// NewFieldError is a convenience for Validator implementations reporting a
+// single failed field.
+func NewFieldError(field, rule, message string) *ValidationError {
+	return &ValidationError{Errors: []FieldError{{Field: field, Rule: rule, Message: message}}}
+}
+
+var (
+	structValidator     *validator.Validate
+	structValidatorOnce sync.Once
+)
+
+func getStructValidator() *validator.Validate {
+	structValidatorOnce.Do(func() {
+		structValidator = validator.New(validator.WithRequiredStructEnabled())
+		// Report fields by their JSON names so errors match request bodies
+		structValidator.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+	})
+	return structValidator
+}
+
+// ValidateItem checks an Item against its `validate` struct tags and, if it
+// implements Validator, its own Validate method. Failures are returned as a
+// *ValidationError.
+func ValidateItem(ctx context.Context, item Item) error {
+	if err := getStructValidator().StructCtx(ctx, item); err != nil {
+		var verrs validator.ValidationErrors
+		if !errors.As(err, &verrs) {
+			return fmt.Errorf("validating item: %w", err)
+		}
+		return toValidationError(verrs)
+	}
+
+	if v, ok := item.(Validator); ok {
+		return v.Validate(ctx)
+	}
+	return nil
+}
+
+func toValidationError(verrs validator.ValidationErrors) *ValidationError {
+	result := &ValidationError{Errors: make([]FieldError, 0, len(verrs))}
+	for _, fe := range verrs {
+		// Namespace is "User.address.city"; drop the struct name
+		path := fe.Namespace()
+		if i := strings.Index(path, "."); i >= 0 {
+			path = path[i+1:]
+		}
+		result.Errors = append(result.Errors, FieldError{
+			Field:   path,
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: fieldMessage(path, fe),
+		})
+	}
+	return result
+}
+
+func fieldMessage(path string, fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", path)
+	case "email":
+		return fmt.Sprintf("%s must be a valid email address", path)
+	case "min":
+		return fmt.Sprintf("%s must be at least %s characters", path, fe.Param())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s characters", path, fe.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of [%s]", path, fe.Param())
+	case "alphanum":
+		return fmt.Sprintf("%s must contain only letters and digits", path)
+	}
+	if fe.Param() != "" {
+		return fmt.Sprintf("%s failed %s=%s", path, fe.Tag(), fe.Param())
+	}
+	return fmt.Sprintf("%s failed %s", path, fe.Tag())
+}
+
+// ValidatingStore is a Store decorator that validates Items before they are
+// written, so invalid data is rejected no matter which caller writes it.
+type ValidatingStore struct {
+	Store
+}
+
+// NewValidatingStore wraps store with validation on Create and UpdateByKey.
+func NewValidatingStore(store Store) Store {
+	return &ValidatingStore{Store: store}
+}
+
+func (s *ValidatingStore) Create(ctx context.Context, item Item) (Item, error) {
+	if err := ValidateItem(ctx, item); err != nil {
+		return nil, err
+	}
+	return s.Store.Create(ctx, item)
+}
+
+func (s *ValidatingStore) UpdateByKey(ctx context.Context, key interface{}, item Item) (int64, error) {
+	if err := ValidateItem(ctx, item); err != nil {
+		return 0, err
+	}
+	return s.Store.UpdateByKey(ctx, key, item)
+}
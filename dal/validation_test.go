@@ -0,0 +1,28 @@
+package dal_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateItem(t *testing.T) {
+	ctx := context.Background()
+
+	err := dal.ValidateItem(ctx, &models.User{Username: "jdoe", Email: "jdoe@example.com"})
+	assert.NoError(t, err)
+
+	err = dal.ValidateItem(ctx, &models.User{Username: "j", Email: "not-an-email"})
+	var validationErr *dal.ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	require.Len(t, validationErr.Errors, 2)
+	assert.Equal(t, "username", validationErr.Errors[0].Field)
+	assert.Equal(t, "min", validationErr.Errors[0].Rule)
+	assert.Equal(t, "email", validationErr.Errors[1].Field)
+	assert.Equal(t, "email", validationErr.Errors[1].Rule)
+}
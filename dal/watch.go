@@ -0,0 +1,54 @@
+package dal
+
+import (
+	"context"
+	"time"
+)
+
+// ChangeOp is the kind of change a ChangeEvent reports.
+type ChangeOp string
+
+const (
+	ChangeInsert  ChangeOp = "insert"
+	ChangeUpdate  ChangeOp = "update"  // partial update, e.g. a soft delete or restore
+	ChangeReplace ChangeOp = "replace" // UpdateByKey replaces the whole item
+	ChangeDelete  ChangeOp = "delete"
+)
+
+// ChangeEvent describes one change to an Item.
+type ChangeEvent struct {
+	Op        ChangeOp
+	Namespace string
+	ItemGroup string
+	Key       interface{}
+	// Item is the full item after the change. For deletes it is the last
+	// state before the delete when the backend can provide it, nil otherwise.
+	Item Item
+	At   time.Time
+	// ResumeToken identifies the position of this event in the change feed.
+	// Persist it and pass it back with WithResumeToken to continue after it.
+	ResumeToken []byte
+	// Err is set on the last event of a feed that stopped because of an error.
+	Err error
+}
+
+// Watcher is implemented by Stores that can notify about changes. Watch sends
+// the changes of itemType's ItemGroup matching filter (nil for all) until ctx
+// is cancelled or the feed fails, then closes the channel.
+type Watcher interface {
+	Watch(ctx context.Context, itemType Item, filter Filter) (<-chan ChangeEvent, error)
+}
+
+type resumeTokenKey struct{}
+
+// WithResumeToken returns a context that makes Watch continue after the event
+// the token came from, instead of starting with new changes only.
+func WithResumeToken(ctx context.Context, token []byte) context.Context {
+	return context.WithValue(ctx, resumeTokenKey{}, token)
+}
+
+// ResumeTokenFrom returns the resume token stored in ctx, if any.
+func ResumeTokenFrom(ctx context.Context) []byte {
+	token, _ := ctx.Value(resumeTokenKey{}).([]byte)
+	return token
+}
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	// replayLimit is how many past changes are kept so watchers can resume.
+	replayLimit = 1024
+	// subscriberQueueLimit is how far a watcher may fall behind before it is
+	// dropped; it can then resume from the last token it saw.
+	subscriberQueueLimit = 1024
+)
+
+// errWatcherTooSlow ends the feed of a watcher that fell too far behind.
+var errWatcherTooSlow = errors.New("watcher fell too far behind; resume from the last token")
+
+// change is a stored change, decoded into an Item per subscriber.
+type change struct {
+	seq       uint64
+	op        dal.ChangeOp
+	namespace string
+	group     string
+	key       interface{}
+	doc       bson.Raw
+	at        time.Time
+}
+
+func (c change) token() []byte {
+	token := make([]byte, 8)
+	binary.BigEndian.PutUint64(token, c.seq)
+	return token
+}
+
+func sequenceFromToken(token []byte) (uint64, bool) {
+	if len(token) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(token), true
+}
+
+// subscriber queues changes for one watcher. The queue decouples writers from
+// slow readers: publishing never blocks.
+type subscriber struct {
+	mu      sync.Mutex
+	queue   []change
+	failed  error
+	notify  chan struct{}
+	matches func(change) bool
+}
+
+func (s *subscriber) push(c change) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failed != nil {
+		return
+	}
+	if len(s.queue) >= subscriberQueueLimit {
+		s.failed = errWatcherTooSlow
+	} else {
+		s.queue = append(s.queue, c)
+	}
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscriber) pop() (change, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) > 0 {
+		c := s.queue[0]
+		s.queue = s.queue[1:]
+		return c, true, nil
+	}
+	return change{}, false, s.failed
+}
+
+// broadcaster fans changes of an in-process store out to its watchers.
+type broadcaster struct {
+	mu          sync.Mutex
+	seq         uint64
+	recent      []change
+	subscribers map[*subscriber]struct{}
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{subscribers: make(map[*subscriber]struct{})}
+}
+
+func (b *broadcaster) publish(c change) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	c.seq = b.seq
+	b.recent = append(b.recent, c)
+	if len(b.recent) > replayLimit {
+		b.recent = b.recent[len(b.recent)-replayLimit:]
+	}
+	for sub := range b.subscribers {
+		if sub.matches(c) {
+			sub.push(c)
+		}
+	}
+}
+
+// subscribe registers a watcher. With a resume token the changes after it are
+// replayed first, as long as they are still in the replay buffer.
+func (b *broadcaster) subscribe(matches func(change) bool, resumeToken []byte) (*subscriber, error) {
+	sub := &subscriber{notify: make(chan struct{}, 1), matches: matches}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if resumeToken != nil {
+		after, ok := sequenceFromToken(resumeToken)
+		if !ok {
+			return nil, errors.New("invalid resume token")
+		}
+		if after < b.seq && (len(b.recent) == 0 || b.recent[0].seq > after+1) {
+			return nil, errors.New("resume token is too old")
+		}
+		for _, c := range b.recent {
+			if c.seq > after && matches(c) {
+				sub.push(c)
+			}
+		}
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub, nil
+}
+
+func (b *broadcaster) unsubscribe(sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers, sub)
+}
+
+// stream delivers a subscriber's changes on a channel until ctx ends or the
+// subscriber fails.
+func (b *broadcaster) stream(ctx context.Context, sub *subscriber, toEvent func(change) dal.ChangeEvent) <-chan dal.ChangeEvent {
+	events := make(chan dal.ChangeEvent)
+	go func() {
+		defer close(events)
+		defer b.unsubscribe(sub)
+		for {
+			c, ok, err := sub.pop()
+			if err != nil {
+				select {
+				case events <- dal.ChangeEvent{Err: err}:
+				case <-ctx.Done():
+				}
+				return
+			}
+			if !ok {
+				select {
+				case <-sub.notify:
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case events <- toEvent(c):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events
+}
@@ -0,0 +1,334 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// matchFilter evaluates the subset of the MongoDB query language the REST
+// layer produces (comparison operators, $in/$nin, $regex, $exists and
+// $and/$or/$nor) against a decoded document.
+func matchFilter(doc bson.M, filter bson.M) (bool, error) {
+	for key, cond := range filter {
+		switch key {
+		case "$and", "$or", "$nor":
+			clauses, err := toClauses(cond)
+			if err != nil {
+				return false, err
+			}
+			matched, err := matchLogical(doc, key, clauses)
+			if err != nil || !matched {
+				return false, err
+			}
+		default:
+			if strings.HasPrefix(key, "$") {
+				return false, fmt.Errorf("unsupported top-level operator %s", key)
+			}
+			matched, err := matchField(lookupField(doc, key), cond)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+func matchLogical(doc bson.M, op string, clauses []bson.M) (bool, error) {
+	for _, clause := range clauses {
+		matched, err := matchFilter(doc, clause)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case op == "$and" && !matched:
+			return false, nil
+		case op == "$or" && matched:
+			return true, nil
+		case op == "$nor" && matched:
+			return false, nil
+		}
+	}
+	return op != "$or", nil
+}
+
+func toClauses(v interface{}) ([]bson.M, error) {
+	switch clauses := v.(type) {
+	case []bson.M:
+		return clauses, nil
+	case bson.A:
+		result := make([]bson.M, 0, len(clauses))
+		for _, c := range clauses {
+			m, ok := toDocument(c)
+			if !ok {
+				return nil, fmt.Errorf("invalid logical clause %v", c)
+			}
+			result = append(result, m)
+		}
+		return result, nil
+	case []interface{}:
+		return toClauses(bson.A(clauses))
+	}
+	return nil, fmt.Errorf("invalid logical clauses %v", v)
+}
+
+func toDocument(v interface{}) (bson.M, bool) {
+	switch m := v.(type) {
+	case bson.M:
+		return m, true
+	case map[string]interface{}:
+		return bson.M(m), true
+	case bson.D:
+		return m.Map(), true
+	}
+	return nil, false
+}
+
+// lookupField resolves a dotted path; missing fields resolve to nil.
+func lookupField(doc bson.M, path string) interface{} {
+	var current interface{} = doc
+	for _, part := range strings.Split(path, ".") {
+		m, ok := toDocument(current)
+		if !ok {
+			return nil
+		}
+		current = m[part]
+	}
+	return current
+}
+
+func matchField(value interface{}, cond interface{}) (bool, error) {
+	ops, ok := toDocument(cond)
+	if !ok || !isOperatorDocument(ops) {
+		return matchEquals(value, cond), nil
+	}
+
+	for op, operand := range ops {
+		var matched bool
+		switch op {
+		case "$eq":
+			matched = matchEquals(value, operand)
+		case "$ne":
+			matched = !matchEquals(value, operand)
+		case "$gt", "$gte", "$lt", "$lte":
+			matched = matchCompare(value, op, operand)
+		case "$in", "$nin":
+			list, err := toList(operand)
+			if err != nil {
+				return false, err
+			}
+			matched = false
+			for _, candidate := range list {
+				if matchEquals(value, candidate) {
+					matched = true
+					break
+				}
+			}
+			if op == "$nin" {
+				matched = !matched
+			}
+		case "$exists":
+			exists, _ := operand.(bool)
+			matched = (value != nil) == exists
+		case "$regex":
+			re, err := toRegexp(operand, ops["$options"])
+			if err != nil {
+				return false, err
+			}
+			matched = anyElement(value, func(v interface{}) bool {
+				s, ok := v.(string)
+				return ok && re.MatchString(s)
+			})
+		case "$options":
+			matched = true // consumed by $regex
+		default:
+			return false, fmt.Errorf("unsupported operator %s", op)
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func isOperatorDocument(m bson.M) bool {
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+	return len(m) > 0
+}
+
+func toList(v interface{}) ([]interface{}, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("$in/$nin needs an array, got %T", v)
+	}
+	list := make([]interface{}, rv.Len())
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+	return list, nil
+}
+
+func toRegexp(pattern interface{}, options interface{}) (*regexp.Regexp, error) {
+	var expr, flags string
+	switch p := pattern.(type) {
+	case primitive.Regex:
+		expr, flags = p.Pattern, p.Options
+	case string:
+		expr = p
+		flags, _ = options.(string)
+	default:
+		return nil, fmt.Errorf("invalid $regex %v", pattern)
+	}
+	if strings.Contains(flags, "i") {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+// anyElement applies fn to value or, like MongoDB, to each element when value
+// is an array.
+func anyElement(value interface{}, fn func(interface{}) bool) bool {
+	if arr, ok := value.(bson.A); ok {
+		for _, v := range arr {
+			if fn(v) {
+				return true
+			}
+		}
+		return false
+	}
+	return fn(value)
+}
+
+func matchEquals(value interface{}, operand interface{}) bool {
+	if operand == nil {
+		return value == nil
+	}
+	return anyElement(value, func(v interface{}) bool {
+		cmp, ok := compareValues(v, operand)
+		return ok && cmp == 0
+	})
+}
+
+// sortValues orders two values for sorting, nulls first.
+func sortValues(a, b interface{}) int {
+	switch a, b = normalize(a), normalize(b); {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	cmp, _ := compareValues(a, b)
+	return cmp
+}
+
+func matchCompare(value interface{}, op string, operand interface{}) bool {
+	return anyElement(value, func(v interface{}) bool {
+		cmp, ok := compareValues(v, operand)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "$gt":
+			return cmp > 0
+		case "$gte":
+			return cmp >= 0
+		case "$lt":
+			return cmp < 0
+		default:
+			return cmp <= 0
+		}
+	})
+}
+
+// normalize maps the Go types a value can have in a decoded document or in a
+// filter onto a comparable representation.
+func normalize(v interface{}) interface{} {
+	switch x := v.(type) {
+	case primitive.DateTime:
+		return x.Time().UTC()
+	case time.Time:
+		return x.UTC()
+	case *time.Time:
+		if x == nil {
+			return nil
+		}
+		return x.UTC()
+	case int:
+		return float64(x)
+	case int32:
+		return float64(x)
+	case int64:
+		return float64(x)
+	case float32:
+		return float64(x)
+	case primitive.ObjectID:
+		return x.Hex()
+	}
+	return v
+}
+
+// compareValues orders two values of the same kind; ok is false when they
+// are not comparable. Like in MongoDB, null is only comparable to null, so
+// {"$lt": v} doesn't match missing fields.
+func compareValues(a, b interface{}) (cmp int, ok bool) {
+	a, b = normalize(a), normalize(b)
+	switch x := a.(type) {
+	case nil:
+		return 0, b == nil
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		return compareOrdered(x, y), true
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	case time.Time:
+		y, ok := b.(time.Time)
+		if !ok {
+			return 0, false
+		}
+		return x.Compare(y), true
+	case bool:
+		y, ok := b.(bool)
+		if !ok || x == y {
+			return 0, ok
+		}
+		if !x {
+			return -1, true
+		}
+		return 1, true
+	}
+	if b == nil {
+		return 1, true
+	}
+	if reflect.DeepEqual(a, b) {
+		return 0, true
+	}
+	return 0, false
+}
+
+func compareOrdered(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,670 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/dal"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore is an in-process dal.Store. Items are kept as BSON documents
+// and filtered with the same bson.M filters MongoStore accepts, so it can
+// stand in for MongoDB in tests and local development. It also implements
+// dal.Watcher.
+type MemoryStore struct {
+	mu          sync.RWMutex
+	collections map[string]*memoryCollection
+	changes     *broadcaster
+
+	// writeMu serializes writers with transactions; pending collects the
+	// changes of the running transaction until it commits.
+	writeMu sync.Mutex
+	pending []change
+	inTx    bool
+}
+
+type memoryCollection struct {
+	docs    map[string]bson.Raw
+	order   []string // insertion order, so unsorted reads are stable
+	indexes []dal.Index
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		collections: make(map[string]*memoryCollection),
+		changes:     newBroadcaster(),
+	}
+}
+
+// keyString turns a key into the map key documents are stored under.
+func keyString(key interface{}) string {
+	if id, ok := key.(primitive.ObjectID); ok {
+		return id.Hex()
+	}
+	return fmt.Sprint(key)
+}
+
+// collection returns the collection of an item type, creating it on first
+// use. Callers must hold the write lock when create is true.
+func (s *MemoryStore) collection(itemType dal.Item, create bool) *memoryCollection {
+	name := itemType.Namespace() + "." + itemType.ItemGroup()
+	coll, ok := s.collections[name]
+	if !ok && create {
+		coll = &memoryCollection{docs: make(map[string]bson.Raw)}
+		s.collections[name] = coll
+	}
+	return coll
+}
+
+// publish announces a change to watchers, or holds it back until the running
+// transaction commits. Callers must hold the write lock.
+func (s *MemoryStore) publish(op dal.ChangeOp, itemType dal.Item, key interface{}, doc bson.Raw) {
+	c := change{
+		op:        op,
+		namespace: itemType.Namespace(),
+		group:     itemType.ItemGroup(),
+		key:       key,
+		doc:       doc,
+		at:        time.Now().UTC(),
+	}
+	if s.inTx {
+		s.pending = append(s.pending, c)
+		return
+	}
+	s.changes.publish(c)
+}
+
+type memoryTxKey struct{}
+
+// lockWrites makes a write wait for a running transaction, unless the write
+// is part of it. It returns the matching unlock function.
+func (s *MemoryStore) lockWrites(ctx context.Context) func() {
+	if tx, _ := ctx.Value(memoryTxKey{}).(*MemoryStore); tx == s {
+		return func() {}
+	}
+	s.writeMu.Lock()
+	return s.writeMu.Unlock
+}
+
+// WithTransaction runs fn with all other writers held off. When fn fails the
+// collections are rolled back to their state before fn and its changes are
+// never announced to watchers. Reads are not isolated: they can see the
+// transaction's writes before it commits.
+func (s *MemoryStore) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if tx, _ := ctx.Value(memoryTxKey{}).(*MemoryStore); tx == s {
+		return fn(ctx) // already in a transaction
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.mu.Lock()
+	snapshot := s.snapshot()
+	s.inTx = true
+	s.mu.Unlock()
+
+	err := fn(context.WithValue(ctx, memoryTxKey{}, s))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := s.pending
+	s.inTx, s.pending = false, nil
+	if err != nil {
+		s.collections = snapshot
+		return err
+	}
+	for _, c := range pending {
+		s.changes.publish(c)
+	}
+	return nil
+}
+
+// snapshot copies the collections; stored documents are never modified in
+// place, so they can be shared.
+func (s *MemoryStore) snapshot() map[string]*memoryCollection {
+	result := make(map[string]*memoryCollection, len(s.collections))
+	for name, coll := range s.collections {
+		docs := make(map[string]bson.Raw, len(coll.docs))
+		for k, v := range coll.docs {
+			docs[k] = v
+		}
+		result[name] = &memoryCollection{
+			docs:    docs,
+			order:   append([]string(nil), coll.order...),
+			indexes: append([]dal.Index(nil), coll.indexes...),
+		}
+	}
+	return result
+}
+
+func isDeleted(doc bson.M) bool {
+	return doc[dal.DeletedAtField] != nil
+}
+
+func decodeDocument(raw bson.Raw) (bson.M, error) {
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("decoding stored document: %w", err)
+	}
+	return doc, nil
+}
+
+func (s *MemoryStore) Create(ctx context.Context, item dal.Item) (dal.Item, error) {
+	raw, err := bson.Marshal(item)
+	if err != nil {
+		return nil, fmt.Errorf("creating entity: %w", err)
+	}
+	doc, err := decodeDocument(raw)
+	if err != nil {
+		return nil, err
+	}
+	if doc["_id"] == nil {
+		if err := item.SetKey(primitive.NewObjectID()); err != nil {
+			return nil, fmt.Errorf("creating entity: %w", err)
+		}
+		if raw, err = bson.Marshal(item); err != nil {
+			return nil, fmt.Errorf("creating entity: %w", err)
+		}
+		if doc, err = decodeDocument(raw); err != nil {
+			return nil, err
+		}
+	}
+
+	defer s.lockWrites(ctx)()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	coll := s.collection(item, true)
+	key := keyString(doc["_id"])
+	if _, exists := coll.docs[key]; exists {
+		return nil, fmt.Errorf("creating entity: %w", dal.NewDuplicateKeyError(item, "_id_"))
+	}
+	if err := coll.checkUnique(item, doc, key); err != nil {
+		return nil, fmt.Errorf("creating entity: %w", err)
+	}
+	coll.docs[key] = raw
+	coll.order = append(coll.order, key)
+
+	s.publish(dal.ChangeInsert, item, doc["_id"], raw)
+	return item, nil
+}
+
+func (s *MemoryStore) ReadByKey(ctx context.Context, key interface{}, item dal.Item) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	raw, doc, err := s.find(item, key)
+	if err != nil {
+		return fmt.Errorf("getting entity by ID: %w", err)
+	}
+	if dal.IsSoftDeletable(item) && isDeleted(doc) && !dal.IncludeDeleted(ctx) {
+		return fmt.Errorf("getting entity by ID: %w", dal.ErrNotFound)
+	}
+	if err := item.Unmarshal(raw); err != nil {
+		return fmt.Errorf("decoding entity: %w", err)
+	}
+	return nil
+}
+
+func (s *MemoryStore) ReadByKeys(ctx context.Context, keys []interface{}, itemType dal.Item) ([]dal.Item, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make([]dal.Item, len(keys))
+	for i, key := range keys {
+		raw, doc, err := s.find(itemType, key)
+		if errors.Is(err, dal.ErrNotFound) ||
+			err == nil && dal.IsSoftDeletable(itemType) && isDeleted(doc) && !dal.IncludeDeleted(ctx) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("getting entities by ID: %w", err)
+		}
+		item := itemType.New()
+		if err := item.Unmarshal(raw); err != nil {
+			return nil, fmt.Errorf("decoding entity: %w", err)
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
+// find returns a stored document; callers must hold the lock.
+func (s *MemoryStore) find(itemType dal.Item, key interface{}) (bson.Raw, bson.M, error) {
+	coll := s.collection(itemType, false)
+	if coll == nil {
+		return nil, nil, dal.ErrNotFound
+	}
+	raw, ok := coll.docs[keyString(key)]
+	if !ok {
+		return nil, nil, dal.ErrNotFound
+	}
+	doc, err := decodeDocument(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	return raw, doc, nil
+}
+
+func (s *MemoryStore) ReadByFilter(ctx context.Context, opts dal.QueryOptions, itemType dal.Item) (dal.ItemIterator, error) {
+	native, err := nativeFilter(opts.GetFilter())
+	if err != nil {
+		return nil, fmt.Errorf("finding by filter: %w", err)
+	}
+	filter := excludeDeleted(ctx, itemType, native)
+
+	s.mu.RLock()
+	matches, err := s.matching(itemType, filter, opts.GetSort())
+	s.mu.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("finding by filter: %w", err)
+	}
+
+	skip, limit := opts.GetSkip(), opts.GetLimit()
+	if skip > int64(len(matches)) {
+		skip = int64(len(matches))
+	}
+	matches = matches[skip:]
+	if limit > 0 && limit < int64(len(matches)) {
+		matches = matches[:limit]
+	}
+
+	docs := make([]bson.Raw, 0, len(matches))
+	for _, m := range matches {
+		docs = append(docs, m.raw)
+	}
+	return &memoryItemIterator{docs: docs, pos: -1}, nil
+}
+
+// memoryMatch is a stored document matching a filter.
+type memoryMatch struct {
+	raw bson.Raw
+	doc bson.M
+}
+
+// matching returns the documents of itemType's collection that match filter,
+// in sort order. The caller holds s.mu.
+func (s *MemoryStore) matching(itemType dal.Item, filter bson.M, sortOrder interface{}) ([]memoryMatch, error) {
+	matches := make([]memoryMatch, 0)
+	if coll := s.collection(itemType, false); coll != nil {
+		for _, key := range coll.order {
+			raw := coll.docs[key]
+			doc, err := decodeDocument(raw)
+			if err != nil {
+				return nil, err
+			}
+			ok, err := matchFilter(doc, filter)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				matches = append(matches, memoryMatch{raw: raw, doc: doc})
+			}
+		}
+	}
+
+	if sortFields, ok := sortOrder.(bson.D); ok && len(sortFields) > 0 {
+		sort.SliceStable(matches, func(i, j int) bool {
+			for _, field := range sortFields {
+				cmp := sortValues(lookupField(matches[i].doc, field.Key), lookupField(matches[j].doc, field.Key))
+				if cmp == 0 {
+					continue
+				}
+				if order, _ := normalize(field.Value).(float64); order < 0 {
+					return cmp > 0
+				}
+				return cmp < 0
+			}
+			return false
+		})
+	}
+	return matches, nil
+}
+
+// Claim implements dal.Claimer: matching and updating happen under the
+// store's write lock.
+func (s *MemoryStore) Claim(ctx context.Context, opts dal.QueryOptions, fields map[string]interface{}, item dal.Item) error {
+	native, err := nativeFilter(opts.GetFilter())
+	if err != nil {
+		return fmt.Errorf("claiming entity: %w", err)
+	}
+	filter := excludeDeleted(ctx, item, native)
+
+	defer s.lockWrites(ctx)()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	matches, err := s.matching(item, filter, opts.GetSort())
+	if err != nil {
+		return fmt.Errorf("claiming entity: %w", err)
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("claiming entity: %w", dal.ErrNotFound)
+	}
+
+	doc := matches[0].doc
+	for field, value := range fields {
+		doc[field] = value
+	}
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("claiming entity: %w", err)
+	}
+	key := keyString(doc["_id"])
+	coll := s.collection(item, false)
+	if err := coll.checkUnique(item, doc, key); err != nil {
+		return fmt.Errorf("claiming entity: %w", err)
+	}
+	coll.docs[key] = raw
+	s.publish(dal.ChangeUpdate, item, doc["_id"], raw)
+
+	if err := item.Unmarshal(raw); err != nil {
+		return fmt.Errorf("decoding entity: %w", err)
+	}
+	return nil
+}
+
+func (s *MemoryStore) UpdateByKey(ctx context.Context, key interface{}, update dal.Item) (int64, error) {
+	raw, err := bson.Marshal(update)
+	if err != nil {
+		return 0, fmt.Errorf("updating entity: %w", err)
+	}
+	doc, err := decodeDocument(raw)
+	if err != nil {
+		return 0, err
+	}
+
+	defer s.lockWrites(ctx)()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existingRaw, existing, err := s.find(update, key)
+	if err == nil && dal.IsSoftDeletable(update) && isDeleted(existing) {
+		// Soft deleted items have to be restored before they can be updated
+		err = dal.ErrNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("updating entity: %w", err)
+	}
+
+	coll := s.collection(update, false)
+	if err := coll.checkUnique(update, doc, keyString(key)); err != nil {
+		return 0, fmt.Errorf("updating entity: %w", err)
+	}
+	if bytes.Equal(existingRaw, raw) {
+		return 0, nil
+	}
+	coll.docs[keyString(key)] = raw
+
+	s.publish(dal.ChangeReplace, update, key, raw)
+	return 1, nil
+}
+
+func (s *MemoryStore) DeleteByKey(ctx context.Context, key interface{}, itemType dal.Item) (int64, error) {
+	if !dal.IsSoftDeletable(itemType) {
+		return s.PurgeByKey(ctx, key, itemType)
+	}
+	now := time.Now().UTC()
+	return s.setDeletedAt(ctx, key, itemType, &now)
+}
+
+func (s *MemoryStore) RestoreByKey(ctx context.Context, key interface{}, itemType dal.Item) (int64, error) {
+	if !dal.IsSoftDeletable(itemType) {
+		return 0, dal.ErrNotSoftDeletable
+	}
+	return s.setDeletedAt(ctx, key, itemType, nil)
+}
+
+// setDeletedAt soft deletes (deletedAt != nil) or restores an item. Like the
+// MongoDB update it mirrors, it only counts items whose state changed.
+func (s *MemoryStore) setDeletedAt(ctx context.Context, key interface{}, itemType dal.Item, deletedAt *time.Time) (int64, error) {
+	defer s.lockWrites(ctx)()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, doc, err := s.find(itemType, key)
+	if err == dal.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if isDeleted(doc) == (deletedAt != nil) {
+		return 0, nil
+	}
+
+	if deletedAt != nil {
+		doc[dal.DeletedAtField] = *deletedAt
+	} else {
+		delete(doc, dal.DeletedAtField)
+		// Restored items are back to deletedAt null in the unique indexes
+		if err := s.collection(itemType, false).checkUnique(itemType, doc, keyString(key)); err != nil {
+			return 0, fmt.Errorf("restoring entity: %w", err)
+		}
+	}
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return 0, fmt.Errorf("soft deleting entity: %w", err)
+	}
+	s.collection(itemType, false).docs[keyString(key)] = raw
+
+	s.publish(dal.ChangeUpdate, itemType, key, raw)
+	return 1, nil
+}
+
+func (s *MemoryStore) PurgeByKey(ctx context.Context, key interface{}, itemType dal.Item) (int64, error) {
+	defer s.lockWrites(ctx)()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	raw, _, err := s.find(itemType, key)
+	if err == dal.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	coll := s.collection(itemType, false)
+	k := keyString(key)
+	delete(coll.docs, k)
+	for i, existing := range coll.order {
+		if existing == k {
+			coll.order = append(coll.order[:i], coll.order[i+1:]...)
+			break
+		}
+	}
+
+	s.publish(dal.ChangeDelete, itemType, key, raw)
+	return 1, nil
+}
+
+// EnsureIndexes records the unique indexes of Indexed items and enforces them
+// on later writes, forgetting retired ones. Other index kinds only matter for
+// performance and are ignored.
+func (s *MemoryStore) EnsureIndexes(ctx context.Context, items ...dal.Item) error {
+	defer s.lockWrites(ctx)()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, item := range items {
+		indexed, ok := item.(dal.Indexed)
+		if !ok {
+			continue
+		}
+		coll := s.collection(item, true)
+		if retired, ok := item.(dal.RetiredIndexes); ok {
+			for _, name := range retired.RetiredIndexes() {
+				coll.dropIndex(name)
+			}
+		}
+		for _, idx := range indexed.Indexes() {
+			if !idx.Unique || coll.hasIndex(idx.IndexName()) {
+				continue
+			}
+			coll.indexes = append(coll.indexes, idx)
+			for key, raw := range coll.docs {
+				doc, err := decodeDocument(raw)
+				if err != nil {
+					return err
+				}
+				if err := coll.checkUnique(item, doc, key); err != nil {
+					coll.indexes = coll.indexes[:len(coll.indexes)-1]
+					return fmt.Errorf("creating indexes for %s.%s: %w", item.Namespace(), item.ItemGroup(), err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *memoryCollection) dropIndex(name string) {
+	for i, idx := range c.indexes {
+		if idx.IndexName() == name {
+			c.indexes = append(c.indexes[:i], c.indexes[i+1:]...)
+			return
+		}
+	}
+}
+
+func (c *memoryCollection) hasIndex(name string) bool {
+	for _, idx := range c.indexes {
+		if idx.IndexName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUnique verifies doc against the unique indexes, ignoring the document
+// stored under selfKey.
+func (c *memoryCollection) checkUnique(item dal.Item, doc bson.M, selfKey string) error {
+	for _, idx := range c.indexes {
+		values := indexValues(idx, doc)
+		if values == nil {
+			continue
+		}
+		for key, raw := range c.docs {
+			if key == selfKey {
+				continue
+			}
+			other, err := decodeDocument(raw)
+			if err != nil {
+				return err
+			}
+			if sameValues(values, indexValues(idx, other)) {
+				return dal.NewDuplicateKeyError(item, idx.IndexName())
+			}
+		}
+	}
+	return nil
+}
+
+// indexValues returns the values of the indexed fields, or nil when a sparse
+// index doesn't cover the document.
+func indexValues(idx dal.Index, doc bson.M) []interface{} {
+	values := make([]interface{}, 0, len(idx.Fields))
+	covered := false
+	for _, f := range idx.Fields {
+		v := lookupField(doc, f.Field)
+		covered = covered || v != nil
+		values = append(values, v)
+	}
+	if idx.Sparse && !covered {
+		return nil
+	}
+	return values
+}
+
+func sameValues(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if cmp, ok := compareValues(a[i], b[i]); !ok || cmp != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Watch delivers the changes made through this store. Resume tokens stay
+// valid for the last changes kept in the replay buffer.
+func (s *MemoryStore) Watch(ctx context.Context, itemType dal.Item, filter dal.Filter) (<-chan dal.ChangeEvent, error) {
+	native, err := nativeFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("watching %s: %w", itemType.ItemGroup(), err)
+	}
+
+	matches := func(c change) bool {
+		if c.namespace != itemType.Namespace() || c.group != itemType.ItemGroup() {
+			return false
+		}
+		if c.op == dal.ChangeDelete || len(native) == 0 {
+			return true
+		}
+		doc, err := decodeDocument(c.doc)
+		if err != nil {
+			return false
+		}
+		ok, _ := matchFilter(doc, native)
+		return ok
+	}
+
+	sub, err := s.changes.subscribe(matches, dal.ResumeTokenFrom(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("watching %s: %w", itemType.ItemGroup(), err)
+	}
+
+	toEvent := func(c change) dal.ChangeEvent {
+		event := dal.ChangeEvent{
+			Op:          c.op,
+			Namespace:   c.namespace,
+			ItemGroup:   c.group,
+			Key:         c.key,
+			At:          c.at,
+			ResumeToken: c.token(),
+		}
+		item := itemType.New()
+		if err := bson.Unmarshal(c.doc, item); err != nil {
+			event.Err = fmt.Errorf("decoding changed item: %w", err)
+		} else {
+			event.Item = item
+		}
+		return event
+	}
+	return s.changes.stream(ctx, sub, toEvent), nil
+}
+
+type memoryItemIterator struct {
+	docs []bson.Raw
+	pos  int
+}
+
+func (m *memoryItemIterator) Next(ctx context.Context) bool {
+	if m.pos+1 >= len(m.docs) {
+		return false
+	}
+	m.pos++
+	return true
+}
+
+func (m *memoryItemIterator) Decode(item dal.Item) error {
+	if err := item.Unmarshal(m.docs[m.pos]); err != nil {
+		return newDecodeError(m.docs[m.pos], err)
+	}
+	return nil
+}
+
+func (m *memoryItemIterator) Close(ctx context.Context) error {
+	return nil
+}
+
+func (m *memoryItemIterator) Err() error {
+	return nil
+}
@@ -0,0 +1,220 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func createUser(t *testing.T, store dal.Store, username string, birthdate time.Time) *models.User {
+	t.Helper()
+	user := &models.User{ID: primitive.NewObjectID(), Username: username, Email: username + "@example.com", Birthdate: birthdate}
+	_, err := store.Create(context.Background(), user)
+	require.NoError(t, err)
+	return user
+}
+
+func readAll(t *testing.T, store dal.Store, ctx context.Context, opts dal.QueryOptions) []string {
+	t.Helper()
+	iter, err := store.ReadByFilter(ctx, opts, &models.User{})
+	require.NoError(t, err)
+	defer iter.Close(ctx)
+
+	names := make([]string, 0)
+	for iter.Next(ctx) {
+		user := &models.User{}
+		require.NoError(t, iter.Decode(user))
+		names = append(names, user.Username)
+	}
+	require.NoError(t, iter.Err())
+	return names
+}
+
+func TestMemoryStoreCRUD(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	user := createUser(t, store, "alice", time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	read := &models.User{}
+	require.NoError(t, store.ReadByKey(ctx, user.ID, read))
+	assert.Equal(t, "alice", read.Username)
+
+	read.Email = "alice@example.org"
+	modified, err := store.UpdateByKey(ctx, user.ID, read)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), modified)
+
+	deleted, err := store.PurgeByKey(ctx, user.ID, &models.User{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	assert.True(t, errors.Is(store.ReadByKey(ctx, user.ID, &models.User{}), dal.ErrNotFound))
+
+	_, err = store.UpdateByKey(ctx, user.ID, read)
+	assert.True(t, errors.Is(err, dal.ErrNotFound))
+}
+
+func TestMemoryStoreFilterSortAndPage(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	createUser(t, store, "carol", time.Date(1985, 1, 1, 0, 0, 0, 0, time.UTC))
+	createUser(t, store, "alice", time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC))
+	createUser(t, store, "bob", time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	byName := NewMongoDalQueryOptions(NewMongoFilter(nil), bson.D{{Key: "username", Value: 1}}, 0, 0)
+	assert.Equal(t, []string{"alice", "bob", "carol"}, readAll(t, store, ctx, byName))
+
+	olderFirst := bson.M{"birthdate": bson.M{"$lt": time.Date(1995, 1, 1, 0, 0, 0, 0, time.UTC)}}
+	opts := NewMongoDalQueryOptions(NewMongoFilter(olderFirst), bson.D{{Key: "birthdate", Value: -1}}, 0, 0)
+	assert.Equal(t, []string{"alice", "carol"}, readAll(t, store, ctx, opts))
+
+	contains := bson.M{"username": bson.M{"$regex": primitive.Regex{Pattern: "O", Options: "i"}}}
+	opts = NewMongoDalQueryOptions(NewMongoFilter(contains), bson.D{{Key: "username", Value: 1}}, 1, 1)
+	assert.Equal(t, []string{"carol"}, readAll(t, store, ctx, opts))
+}
+
+// rawFilter is a dal.Filter of any native type.
+type rawFilter struct{ native interface{} }
+
+func (f rawFilter) ToNative() interface{} { return f.native }
+
+func TestMemoryStoreFilterTypes(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	createUser(t, store, "alice", time.Time{})
+	createUser(t, store, "bob", time.Time{})
+
+	byD := NewMongoDalQueryOptions(rawFilter{bson.D{{Key: "username", Value: "bob"}}}, bson.D{}, 0, 0)
+	assert.Equal(t, []string{"bob"}, readAll(t, store, ctx, byD))
+
+	// filters that can't be read never match everything
+	_, err := store.ReadByFilter(ctx, NewMongoDalQueryOptions(rawFilter{"username = 'bob'"}, bson.D{}, 0, 0), &models.User{})
+	assert.Error(t, err)
+	_, err = store.Watch(ctx, &models.User{}, rawFilter{42})
+	assert.Error(t, err)
+}
+
+func TestMemoryStoreUniqueIndexes(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	require.NoError(t, store.EnsureIndexes(ctx, &models.User{}))
+	alice := createUser(t, store, "alice", time.Time{})
+
+	_, err := store.Create(ctx, &models.User{ID: primitive.NewObjectID(), Username: "alice", Email: "other@example.com"})
+	var dupErr *dal.DuplicateKeyError
+	require.True(t, errors.As(err, &dupErr))
+	assert.Equal(t, []string{"username"}, dupErr.Fields)
+
+	// deleted users don't hold on to their username
+	_, err = store.DeleteByKey(ctx, alice.ID, &models.User{})
+	require.NoError(t, err)
+	_, err = store.Create(ctx, &models.User{ID: primitive.NewObjectID(), Username: "alice", Email: "other@example.com"})
+	require.NoError(t, err)
+	_, err = store.RestoreByKey(ctx, alice.ID, &models.User{})
+	assert.True(t, errors.Is(err, dal.ErrDuplicateKey))
+}
+
+func TestMemoryStoreSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	user := createUser(t, store, "alice", time.Time{})
+	all := NewMongoDalQueryOptions(NewMongoFilter(nil), bson.D{}, 0, 0)
+
+	deleted, err := store.DeleteByKey(ctx, user.ID, &models.User{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	assert.True(t, errors.Is(store.ReadByKey(ctx, user.ID, &models.User{}), dal.ErrNotFound))
+	assert.Empty(t, readAll(t, store, ctx, all))
+	assert.Equal(t, []string{"alice"}, readAll(t, store, dal.WithIncludeDeleted(ctx), all))
+
+	restored, err := store.RestoreByKey(ctx, user.ID, &models.User{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), restored)
+	assert.NoError(t, store.ReadByKey(ctx, user.ID, &models.User{}))
+}
+
+func nextEvent(t *testing.T, events <-chan dal.ChangeEvent) dal.ChangeEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		require.True(t, ok, "change feed closed")
+		require.NoError(t, event.Err)
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for change event")
+	}
+	return dal.ChangeEvent{}
+}
+
+func TestMemoryStoreWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := NewMemoryStore()
+
+	events, err := store.Watch(ctx, &models.User{}, NewMongoFilter(bson.M{"username": "alice"}))
+	require.NoError(t, err)
+
+	createUser(t, store, "bob", time.Time{})
+	alice := createUser(t, store, "alice", time.Time{})
+	_, err = store.PurgeByKey(ctx, alice.ID, &models.User{})
+	require.NoError(t, err)
+
+	inserted := nextEvent(t, events)
+	assert.Equal(t, dal.ChangeInsert, inserted.Op)
+	assert.Equal(t, "alice", inserted.Item.(*models.User).Username)
+	purged := nextEvent(t, events)
+	assert.Equal(t, dal.ChangeDelete, purged.Op)
+	assert.Equal(t, alice.ID, purged.Key)
+
+	// A new watcher resuming after the insert only sees the delete
+	resumed, err := store.Watch(dal.WithResumeToken(ctx, inserted.ResumeToken), &models.User{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, dal.ChangeDelete, nextEvent(t, resumed).Op)
+}
+
+// badUser is stored in the users collection but doesn't decode as a User.
+type badUser struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Username  string             `bson:"username"`
+	Birthdate string             `bson:"birthdate"`
+}
+
+func (u *badUser) Namespace() string            { return "core" }
+func (u *badUser) ItemGroup() string            { return "users" }
+func (u *badUser) Marshal() ([]byte, error)     { return bson.Marshal(u) }
+func (u *badUser) Unmarshal(raw []byte) error   { return bson.Unmarshal(raw, u) }
+func (u *badUser) New() dal.Item                { return &badUser{} }
+func (u *badUser) GetKey() interface{}          { return u.ID }
+func (u *badUser) SetKey(key interface{}) error { u.ID = key.(primitive.ObjectID); return nil }
+
+func TestMemoryStoreDecodeErrorsDontStopIteration(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	bad := &badUser{ID: primitive.NewObjectID(), Username: "aaron", Birthdate: "long ago"}
+	_, err := store.Create(ctx, bad)
+	require.NoError(t, err)
+	createUser(t, store, "bob", time.Time{})
+
+	opts := NewMongoDalQueryOptions(NewMongoFilter(nil), bson.D{{Key: "username", Value: 1}}, 0, 0)
+	iter, err := store.ReadByFilter(ctx, opts, &models.User{})
+	require.NoError(t, err)
+
+	require.True(t, iter.Next(ctx))
+	var decodeErr *dal.DecodeError
+	require.True(t, errors.As(iter.Decode(&models.User{}), &decodeErr))
+	assert.Equal(t, bad.ID, decodeErr.Key)
+
+	require.True(t, iter.Next(ctx))
+	user := &models.User{}
+	require.NoError(t, iter.Decode(user))
+	assert.Equal(t, "bob", user.Username)
+	assert.False(t, iter.Next(ctx))
+	assert.NoError(t, iter.Err())
+}
@@ -3,23 +3,61 @@ package database
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"time"
 
+	"github.com/seebasoft/prompter/goback/internal/backoff"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-func MongoConnect() (*mongo.Client, error) {
+// Delays between MongoConnect's attempts: connectBackoff doubled per failed
+// attempt, up to maxConnectBackoff.
+const (
+	connectBackoff    = time.Second
+	maxConnectBackoff = 30 * time.Second
+)
+
+// MongoConnect connects to uri and pings it, so a bad connection string or
+// unreachable cluster shows up as an error at startup rather than on the first
+// request. Failed attempts are retried up to attempts times in total, each
+// bounded by timeout.
+func MongoConnect(ctx context.Context, uri string, attempts int, timeout time.Duration) (*mongo.Client, error) {
 	// Use the SetServerAPIOptions() method to set the version of the Stable API on the client
 	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
-	opts := options.Client().ApplyURI(
-		"mongodb+srv://xxxxx@promptdbaws.f7iaa.mongodb.net/" +
-			"?retryWrites=true&w=majority&appName=PromptDbAws").SetServerAPIOptions(serverAPI)
-	// Create a new client and connect to the server
-	client, err := mongo.Connect(context.TODO(), opts)
-	if err != nil {
-		panic(err)
+	opts := options.Client().ApplyURI(uri).SetServerAPIOptions(serverAPI).SetConnectTimeout(timeout)
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		var client *mongo.Client
+		if client, err = connect(ctx, opts, timeout); err == nil {
+			return client, nil
+		}
+		if attempt >= attempts {
+			break
+		}
+		slog.Warn("connecting to MongoDB failed, retrying", "attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("connecting to MongoDB: %w", ctx.Err())
+		case <-time.After(backoff.Delay(attempt, connectBackoff, maxConnectBackoff)):
+		}
 	}
+	return nil, fmt.Errorf("connecting to MongoDB after %d attempts: %w", attempts, err)
+}
 
+func connect(ctx context.Context, opts *options.ClientOptions, timeout time.Duration) (*mongo.Client, error) {
+	client, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := client.Ping(pingCtx, readpref.Primary()); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("pinging: %w", err)
+	}
 	return client, nil
 }
 
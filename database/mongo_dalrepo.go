@@ -2,8 +2,10 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	//"regexp"
+	"regexp"
+	"time"
 
 	"github.com/seebasoft/prompter/goback/dal"
 
@@ -11,6 +13,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
 )
 
 // MongoKey implements dal.Key for MongoDB.
@@ -33,6 +36,30 @@ func (f *MongoFilter) ToNative() interface{} {
 	return f.nativeFilter
 }
 
+// nativeFilter returns a filter as a bson.M, converting a bson.D. Filters of
+// any other type are an error rather than matching everything.
+func nativeFilter(filter dal.Filter) (bson.M, error) {
+	if filter == nil {
+		return nil, nil
+	}
+	switch native := filter.ToNative().(type) {
+	case nil:
+		return nil, nil
+	case bson.M:
+		return native, nil
+	case map[string]interface{}:
+		return bson.M(native), nil
+	case bson.D:
+		result := make(bson.M, len(native))
+		for _, e := range native {
+			result[e.Key] = e.Value
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("unsupported filter type %T", native)
+	}
+}
+
 // MongoDalQueryOptions
 type MongoDalQueryOptions struct {
 	filter dal.Filter
@@ -68,33 +95,36 @@ func NewMongoDalQueryOptions(filter dal.Filter, sort interface{}, limit int64, s
 
 type mongoItemIterator[T any] struct {
 	cursor *mongo.Cursor
-	err    error
 }
 
 func (m *mongoItemIterator[T]) Next(ctx context.Context) bool {
-	if m.err != nil {
-		return false // Return false if there's a previous error
-	}
 	return m.cursor.Next(ctx)
 }
 
+// Decode failures concern a single document; they don't end the iteration.
 func (m *mongoItemIterator[T]) Decode(item T) error {
-	if m.err != nil {
-		return m.err
+	if err := m.cursor.Decode(item); err != nil {
+		return newDecodeError(m.cursor.Current, err)
 	}
-	m.err = m.cursor.Decode(item)
-	return m.err
+	return nil
 }
 
 func (m *mongoItemIterator[T]) Close(ctx context.Context) error {
-	if m.cursor != nil {
-		return m.cursor.Close(ctx)
-	}
-	return nil
+	return m.cursor.Close(ctx)
 }
 
 func (m *mongoItemIterator[T]) Err() error {
-	return m.err
+	return classifyError(m.cursor.Err())
+}
+
+// newDecodeError wraps a decode failure with the key of the offending
+// document.
+func newDecodeError(raw bson.Raw, err error) error {
+	var key interface{}
+	if value, lookupErr := raw.LookupErr("_id"); lookupErr == nil {
+		value.Unmarshal(&key)
+	}
+	return &dal.DecodeError{Key: key, Err: err}
 }
 
 type MongoStore struct {
@@ -110,28 +140,69 @@ func (r *MongoStore) Create(ctx context.Context, item dal.Item) (dal.Item, error
 	collection := r.client.Database(item.Namespace()).Collection(item.ItemGroup())
 	result, err := collection.InsertOne(ctx, item)
 	if err != nil {
-		return nil, fmt.Errorf("creating entity: %w", err)
+		return nil, fmt.Errorf("creating entity: %w", mapWriteError(err, item))
 	}
 
-	insertedID := result.InsertedID.(primitive.ObjectID)
-	item.SetKey(insertedID)
+	// Keys other than ObjectIDs are set by the caller; the driver only
+	// generates ObjectIDs
+	if insertedID, ok := result.InsertedID.(primitive.ObjectID); ok {
+		item.SetKey(insertedID)
+	}
 	return item, nil
 }
 
 func (r *MongoStore) ReadByKey(ctx context.Context, key interface{}, item dal.Item) error {
 	collection := r.client.Database(item.Namespace()).Collection(item.ItemGroup())
-	filter := bson.M{"_id": key}
+	filter := excludeDeleted(ctx, item, bson.M{"_id": key})
 	var raw bson.Raw
 
 	err := collection.FindOne(ctx, filter).Decode(&raw)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("getting entity by ID: %w", dal.ErrNotFound)
+	}
 	if err != nil {
-		return fmt.Errorf("getting entity by ID: %w", err)
+		return fmt.Errorf("getting entity by ID: %w", classifyError(err))
 	}
 
-	item.Unmarshal(raw)
+	if err := item.Unmarshal(raw); err != nil {
+		return fmt.Errorf("decoding entity: %w", err)
+	}
 	return nil
 }
 
+// ReadByKeys reads all keys with a single $in query.
+func (r *MongoStore) ReadByKeys(ctx context.Context, keys []interface{}, itemType dal.Item) ([]dal.Item, error) {
+	items := make([]dal.Item, len(keys))
+	if len(keys) == 0 {
+		return items, nil
+	}
+	positions := make(map[string][]int, len(keys))
+	for i, key := range keys {
+		positions[fmt.Sprint(key)] = append(positions[fmt.Sprint(key)], i)
+	}
+
+	collection := r.client.Database(itemType.Namespace()).Collection(itemType.ItemGroup())
+	filter := excludeDeleted(ctx, itemType, bson.M{"_id": bson.M{"$in": keys}})
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("getting entities by ID: %w", classifyError(err))
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		item := itemType.New()
+		if err := item.Unmarshal(cursor.Current); err != nil {
+			return nil, fmt.Errorf("decoding entity: %w", err)
+		}
+		for _, i := range positions[fmt.Sprint(item.GetKey())] {
+			items[i] = item
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("getting entities by ID: %w", classifyError(err))
+	}
+	return items, nil
+}
+
 func (r *MongoStore) ReadByFilter(ctx context.Context, opts dal.QueryOptions, itemType dal.Item) (dal.ItemIterator, error) {
 	findOptions := options.Find()
 	
@@ -147,30 +218,253 @@ func (r *MongoStore) ReadByFilter(ctx context.Context, opts dal.QueryOptions, it
 	}
 
 	collection := r.client.Database(itemType.Namespace()).Collection(itemType.ItemGroup())
-	cursor, err := collection.Find(ctx, opts.GetFilter().ToNative(), findOptions)
+	filter, err := nativeFilter(opts.GetFilter())
 	if err != nil {
 		return nil, fmt.Errorf("finding by filter: %w", err)
 	}
+	cursor, err := collection.Find(ctx, excludeDeleted(ctx, itemType, filter), findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("finding by filter: %w", classifyError(err))
+	}
 
 	return &mongoItemIterator[dal.Item]{cursor: cursor}, nil
 }
 
+// Claim implements dal.Claimer with FindOneAndUpdate.
+func (r *MongoStore) Claim(ctx context.Context, opts dal.QueryOptions, fields map[string]interface{}, item dal.Item) error {
+	updateOptions := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if sortMap, ok := opts.GetSort().(bson.D); ok && len(sortMap) > 0 {
+		updateOptions.SetSort(sortMap)
+	}
+	filter, err := nativeFilter(opts.GetFilter())
+	if err != nil {
+		return fmt.Errorf("claiming entity: %w", err)
+	}
+
+	collection := r.client.Database(item.Namespace()).Collection(item.ItemGroup())
+	var raw bson.Raw
+	err = collection.FindOneAndUpdate(ctx, excludeDeleted(ctx, item, filter), bson.M{"$set": fields}, updateOptions).Decode(&raw)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("claiming entity: %w", dal.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("claiming entity: %w", mapWriteError(err, item))
+	}
+	if err := item.Unmarshal(raw); err != nil {
+		return fmt.Errorf("decoding entity: %w", err)
+	}
+	return nil
+}
+
 func (r *MongoStore) UpdateByKey(ctx context.Context, key interface{}, update dal.Item) (int64, error) {
 	collection := r.client.Database(update.Namespace()).Collection(update.ItemGroup())
 	filter := bson.M{"_id": key}
+	if dal.IsSoftDeletable(update) {
+		// Soft deleted items have to be restored before they can be updated
+		filter[dal.DeletedAtField] = nil
+	}
 	updateResult, err := collection.ReplaceOne(ctx, filter, update)
 	if err != nil {
-		return 0, fmt.Errorf("updating entity: %w", err)
+		return 0, fmt.Errorf("updating entity: %w", mapWriteError(err, update))
+	}
+	if updateResult.MatchedCount == 0 {
+		return 0, fmt.Errorf("updating entity: %w", dal.ErrNotFound)
 	}
 	return updateResult.ModifiedCount, nil
 }
 
 func (r *MongoStore) DeleteByKey(ctx context.Context, key interface{}, itemType dal.Item) (int64, error) {
+	if !dal.IsSoftDeletable(itemType) {
+		return r.PurgeByKey(ctx, key, itemType)
+	}
+
+	collection := r.client.Database(itemType.Namespace()).Collection(itemType.ItemGroup())
+	filter := bson.M{"_id": key, dal.DeletedAtField: nil}
+	update := bson.M{"$set": bson.M{dal.DeletedAtField: time.Now().UTC()}}
+	updateResult, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("soft deleting entity: %w", classifyError(err))
+	}
+	return updateResult.ModifiedCount, nil
+}
+
+func (r *MongoStore) RestoreByKey(ctx context.Context, key interface{}, itemType dal.Item) (int64, error) {
+	if !dal.IsSoftDeletable(itemType) {
+		return 0, dal.ErrNotSoftDeletable
+	}
+
+	collection := r.client.Database(itemType.Namespace()).Collection(itemType.ItemGroup())
+	filter := bson.M{"_id": key, dal.DeletedAtField: bson.M{"$ne": nil}}
+	update := bson.M{"$unset": bson.M{dal.DeletedAtField: ""}}
+	updateResult, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("restoring entity: %w", mapWriteError(err, itemType))
+	}
+	return updateResult.ModifiedCount, nil
+}
+
+func (r *MongoStore) PurgeByKey(ctx context.Context, key interface{}, itemType dal.Item) (int64, error) {
 	collection := r.client.Database(itemType.Namespace()).Collection(itemType.ItemGroup())
 	filter := bson.M{"_id": key}
 	deleteResult, err := collection.DeleteOne(ctx, filter)
 	if err != nil {
-		return 0, fmt.Errorf("deleting entity: %w", err)
+		return 0, fmt.Errorf("deleting entity: %w", classifyError(err))
 	}
 	return deleteResult.DeletedCount, nil
 }
+
+// excludeDeleted adds a "not deleted" condition to filter for SoftDeletable
+// items, unless the context asks for deleted items too. A missing and a null
+// deletedAt both match {deletedAt: null}.
+func excludeDeleted(ctx context.Context, itemType dal.Item, filter bson.M) bson.M {
+	if !dal.IsSoftDeletable(itemType) || dal.IncludeDeleted(ctx) {
+		return filter
+	}
+	notDeleted := bson.M{dal.DeletedAtField: nil}
+	if len(filter) == 0 {
+		return notDeleted
+	}
+	if _, ok := filter[dal.DeletedAtField]; ok {
+		return bson.M{"$and": []bson.M{filter, notDeleted}}
+	}
+
+	result := make(bson.M, len(filter)+1)
+	for k, v := range filter {
+		result[k] = v
+	}
+	result[dal.DeletedAtField] = nil
+	return result
+}
+
+// EnsureIndexes creates the indexes declared by each Indexed item and drops
+// their retired ones. Creating an index that already exists with the same
+// definition is a no-op in MongoDB.
+func (r *MongoStore) EnsureIndexes(ctx context.Context, items ...dal.Item) error {
+	for _, item := range items {
+		indexed, ok := item.(dal.Indexed)
+		if !ok {
+			continue
+		}
+		if err := r.dropRetiredIndexes(ctx, item); err != nil {
+			return err
+		}
+
+		models := make([]mongo.IndexModel, 0, len(indexed.Indexes()))
+		for _, idx := range indexed.Indexes() {
+			models = append(models, toIndexModel(idx))
+		}
+		if len(models) == 0 {
+			continue
+		}
+
+		collection := r.client.Database(item.Namespace()).Collection(item.ItemGroup())
+		if _, err := collection.Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("creating indexes for %s.%s: %w", item.Namespace(), item.ItemGroup(), classifyError(err))
+		}
+	}
+	return nil
+}
+
+// Error codes of dropping an index that, or whose collection, doesn't exist.
+const (
+	namespaceNotFoundCode = 26
+	indexNotFoundCode     = 27
+)
+
+func (r *MongoStore) dropRetiredIndexes(ctx context.Context, item dal.Item) error {
+	retired, ok := item.(dal.RetiredIndexes)
+	if !ok {
+		return nil
+	}
+	collection := r.client.Database(item.Namespace()).Collection(item.ItemGroup())
+	for _, name := range retired.RetiredIndexes() {
+		_, err := collection.Indexes().DropOne(ctx, name)
+		var cmdErr mongo.CommandError
+		if errors.As(err, &cmdErr) && (cmdErr.Code == indexNotFoundCode || cmdErr.Code == namespaceNotFoundCode) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("dropping index %s of %s.%s: %w", name, item.Namespace(), item.ItemGroup(), classifyError(err))
+		}
+	}
+	return nil
+}
+
+func toIndexModel(idx dal.Index) mongo.IndexModel {
+	keys := bson.D{}
+	for _, f := range idx.Fields {
+		var order interface{} = int(f.Order)
+		if f.Order == dal.TextSearch {
+			order = "text"
+		}
+		keys = append(keys, bson.E{Key: f.Field, Value: order})
+	}
+
+	opts := options.Index().SetName(idx.IndexName())
+	if idx.Unique {
+		opts.SetUnique(true)
+	}
+	if idx.Sparse {
+		opts.SetSparse(true)
+	}
+	if idx.ExpireAfter > 0 {
+		opts.SetExpireAfterSeconds(int32(idx.ExpireAfter.Seconds()))
+	}
+	return mongo.IndexModel{Keys: keys, Options: opts}
+}
+
+// E11000 duplicate key error collection: core.users index: email_1_deletedAt_1 dup key: { email: "a@b.c" }
+var duplicateIndexPattern = regexp.MustCompile(`index: (\S+) dup key`)
+
+// mapWriteError converts driver duplicate key errors to dal.ErrDuplicateKey
+// so callers don't need to know about Mongo error codes.
+func mapWriteError(err error, item dal.Item) error {
+	if !mongo.IsDuplicateKeyError(err) {
+		return classifyError(err)
+	}
+	indexName := ""
+	if m := duplicateIndexPattern.FindStringSubmatch(err.Error()); m != nil {
+		indexName = m[1]
+	}
+	return dal.NewDuplicateKeyError(item, indexName)
+}
+
+// classifyError marks errors worth retrying. dal.ErrRetryable means nothing
+// was written: no server could be selected or the transaction was aborted.
+// dal.ErrTransient means a write may have been applied: network errors,
+// timeouts and writes the driver already retried without success.
+func classifyError(err error) error {
+	var labeled mongo.LabeledError
+	var selection topology.ServerSelectionError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &selection),
+		errors.As(err, &labeled) && labeled.HasErrorLabel("TransientTransactionError"):
+		return fmt.Errorf("%w: %w", dal.ErrRetryable, err)
+	case errors.As(err, &labeled) && labeled.HasErrorLabel("RetryableWriteError"),
+		mongo.IsNetworkError(err) || mongo.IsTimeout(err):
+		return fmt.Errorf("%w: %w", dal.ErrTransient, err)
+	}
+	return err
+}
+
+// WithTransaction runs fn in a MongoDB transaction. The session travels in the
+// context fn receives, so Store calls made with it join the transaction.
+// Transactions need a replica set, which Atlas always provides.
+func (r *MongoStore) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx) // already in a transaction
+	}
+
+	session, err := r.client.StartSession()
+	if err != nil {
+		return fmt.Errorf("starting session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+func TestMapWriteErrorDuplicateKey(t *testing.T) {
+	writeErr := mongo.WriteException{WriteErrors: []mongo.WriteError{{
+		Code:    11000,
+		Message: `E11000 duplicate key error collection: core.users index: email_1_deletedAt_1 dup key: { email: "a@b.c" }`,
+	}}}
+
+	err := mapWriteError(writeErr, &models.User{})
+	assert.True(t, errors.Is(err, dal.ErrDuplicateKey))
+
+	var dupErr *dal.DuplicateKeyError
+	require.True(t, errors.As(err, &dupErr))
+	assert.Equal(t, "email_1_deletedAt_1", dupErr.Index)
+	assert.Equal(t, []string{"email"}, dupErr.Fields)
+}
+
+func TestUserIndexModels(t *testing.T) {
+	user := &models.User{}
+	for i, field := range []string{"username", "email"} {
+		model := toIndexModel(user.Indexes()[i])
+		assert.Equal(t, bson.D{{Key: field, Value: 1}, {Key: dal.DeletedAtField, Value: 1}}, model.Keys)
+		assert.Equal(t, field+"_1_deletedAt_1", *model.Options.Name)
+		assert.True(t, *model.Options.Unique)
+		assert.Nil(t, model.Options.PartialFilterExpression, "MongoDB rejects $exists: false in partial indexes")
+		assert.Contains(t, user.RetiredIndexes(), field+"_1")
+	}
+
+	// deletedAt isn't reported as a conflicting field
+	assert.Equal(t, []string{"email"}, dal.NewDuplicateKeyError(user, "email_1_deletedAt_1").Fields)
+}
+
+func TestMapWriteErrorPassesThroughOtherErrors(t *testing.T) {
+	other := errors.New("boom")
+	assert.Equal(t, other, mapWriteError(other, &models.User{}))
+}
+
+func TestExcludeDeleted(t *testing.T) {
+	ctx := context.Background()
+	user := &models.User{}
+
+	assert.Equal(t, bson.M{"deletedAt": nil}, excludeDeleted(ctx, user, nil))
+	assert.Equal(t, bson.M{"username": "jdoe", "deletedAt": nil}, excludeDeleted(ctx, user, bson.M{"username": "jdoe"}))
+
+	withDeleted := bson.M{"deletedAt": bson.M{"$gt": "x"}}
+	assert.Equal(t, bson.M{"$and": []bson.M{withDeleted, {"deletedAt": nil}}}, excludeDeleted(ctx, user, withDeleted))
+
+	assert.Equal(t, bson.M{"username": "jdoe"}, excludeDeleted(dal.WithIncludeDeleted(ctx), user, bson.M{"username": "jdoe"}))
+	assert.Equal(t, bson.M{"title": "x"}, excludeDeleted(ctx, &dal.MockItem{}, bson.M{"title": "x"}))
+}
+
+func TestClassifyError(t *testing.T) {
+	aborted := mongo.CommandError{Code: 251, Labels: []string{"TransientTransactionError"}}
+	assert.True(t, errors.Is(classifyError(aborted), dal.ErrRetryable))
+	unselected := topology.ServerSelectionError{Wrapped: context.DeadlineExceeded}
+	assert.True(t, errors.Is(classifyError(unselected), dal.ErrRetryable))
+
+	// the write may have been applied before the connection dropped
+	retried := mongo.CommandError{Code: 91, Labels: []string{"RetryableWriteError"}}
+	assert.True(t, errors.Is(classifyError(retried), dal.ErrTransient))
+	assert.False(t, errors.Is(classifyError(retried), dal.ErrRetryable))
+	network := mongo.CommandError{Labels: []string{"NetworkError"}}
+	assert.True(t, errors.Is(classifyError(network), dal.ErrTransient))
+
+	other := errors.New("boom")
+	assert.Equal(t, other, classifyError(other))
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/dal"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// historySuffix is appended to an item group to name its history collection.
+const historySuffix = "_history"
+
+// appendAttempts bounds retries when two writers race for a revision number.
+const appendAttempts = 3
+
+type revisionDocument struct {
+	Key    interface{} `bson:"key"`
+	Number int64       `bson:"revision"`
+	Op     string      `bson:"op"`
+	Actor  string      `bson:"actor,omitempty"`
+	At     time.Time   `bson:"at"`
+	Data   bson.Raw    `bson:"data"`
+}
+
+func (d revisionDocument) toRevision() dal.Revision {
+	return dal.Revision{Key: d.Key, Number: d.Number, Op: d.Op, Actor: d.Actor, At: d.At, Data: d.Data}
+}
+
+// MongoHistory implements dal.HistoryLog with one "<group>_history"
+// collection per item group.
+type MongoHistory struct {
+	client *mongo.Client
+}
+
+func NewMongoHistory(client *mongo.Client) *MongoHistory {
+	return &MongoHistory{client: client}
+}
+
+func (h *MongoHistory) collection(itemType dal.Item) *mongo.Collection {
+	return h.client.Database(itemType.Namespace()).Collection(itemType.ItemGroup() + historySuffix)
+}
+
+// EnsureIndexes creates the unique (key, revision) index on the history
+// collections of the given item types. It is what makes revision numbers safe
+// under concurrent writers.
+func (h *MongoHistory) EnsureIndexes(ctx context.Context, items ...dal.Item) error {
+	for _, item := range items {
+		model := mongo.IndexModel{
+			Keys:    bson.D{{Key: "key", Value: 1}, {Key: "revision", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("key_1_revision_1"),
+		}
+		if _, err := h.collection(item).Indexes().CreateOne(ctx, model); err != nil {
+			return fmt.Errorf("creating history index for %s: %w", item.ItemGroup(), err)
+		}
+	}
+	return nil
+}
+
+// Append numbers rev after the latest revision of its key. Outside a
+// transaction it retries when a concurrent writer took the number first.
+// Inside one it can't: the duplicate key has already aborted the
+// transaction, so the error is returned as retryable for the whole
+// transaction to run again.
+func (h *MongoHistory) Append(ctx context.Context, itemType dal.Item, rev *dal.Revision) error {
+	collection := h.collection(itemType)
+	attempts := appendAttempts
+	if mongo.SessionFromContext(ctx) != nil {
+		attempts = 1
+	}
+	for attempt := 0; attempt < attempts; attempt++ {
+		latest, err := h.latest(ctx, collection, bson.M{"key": rev.Key})
+		if err != nil && !errors.Is(err, dal.ErrRevisionNotFound) {
+			return err
+		}
+		rev.Number = 1
+		if latest != nil {
+			rev.Number = latest.Number + 1
+		}
+
+		doc := revisionDocument{Key: rev.Key, Number: rev.Number, Op: rev.Op, Actor: rev.Actor, At: rev.At, Data: rev.Data}
+		_, err = collection.InsertOne(ctx, doc)
+		if mongo.IsDuplicateKeyError(err) {
+			continue // someone else took this number, try the next one
+		}
+		if err != nil {
+			return fmt.Errorf("appending revision: %w", classifyError(err))
+		}
+		return nil
+	}
+	return fmt.Errorf("appending revision %d: %w: another writer took it", rev.Number, dal.ErrRetryable)
+}
+
+func (h *MongoHistory) List(ctx context.Context, key interface{}, itemType dal.Item) ([]dal.Revision, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "revision", Value: 1}})
+	cursor, err := h.collection(itemType).Find(ctx, bson.M{"key": key}, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("listing revisions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	revisions := make([]dal.Revision, 0)
+	for cursor.Next(ctx) {
+		var doc revisionDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("decoding revision: %w", err)
+		}
+		revisions = append(revisions, doc.toRevision())
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("listing revisions: %w", err)
+	}
+	return revisions, nil
+}
+
+func (h *MongoHistory) Get(ctx context.Context, key interface{}, number int64, itemType dal.Item) (*dal.Revision, error) {
+	var doc revisionDocument
+	err := h.collection(itemType).FindOne(ctx, bson.M{"key": key, "revision": number}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, dal.ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting revision: %w", err)
+	}
+	rev := doc.toRevision()
+	return &rev, nil
+}
+
+func (h *MongoHistory) AsOf(ctx context.Context, key interface{}, at time.Time, itemType dal.Item) (*dal.Revision, error) {
+	return h.latest(ctx, h.collection(itemType), bson.M{"key": key, "at": bson.M{"$lte": at}})
+}
+
+func (h *MongoHistory) latest(ctx context.Context, collection *mongo.Collection, filter bson.M) (*dal.Revision, error) {
+	findOptions := options.FindOne().SetSort(bson.D{{Key: "revision", Value: -1}})
+	var doc revisionDocument
+	err := collection.FindOne(ctx, filter, findOptions).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, dal.ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("finding revision: %w", err)
+	}
+	rev := doc.toRevision()
+	return &rev, nil
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/dal"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// watchBuffer is how many events may be waiting for a slow consumer before
+// the change stream stops being read.
+const watchBuffer = 64
+
+type changeStreamDocument struct {
+	OperationType            string              `bson:"operationType"`
+	DocumentKey              bson.M              `bson:"documentKey"`
+	FullDocument             bson.Raw            `bson:"fullDocument"`
+	FullDocumentBeforeChange bson.Raw            `bson:"fullDocumentBeforeChange"`
+	ClusterTime              primitive.Timestamp `bson:"clusterTime"`
+}
+
+// Watch streams changes using a MongoDB change stream. Deletes carry the
+// pre-image when the collection has changeStreamPreAndPostImages enabled.
+func (r *MongoStore) Watch(ctx context.Context, itemType dal.Item, filter dal.Filter) (<-chan dal.ChangeEvent, error) {
+	native, err := nativeFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("watching %s: %w", itemType.ItemGroup(), err)
+	}
+
+	opts := options.ChangeStream().
+		SetFullDocument(options.UpdateLookup).
+		SetFullDocumentBeforeChange(options.WhenAvailable)
+	if token := dal.ResumeTokenFrom(ctx); token != nil {
+		opts.SetResumeAfter(bson.Raw(token))
+	}
+
+	collection := r.client.Database(itemType.Namespace()).Collection(itemType.ItemGroup())
+	stream, err := collection.Watch(ctx, changeStreamPipeline(native), opts)
+	if err != nil {
+		return nil, fmt.Errorf("watching %s: %w", itemType.ItemGroup(), err)
+	}
+
+	events := make(chan dal.ChangeEvent, watchBuffer)
+	send := func(event dal.ChangeEvent) bool {
+		select {
+		case events <- event:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	go func() {
+		defer close(events)
+		defer stream.Close(context.Background())
+
+		for stream.Next(ctx) {
+			var doc changeStreamDocument
+			if err := stream.Decode(&doc); err != nil {
+				send(dal.ChangeEvent{Err: fmt.Errorf("decoding change event: %w", err)})
+				return
+			}
+			event, err := toChangeEvent(doc, itemType)
+			if err != nil {
+				send(dal.ChangeEvent{Err: err})
+				return
+			}
+			event.ResumeToken = []byte(stream.ResumeToken())
+			if !send(event) {
+				return
+			}
+		}
+		if err := stream.Err(); err != nil && ctx.Err() == nil {
+			send(dal.ChangeEvent{Err: fmt.Errorf("watching %s: %w", itemType.ItemGroup(), err)})
+		}
+	}()
+	return events, nil
+}
+
+// changeStreamPipeline limits the stream to item changes matching filter.
+// Filters address item fields, which live under fullDocument in change
+// events; deletes have no fullDocument and are always passed on.
+func changeStreamPipeline(filter bson.M) mongo.Pipeline {
+	ops := bson.M{"operationType": bson.M{"$in": bson.A{"insert", "update", "replace", "delete"}}}
+	if len(filter) == 0 {
+		return mongo.Pipeline{{{Key: "$match", Value: ops}}}
+	}
+	match := bson.M{"$and": bson.A{
+		ops,
+		bson.M{"$or": bson.A{
+			bson.M{"operationType": "delete"},
+			prefixFields(filter, "fullDocument."),
+		}},
+	}}
+	return mongo.Pipeline{{{Key: "$match", Value: match}}}
+}
+
+// prefixFields rewrites the field names of a filter, descending into
+// $and/$or/$nor clauses.
+func prefixFields(filter bson.M, prefix string) bson.M {
+	result := make(bson.M, len(filter))
+	for k, v := range filter {
+		if !strings.HasPrefix(k, "$") {
+			result[prefix+k] = v
+			continue
+		}
+		clauses, ok := v.([]bson.M)
+		if !ok {
+			result[k] = v
+			continue
+		}
+		prefixed := make([]bson.M, 0, len(clauses))
+		for _, clause := range clauses {
+			prefixed = append(prefixed, prefixFields(clause, prefix))
+		}
+		result[k] = prefixed
+	}
+	return result
+}
+
+func toChangeEvent(doc changeStreamDocument, itemType dal.Item) (dal.ChangeEvent, error) {
+	event := dal.ChangeEvent{
+		Op:        dal.ChangeOp(doc.OperationType),
+		Namespace: itemType.Namespace(),
+		ItemGroup: itemType.ItemGroup(),
+		Key:       doc.DocumentKey["_id"],
+		At:        time.Unix(int64(doc.ClusterTime.T), 0).UTC(),
+	}
+
+	raw := doc.FullDocument
+	if event.Op == dal.ChangeDelete {
+		raw = doc.FullDocumentBeforeChange
+	}
+	if len(raw) > 0 {
+		item := itemType.New()
+		if err := bson.Unmarshal(raw, item); err != nil {
+			return event, fmt.Errorf("decoding changed item: %w", err)
+		}
+		event.Item = item
+	}
+	return event, nil
+}
@@ -0,0 +1,246 @@
+// Package filter turns list query parameters into Mongo filters. The REST and
+// GraphQL APIs share it so "username_startswith=j" means the same on both.
+//
+// A parameter is a field's JSON name, optionally followed by "_" and an
+// operator: "birthdate_after=2000-01-01T00:00:00Z". A bare name means "eq".
+// Values of time fields are RFC 3339 dates and values of float fields are
+// numbers; everything else is compared as a string.
+package filter
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Hidden reports whether clients may not filter on the field with this JSON
+// name, e.g. because they can't read it: registry.Resource.IsWriteOnly. A nil
+// Hidden hides nothing.
+type Hidden func(jsonName string) bool
+
+func (h Hidden) hides(jsonName string) bool {
+	return h != nil && h(jsonName)
+}
+
+// Param is a filter parameter the package understands.
+type Param struct {
+	Name     string // e.g. "birthdate_gte"; a bare field name means "eq"
+	Field    reflect.StructField
+	Operator string // e.g. "gte"
+}
+
+// Params lists the filter parameters of item's fields that aren't hidden, each
+// field's bare name first. Every operator is accepted on every field; the ones
+// listed are those that make sense for the field's type.
+func Params(item dal.Item, hidden Hidden) []Param {
+	entityType, err := structType(item)
+	if err != nil {
+		return nil
+	}
+	var params []Param
+	for i := 0; i < entityType.NumField(); i++ {
+		field := entityType.Field(i)
+		shouldSkip, jsonName, _ := tagNames(field)
+		if shouldSkip || hidden.hides(jsonName) {
+			continue
+		}
+		params = append(params, Param{Name: jsonName, Field: field, Operator: "eq"})
+		for _, op := range Operators(field.Type) {
+			params = append(params, Param{Name: jsonName + "_" + op, Field: field, Operator: op})
+		}
+	}
+	return params
+}
+
+// Operators returns the operators documented for fields of type t.
+func Operators(t reflect.Type) []string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return []string{"eq", "ne", "gt", "gte", "lt", "lte", "after", "before", "between"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return []string{"eq", "ne", "gt", "gte", "lt", "lte"}
+	default:
+		return []string{"eq", "ne", "gt", "gte", "lt", "lte", "contains", "startswith", "endswith"}
+	}
+}
+
+// Parse builds the Mongo filter for the parameters in query that name one of
+// item's fields; others, such as "sort", are ignored. Conditions on the same
+// field are merged into one operator document, e.g. {"$gte": a, "$lt": b}.
+// Invalid values and parameters naming hidden
+// fields are reported as a *dal.FilterError.
+func Parse(item dal.Item, query url.Values, hidden Hidden) (bson.M, error) {
+	entityType, err := structType(item)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{}
+	for fieldName := 0; fieldName < entityType.NumField(); fieldName++ {
+		field := entityType.Field(fieldName)
+		shouldSkip, jsonName, bsonName := tagNames(field)
+		if shouldSkip {
+			continue
+		}
+
+		for param, values := range query {
+			if len(values) == 0 || strings.Split(param, "_")[0] != jsonName {
+				continue
+			}
+			if hidden.hides(jsonName) {
+				return nil, &dal.FilterError{Param: param, Value: values[0], Reason: "field can't be filtered on"}
+			}
+
+			subFilter, err := paramToSubFilter(field, param, jsonName, values[0])
+			if err != nil {
+				return nil, err
+			}
+
+			addCondition(filter, bsonName, subFilter)
+		}
+	}
+	return filter, nil
+}
+
+// addCondition merges the operators of cond into the field's operator
+// document. Conditions using an operator the field already has, such as
+// "contains" and "startswith" (both $regex), go into a top-level $and
+// instead.
+func addCondition(filter bson.M, field string, cond bson.M) {
+	existing, ok := filter[field].(bson.M)
+	if !ok {
+		filter[field] = cond
+		return
+	}
+	for op := range cond {
+		if _, clash := existing[op]; clash {
+			clauses, _ := filter["$and"].([]bson.M)
+			filter["$and"] = append(clauses, bson.M{field: cond})
+			return
+		}
+	}
+	for op, value := range cond {
+		existing[op] = value
+	}
+}
+
+// Sort builds a Mongo sort from field names, each prefixed with "-" to sort
+// descending.
+//
+// Example:
+// Given the sort fields ["-birthdate", "username"]
+// The function will return a bson.D equivalent to: bson.D{{Key: "birthdate", Value: -1}, {Key: "username", Value: 1}}
+func Sort(fields []string) bson.D {
+	sortOptions := bson.D{}
+	for _, field := range fields {
+		order := 1
+		if strings.HasPrefix(field, "-") {
+			order = -1
+			field = strings.TrimPrefix(field, "-")
+		}
+		sortOptions = append(sortOptions, bson.E{Key: field, Value: order})
+	}
+	return sortOptions
+}
+
+func structType(item dal.Item) (reflect.Type, error) {
+	entityType := reflect.TypeOf(item)
+	if entityType.Kind() == reflect.Ptr {
+		entityType = entityType.Elem()
+	}
+	if entityType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("item must be a struct or pointer to struct")
+	}
+	return entityType, nil
+}
+
+func tagNames(field reflect.StructField) (shouldSkip bool, jsonName string, bsonName string) {
+	jsonTag := field.Tag.Get("json")
+	bsonTag := field.Tag.Get("bson")
+	if jsonTag == "" || bsonTag == "" {
+		return true, "", ""
+	}
+	jsonName = strings.Split(jsonTag, ",")[0]
+	bsonName = strings.Split(bsonTag, ",")[0]
+	return false, jsonName, bsonName
+}
+
+func paramToSubFilter(field reflect.StructField, param string, jsonName string, strval string) (bson.M, error) {
+	// adjust a param without an underscore to have an "_eq" suffix
+	if param == jsonName {
+		param = jsonName + "_eq"
+	}
+
+	fieldType := field.Type
+	if fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+
+	op := strings.TrimPrefix(param, jsonName+"_")
+
+	var value interface{} = strval
+	if fieldType == reflect.TypeOf(time.Time{}) && op != "between" { // between's two dates are parsed below
+		t, err := time.Parse(time.RFC3339, strval)
+		if err != nil {
+			return nil, &dal.FilterError{Param: param, Value: strval, Reason: "must be an RFC 3339 date", Err: err}
+		}
+		value = t
+	} else if fieldType.Kind() == reflect.Float32 || fieldType.Kind() == reflect.Float64 {
+		f, err := strconv.ParseFloat(strval, 64)
+		if err != nil {
+			return nil, &dal.FilterError{Param: param, Value: strval, Reason: "must be a number", Err: err}
+		}
+		value = f
+	}
+
+	subFilter := bson.M{}
+	switch op {
+	case "eq":
+		subFilter["$eq"] = value
+	case "ne":
+		subFilter["$ne"] = value
+	case "gt", "after":
+		subFilter["$gt"] = value
+	case "gte":
+		subFilter["$gte"] = value
+	case "lt", "before":
+		subFilter["$lt"] = value
+	case "lte":
+		subFilter["$lte"] = value
+	case "contains":
+		subFilter["$regex"] = primitive.Regex{Pattern: regexp.QuoteMeta(strval), Options: "i"}
+	case "startswith":
+		subFilter["$regex"] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(strval), Options: "i"}
+	case "endswith":
+		subFilter["$regex"] = primitive.Regex{Pattern: regexp.QuoteMeta(strval) + "$", Options: "i"}
+	case "between":
+		parts := strings.Split(strval, ",")
+		if len(parts) != 2 {
+			return nil, &dal.FilterError{Param: param, Value: strval, Reason: "must be two comma separated dates"}
+		}
+		start, err := time.Parse(time.RFC3339, strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, &dal.FilterError{Param: param, Value: strval, Reason: "start must be an RFC 3339 date", Err: err}
+		}
+		end, err := time.Parse(time.RFC3339, strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, &dal.FilterError{Param: param, Value: strval, Reason: "end must be an RFC 3339 date", Err: err}
+		}
+		subFilter["$gte"] = start
+		subFilter["$lte"] = end
+	default:
+		return nil, &dal.FilterError{Param: param, Value: strval, Reason: fmt.Sprintf("unknown operator %q", op)}
+	}
+	return subFilter, nil
+}
@@ -0,0 +1,53 @@
+package filter_test
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/filter"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParse(t *testing.T) {
+	query, err := url.ParseQuery("username=jdoe&birthdate_between=2000-01-01T00:00:00Z,2001-01-01T00:00:00Z&birthdate_ne=2000-06-01T00:00:00Z&sort=-username")
+	require.NoError(t, err)
+	got, err := filter.Parse(&models.User{}, query, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, bson.M{"$eq": "jdoe"}, got["username"])
+	assert.Equal(t, bson.M{
+		"$gte": time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		"$lte": time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC),
+		"$ne":  time.Date(2000, 6, 1, 0, 0, 0, 0, time.UTC),
+	}, got["birthdate"])
+	assert.Len(t, got, 2)
+
+	// both are $regex, so the second can't share the field's document
+	got, err = filter.Parse(&models.User{}, url.Values{"username_startswith": {"j"}, "username_endswith": {"e"}}, nil)
+	require.NoError(t, err)
+	assert.Len(t, got["$and"], 1)
+	assert.Contains(t, got, "username")
+
+	_, err = filter.Parse(&models.User{}, url.Values{"username_near": {"x"}}, nil)
+	var filterErr *dal.FilterError
+	require.True(t, errors.As(err, &filterErr))
+	assert.Equal(t, "username_near", filterErr.Param)
+}
+
+func TestParseRejectsHiddenFields(t *testing.T) {
+	hidden := func(jsonName string) bool { return jsonName == "secret" }
+	_, err := filter.Parse(&models.Webhook{}, url.Values{"secret_startswith": {"a"}}, hidden)
+	var filterErr *dal.FilterError
+	require.True(t, errors.As(err, &filterErr))
+	assert.Equal(t, "secret_startswith", filterErr.Param)
+
+	for _, param := range filter.Params(&models.Webhook{}, hidden) {
+		assert.NotContains(t, param.Name, "secret")
+	}
+}
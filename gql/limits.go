@@ -0,0 +1,206 @@
+package gql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Limits bound what a single request may cost. Zero values disable a limit.
+type Limits struct {
+	// MaxDepth is the deepest field nesting allowed, root fields being 1.
+	MaxDepth int
+	// MaxComplexity is the most fields a request may resolve. Every field
+	// counts 1, and the fields below one with a first or ids argument count
+	// once per requested item.
+	MaxComplexity int
+	// Timeout bounds queries and mutations; subscriptions run until the
+	// client ends them. Mutations that time out may still complete.
+	Timeout time.Duration
+}
+
+// Codes sent in the extensions of rejected requests.
+const (
+	CodeQueryTooDeep               = "QUERY_TOO_DEEP"
+	CodeQueryTooComplex            = "QUERY_TOO_COMPLEX"
+	CodeTimeout                    = "TIMEOUT"
+	CodeQueryNotAllowed            = "QUERY_NOT_ALLOWED"
+	CodePersistedQueryNotFound     = "PERSISTED_QUERY_NOT_FOUND"
+	CodePersistedQueryNotSupported = "PERSISTED_QUERY_NOT_SUPPORTED"
+	CodeBadRequest                 = "BAD_REQUEST"
+)
+
+// reject returns the error of a request that isn't executed.
+func reject(code, message string, extensions map[string]interface{}) []gqlerrors.FormattedError {
+	if extensions == nil {
+		extensions = map[string]interface{}{}
+	}
+	extensions["code"] = code
+	return []gqlerrors.FormattedError{{Message: message, Extensions: extensions}}
+}
+
+// checkLimits measures an operation against the Server's Limits.
+func (s *Server) checkLimits(doc *ast.Document, op *ast.OperationDefinition, variables map[string]interface{}) []gqlerrors.FormattedError {
+	limits := s.options.Limits
+	if limits.MaxDepth == 0 && limits.MaxComplexity == 0 {
+		return nil
+	}
+	m := &measure{
+		schema:    &s.schema,
+		fragments: map[string]*ast.FragmentDefinition{},
+		variables: variables,
+		defaults:  map[string]ast.Value{},
+	}
+	for _, definition := range doc.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			m.fragments[fragment.Name.Value] = fragment
+		}
+	}
+	for _, definition := range op.VariableDefinitions {
+		if definition.DefaultValue != nil {
+			m.defaults[definition.Variable.Name.Value] = definition.DefaultValue
+		}
+	}
+	var root graphql.Type = s.schema.QueryType()
+	switch op.Operation {
+	case ast.OperationTypeMutation:
+		root = s.schema.MutationType()
+	case ast.OperationTypeSubscription:
+		root = s.schema.SubscriptionType()
+	}
+
+	depth, complexity := m.selections(op.SelectionSet, root)
+	if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+		return reject(CodeQueryTooDeep, fmt.Sprintf("query depth %d exceeds the maximum of %d", depth, limits.MaxDepth),
+			map[string]interface{}{"depth": depth, "maxDepth": limits.MaxDepth})
+	}
+	if limits.MaxComplexity > 0 && complexity > limits.MaxComplexity {
+		return reject(CodeQueryTooComplex, fmt.Sprintf("query complexity %d exceeds the maximum of %d", complexity, limits.MaxComplexity),
+			map[string]interface{}{"complexity": complexity, "maxComplexity": limits.MaxComplexity})
+	}
+	return nil
+}
+
+// measure computes the depth and complexity of a validated operation.
+// Introspection fields are free, so tools like GraphiQL keep working.
+type measure struct {
+	schema    *graphql.Schema
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	defaults  map[string]ast.Value
+}
+
+// fielded is implemented by object and interface types.
+type fielded interface {
+	Fields() graphql.FieldDefinitionMap
+}
+
+func (m *measure) selections(set *ast.SelectionSet, parent graphql.Type) (depth, complexity int) {
+	if set == nil {
+		return 0, 0
+	}
+	for _, selection := range set.Selections {
+		var d, c int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(selection.Name.Value, "__") {
+				continue
+			}
+			var definition *graphql.FieldDefinition
+			if parent, ok := parent.(fielded); ok {
+				definition = parent.Fields()[selection.Name.Value]
+			}
+			var fieldType graphql.Type
+			if definition != nil {
+				fieldType, _ = graphql.GetNamed(definition.Type).(graphql.Type)
+			}
+			d, c = m.selections(selection.SelectionSet, fieldType)
+			d, c = d+1, 1+m.pageSize(selection, definition)*c
+		case *ast.InlineFragment:
+			d, c = m.selections(selection.SelectionSet, m.condition(selection.TypeCondition, parent))
+		case *ast.FragmentSpread:
+			if fragment, ok := m.fragments[selection.Name.Value]; ok {
+				d, c = m.selections(fragment.SelectionSet, m.condition(fragment.TypeCondition, parent))
+			}
+		}
+		depth = max(depth, d)
+		complexity += c
+	}
+	return depth, complexity
+}
+
+func (m *measure) condition(typeCondition *ast.Named, parent graphql.Type) graphql.Type {
+	if typeCondition == nil {
+		return parent
+	}
+	return m.schema.Type(typeCondition.Name.Value)
+}
+
+// pageSize returns how many items a field with a first or ids argument asks
+// for, or 1 for other fields.
+func (m *measure) pageSize(field *ast.Field, definition *graphql.FieldDefinition) int {
+	var first *graphql.Argument
+	if definition != nil {
+		for _, arg := range definition.Args {
+			switch arg.Name() {
+			case "first":
+				first = arg
+			case "ids":
+				return m.idCount(field)
+			}
+		}
+	}
+	if first == nil {
+		return 1
+	}
+	size := DefaultPageSize
+	if n, ok := first.DefaultValue.(int); ok {
+		size = n
+	}
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+		value := arg.Value
+		if variable, ok := value.(*ast.Variable); ok {
+			switch v := m.variables[variable.Name.Value].(type) {
+			case float64:
+				return max(int(v), 1)
+			case int:
+				return max(v, 1)
+			}
+			value = m.defaults[variable.Name.Value]
+		}
+		if value, ok := value.(*ast.IntValue); ok {
+			if n, err := strconv.Atoi(value.Value); err == nil {
+				size = n
+			}
+		}
+	}
+	return max(size, 1)
+}
+
+// idCount returns how many ids the ids argument of a field holds.
+func (m *measure) idCount(field *ast.Field) int {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "ids" {
+			continue
+		}
+		value := arg.Value
+		if variable, ok := value.(*ast.Variable); ok {
+			if ids, ok := m.variables[variable.Name.Value].([]interface{}); ok {
+				return max(len(ids), 1)
+			}
+			value = m.defaults[variable.Name.Value]
+		}
+		if list, ok := value.(*ast.ListValue); ok {
+			return max(len(list.Values), 1)
+		}
+	}
+	return 1
+}
@@ -0,0 +1,74 @@
+package gql_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/gql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimits(t *testing.T) {
+	engine := newEngineWith(t, gql.Options{Limits: gql.Limits{MaxComplexity: 50}})
+
+	// edges are counted once per requested item: 1 + 20 * (1 + 1 + 2)
+	query := `query($n: Int) { users(first: $n) { edges { node { id username } } } }`
+	resp := post(t, engine, query, map[string]interface{}{"n": 20})
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, gql.CodeQueryTooComplex, resp.Errors[0].Extensions["code"])
+	assert.Equal(t, float64(81), resp.Errors[0].Extensions["complexity"])
+	resp = post(t, engine, query, map[string]interface{}{"n": 5})
+	assert.Empty(t, resp.Errors)
+
+	// nodes counts once per id: 1 + 60 * 1
+	ids := make([]string, 60)
+	for i := range ids {
+		ids[i] = "nope"
+	}
+	resp = post(t, engine, `query($ids: [ID!]!) { nodes(ids: $ids) { id } }`, map[string]interface{}{"ids": ids})
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, float64(61), resp.Errors[0].Extensions["complexity"])
+
+	engine = newEngineWith(t, gql.Options{Limits: gql.Limits{MaxDepth: 3}})
+	resp = post(t, engine, `{ users { ...page } } fragment page on UserConnection { edges { node { id } } }`, nil)
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, gql.CodeQueryTooDeep, resp.Errors[0].Extensions["code"])
+	resp = post(t, engine, `{ users { pageInfo { hasNextPage } } __schema { types { fields { type { name } } } } }`, nil)
+	assert.Empty(t, resp.Errors, "introspection is free")
+}
+
+func TestPersistedQueries(t *testing.T) {
+	query := `{ users { edges { node { id } } } }`
+	persisted := &gql.Extensions{PersistedQuery: &gql.PersistedQuery{Version: 1, SHA256Hash: gql.Hash(query)}}
+
+	engine := newEngineWith(t, gql.Options{PersistedQueries: dal.NewLRUCache(10)})
+	resp := postBody(t, engine, gql.Request{Extensions: persisted})
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, "PersistedQueryNotFound", resp.Errors[0].Message)
+	assert.Equal(t, gql.CodePersistedQueryNotFound, resp.Errors[0].Extensions["code"])
+	resp = postBody(t, engine, gql.Request{Query: query, Extensions: persisted})
+	assert.Empty(t, resp.Errors)
+	resp = postBody(t, engine, gql.Request{Extensions: persisted})
+	assert.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"edges": []}`, string(resp.Data["users"]))
+	resp = postBody(t, engine, gql.Request{Query: `{ webhooks { edges { node { id } } } }`, Extensions: persisted})
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, gql.CodeBadRequest, resp.Errors[0].Extensions["code"])
+
+	// with an allowlist nothing else runs
+	allowlist, err := gql.ReadAllowlist(strings.NewReader(`{"` + gql.Hash(query) + `": "` + query + `"}`))
+	require.NoError(t, err)
+	engine = newEngineWith(t, gql.Options{Allowlist: allowlist})
+	resp = postBody(t, engine, gql.Request{Extensions: persisted})
+	assert.Empty(t, resp.Errors)
+	resp = post(t, engine, query, nil)
+	assert.Empty(t, resp.Errors)
+	resp = post(t, engine, `{ webhooks { edges { node { id } } } }`, nil)
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, gql.CodeQueryNotAllowed, resp.Errors[0].Extensions["code"])
+
+	_, err = gql.ReadAllowlist(strings.NewReader(`{"abc": "` + query + `"}`))
+	assert.Error(t, err)
+}
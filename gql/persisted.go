@@ -0,0 +1,95 @@
+package gql
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// Extensions are the request extensions the Server understands.
+type Extensions struct {
+	PersistedQuery *PersistedQuery `json:"persistedQuery,omitempty"`
+}
+
+// PersistedQuery identifies a query by hash, as sent by Apollo's Automatic
+// Persisted Queries: clients send only the hash and, when the server answers
+// PersistedQueryNotFound, retry with the query for the server to cache.
+type PersistedQuery struct {
+	Version    int    `json:"version"`
+	SHA256Hash string `json:"sha256Hash"`
+}
+
+// Hash returns the hex SHA-256 hash persisted queries are keyed by.
+func Hash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// ReadAllowlist reads an allowlist for Options.Allowlist: a JSON object of
+// queries keyed by their SHA-256 hash, as generated by persisted query
+// tooling. Entries whose key isn't the hash of their query are an error.
+func ReadAllowlist(r io.Reader) (map[string]string, error) {
+	var allowlist map[string]string
+	if err := json.NewDecoder(r).Decode(&allowlist); err != nil {
+		return nil, fmt.Errorf("reading allowlist: %w", err)
+	}
+	for hash, query := range allowlist {
+		if Hash(query) != hash {
+			return nil, fmt.Errorf("reading allowlist: %s isn't the SHA-256 hash of its query", hash)
+		}
+	}
+	return allowlist, nil
+}
+
+// persistedQueryTTL is how long an automatic persisted query stays cached
+// after it was last registered.
+const persistedQueryTTL = 24 * time.Hour
+
+// resolveQuery returns the query to execute: the one sent, one looked up by
+// hash or, with an allowlist, only an allowlisted one.
+func (s *Server) resolveQuery(req Request) (string, []gqlerrors.FormattedError) {
+	var persisted *PersistedQuery
+	if req.Extensions != nil {
+		persisted = req.Extensions.PersistedQuery
+	}
+	if persisted != nil && persisted.Version != 1 {
+		return "", reject(CodeBadRequest, fmt.Sprintf("unsupported persisted query version %d", persisted.Version), nil)
+	}
+	hash := ""
+	if persisted != nil {
+		hash = persisted.SHA256Hash
+		if req.Query != "" && Hash(req.Query) != hash {
+			return "", reject(CodeBadRequest, "provided sha does not match query", nil)
+		}
+	}
+
+	switch {
+	case s.options.Allowlist != nil:
+		if hash == "" {
+			hash = Hash(req.Query)
+		}
+		query, ok := s.options.Allowlist[hash]
+		if !ok {
+			return "", reject(CodeQueryNotAllowed, "only allowlisted queries may run", map[string]interface{}{"sha256Hash": hash})
+		}
+		return query, nil
+	case persisted == nil:
+		return req.Query, nil
+	case s.options.PersistedQueries == nil:
+		return "", reject(CodePersistedQueryNotSupported, "PersistedQueryNotSupported", nil)
+	case req.Query == "":
+		query, ok := s.options.PersistedQueries.Get(hash)
+		if !ok {
+			return "", reject(CodePersistedQueryNotFound, "PersistedQueryNotFound", nil)
+		}
+		return string(query), nil
+	default:
+		s.options.PersistedQueries.Set(hash, []byte(req.Query), persistedQueryTTL)
+		return req.Query, nil
+	}
+}
@@ -0,0 +1,243 @@
+package gql
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/problem"
+	"github.com/seebasoft/prompter/goback/registry"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// GlobalID returns the Relay global ID of an item: its resource name and
+// key, base64 encoded, e.g. "users:6650..." for a user.
+func GlobalID(res *registry.Resource, key interface{}) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(res.Name + ":" + res.Keys.Format(key)))
+}
+
+// ParseGlobalID splits a global ID into the resource name and the key, as
+// formatted by the resource's KeyCodec.
+func ParseGlobalID(id string) (resource, key string, err error) {
+	data, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil {
+		return "", "", fmt.Errorf("decoding global ID: %w", err)
+	}
+	resource, key, ok := strings.Cut(string(data), ":")
+	if !ok || resource == "" {
+		return "", "", errors.New("decoding global ID: no resource name")
+	}
+	return resource, key, nil
+}
+
+// invalidID is the error of an id argument that isn't a global ID of the
+// expected resource.
+func invalidID(ctx context.Context, id string) error {
+	return fail(ctx, problem.New(http.StatusBadRequest, fmt.Sprintf("%q isn't a valid id", id)), http.StatusBadRequest)
+}
+
+// addNodeFields adds the node and nodes queries, which read items of any
+// readable resource by global ID.
+func (s *Server) addNodeFields(query graphql.Fields) {
+	query["node"] = &graphql.Field{
+		Type:        s.nodeInterface,
+		Description: "Reads an item of any type by its id.",
+		Args:        graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.ID)}},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			id, _ := p.Args["id"].(string)
+			return s.node(p.Context, id)
+		},
+	}
+	query["nodes"] = &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.NewList(s.nodeInterface)),
+		Description: fmt.Sprintf("Reads up to %d items of any type by their ids, null where there is none.", MaxPageSize),
+		Args:        graphql.FieldConfigArgument{"ids": {Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.ID)))}},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			ids, _ := p.Args["ids"].([]interface{})
+			if len(ids) > MaxPageSize {
+				return nil, fail(p.Context, problem.New(http.StatusBadRequest, fmt.Sprintf("nodes reads at most %d ids", MaxPageSize)), http.StatusBadRequest)
+			}
+			thunks := make([]func() (interface{}, error), len(ids))
+			for i, id := range ids {
+				thunk, err := s.node(p.Context, id.(string))
+				if err != nil {
+					return nil, err
+				}
+				thunks[i] = thunk.(func() (interface{}, error))
+			}
+			return func() (interface{}, error) {
+				items := make([]interface{}, len(thunks))
+				for i, thunk := range thunks {
+					item, err := thunk()
+					if err != nil {
+						return nil, err
+					}
+					items[i] = item
+				}
+				return items, nil
+			}, nil
+		},
+	}
+}
+
+// node resolves a global ID through the resource it names.
+func (s *Server) node(ctx context.Context, id string) (interface{}, error) {
+	name, segment, err := ParseGlobalID(id)
+	if err != nil {
+		return nil, invalidID(ctx, id)
+	}
+	r, ok := s.readers[name]
+	if !ok {
+		return nil, invalidID(ctx, id)
+	}
+	key, err := r.res.Keys.Parse(segment)
+	if err != nil {
+		return nil, invalidID(ctx, id)
+	}
+	if err := r.authorize(ctx, registry.OpRead); err != nil {
+		return nil, err
+	}
+	return r.load(ctx, key), nil
+}
+
+// connection is a page of a list query, shaped as a Relay connection.
+type connection struct {
+	Edges    []edge   `json:"edges"`
+	PageInfo pageInfo `json:"pageInfo"`
+}
+
+type edge struct {
+	Node   dal.Item `json:"node"`
+	Cursor string   `json:"cursor"`
+}
+
+type pageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor"`
+	EndCursor       *string `json:"endCursor"`
+}
+
+// pageInfoType is shared by all connections.
+var pageInfoType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PageInfo",
+	Fields: graphql.Fields{
+		"hasNextPage": {Type: graphql.NewNonNull(graphql.Boolean)},
+		"hasPreviousPage": {
+			Type:        graphql.NewNonNull(graphql.Boolean),
+			Description: "Only pages after a cursor have previous pages; paging backwards isn't supported.",
+		},
+		"startCursor": {Type: graphql.String},
+		"endCursor":   {Type: graphql.String, Description: "Pass as after to read the next page."},
+	},
+})
+
+// connectionType returns the <Type>Connection type of a resource's objects.
+func connectionType(name string, object *graphql.Object) *graphql.Object {
+	edgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: name + "Edge",
+		Fields: graphql.Fields{
+			"node":   {Type: graphql.NewNonNull(object)},
+			"cursor": {Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: name + "Connection",
+		Fields: graphql.Fields{
+			"edges":    {Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(edgeType)))},
+			"pageInfo": {Type: graphql.NewNonNull(pageInfoType)},
+		},
+	})
+}
+
+// keysetSort completes a sort with the key, so every item has a distinct
+// position to page from.
+func keysetSort(sort bson.D) bson.D {
+	for _, e := range sort {
+		if e.Key == "_id" {
+			return sort
+		}
+	}
+	return append(sort, bson.E{Key: "_id", Value: 1})
+}
+
+// cursor is the position of an item in a sort order: its values of the
+// sorted fields. It is BSON encoded, so the values keep their types.
+type cursor struct {
+	Sort   string `bson:"s"`
+	Values bson.A `bson:"v"`
+}
+
+func sortSpec(sort bson.D) string {
+	parts := make([]string, len(sort))
+	for i, e := range sort {
+		parts[i] = fmt.Sprintf("%s:%v", e.Key, e.Value)
+	}
+	return strings.Join(parts, ",")
+}
+
+// encodeCursor returns the opaque cursor of item in sort.
+func encodeCursor(item dal.Item, sort bson.D) (string, error) {
+	raw, err := bson.Marshal(item)
+	if err != nil {
+		return "", fmt.Errorf("encoding cursor: %w", err)
+	}
+	c := cursor{Sort: sortSpec(sort)}
+	for _, e := range sort {
+		value, err := bson.Raw(raw).LookupErr(strings.Split(e.Key, ".")...)
+		if err != nil {
+			c.Values = append(c.Values, nil)
+			continue
+		}
+		c.Values = append(c.Values, value)
+	}
+	data, err := bson.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("encoding cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// afterCursor returns the filter matching the items that come after a
+// cursor in sort: those greater on the first sort field, or equal on it and
+// greater on the next, and so on. Nulls sort first, so they come after every
+// value in descending order. Cursors of another sort order are invalid.
+func afterCursor(encoded string, sort bson.D) (bson.M, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decoding cursor: %w", err)
+	}
+	var c cursor
+	if err := bson.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("decoding cursor: %w", err)
+	}
+	if c.Sort != sortSpec(sort) || len(c.Values) != len(sort) {
+		return nil, errors.New("decoding cursor: it belongs to another sort order")
+	}
+
+	clauses := make([]bson.M, 0, len(sort))
+	for i, e := range sort {
+		var clause bson.M
+		switch {
+		case c.Values[i] != nil && e.Value == -1:
+			// nulls sort last, but $lt never matches them
+			clause = bson.M{"$or": []bson.M{{e.Key: bson.M{"$lt": c.Values[i]}}, {e.Key: nil}}}
+		case c.Values[i] != nil:
+			clause = bson.M{e.Key: bson.M{"$gt": c.Values[i]}}
+		case e.Value == -1:
+			continue // nothing sorts after null
+		default:
+			clause = bson.M{e.Key: bson.M{"$ne": nil}}
+		}
+		for j, previous := range sort[:i] {
+			clause[previous.Key] = c.Values[j]
+		}
+		clauses = append(clauses, clause)
+	}
+	return bson.M{"$or": clauses}, nil
+}
@@ -0,0 +1,159 @@
+package gql_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/seebasoft/prompter/goback/database"
+	"github.com/seebasoft/prompter/goback/gql"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// globalID builds the global ID of any resource and key.
+func globalID(resource, key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(resource + ":" + key))
+}
+
+func TestNodes(t *testing.T) {
+	engine := newEngine(t)
+
+	resp := post(t, engine, `mutation { createUser(input: {username: "jane", email: "jane@example.com"}) { id } }`, nil)
+	require.Empty(t, resp.Errors)
+	var created struct{ ID string }
+	require.NoError(t, json.Unmarshal(resp.Data["createUser"], &created))
+	resource, key, err := gql.ParseGlobalID(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "users", resource)
+	assert.Len(t, key, 24)
+
+	resp = post(t, engine, `query($id: ID!) { node(id: $id) { __typename id ... on User { username } } }`, map[string]interface{}{"id": created.ID})
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"__typename": "User", "id": "`+created.ID+`", "username": "jane"}`, string(resp.Data["node"]))
+
+	// unknown keys are null, ids of other resources or garbage are errors
+	resp = post(t, engine, `query($ids: [ID!]!) { nodes(ids: $ids) { id } }`, map[string]interface{}{"ids": []string{created.ID, globalID("users", "665000000000000000000000")}})
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `[{"id": "`+created.ID+`"}, null]`, string(resp.Data["nodes"]))
+	resp = post(t, engine, `query($id: ID!) { user(id: $id) { id } }`, map[string]interface{}{"id": globalID("webhooks", key)})
+	require.Len(t, resp.Errors, 1)
+	resp = post(t, engine, `{ node(id: "nope") { id } }`, nil)
+	require.Len(t, resp.Errors, 1)
+
+	// nodes reads a page at most
+	ids := make([]string, gql.MaxPageSize+1)
+	for i := range ids {
+		ids[i] = created.ID
+	}
+	resp = post(t, engine, `query($ids: [ID!]!) { nodes(ids: $ids) { id } }`, map[string]interface{}{"ids": ids})
+	require.Len(t, resp.Errors, 1)
+	assert.Contains(t, resp.Errors[0].Message, "ids")
+}
+
+func TestConnectionsReachNullsInDescendingOrder(t *testing.T) {
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+	for i, creator := range []string{"alice", "", "bob", "", "carol"} {
+		_, err := store.Create(ctx, &models.User{ID: primitive.NewObjectID(), Username: fmt.Sprintf("user%d", i), CreatedBy: creator})
+		require.NoError(t, err)
+	}
+	resources, err := models.Resources()
+	require.NoError(t, err)
+	server, err := gql.NewServer(store, resources, gql.Options{})
+	require.NoError(t, err)
+	engine := gin.New()
+	engine.POST("/graphql", server.Handler)
+
+	// createdBy is omitted when empty, and those users sort last
+	query := `query($after: String) {
+		users(sort: [createdBy_desc], first: 2, after: $after) {
+			edges { node { createdBy } }
+			pageInfo { hasNextPage endCursor }
+		}
+	}`
+	var page struct {
+		Edges []struct {
+			Node struct{ CreatedBy string }
+		}
+		PageInfo struct {
+			HasNextPage bool
+			EndCursor   string
+		}
+	}
+	var creators []string
+	variables := map[string]interface{}{}
+	for pages := 0; pages < 3; pages++ {
+		resp := post(t, engine, query, variables)
+		require.Empty(t, resp.Errors)
+		require.NoError(t, json.Unmarshal(resp.Data["users"], &page))
+		for _, e := range page.Edges {
+			creators = append(creators, e.Node.CreatedBy)
+		}
+		variables["after"] = page.PageInfo.EndCursor
+	}
+	assert.False(t, page.PageInfo.HasNextPage)
+	assert.Equal(t, []string{"carol", "bob", "alice", "", ""}, creators)
+}
+
+func TestConnections(t *testing.T) {
+	engine := newEngine(t)
+
+	// ties on the sorted field are broken by key, so no item is skipped
+	for _, name := range []string{"ann", "bob", "cid", "dan", "eve"} {
+		resp := post(t, engine, `mutation($input: UserInput!) { createUser(input: $input) { id } }`,
+			map[string]interface{}{"input": map[string]interface{}{"username": name, "email": name + "@example.com", "birthdate": "1990-05-01T00:00:00Z"}})
+		require.Empty(t, resp.Errors)
+	}
+	query := `query($after: String) {
+		users(sort: [birthdate_desc], first: 2, after: $after) {
+			edges { cursor node { username } }
+			pageInfo { hasNextPage hasPreviousPage startCursor endCursor }
+		}
+	}`
+	var page struct {
+		Edges []struct {
+			Cursor string
+			Node   struct{ Username string }
+		}
+		PageInfo struct {
+			HasNextPage, HasPreviousPage bool
+			StartCursor, EndCursor       *string
+		}
+	}
+	var names []string
+	variables := map[string]interface{}{}
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 3)
+		resp := post(t, engine, query, variables)
+		require.Empty(t, resp.Errors)
+		require.NoError(t, json.Unmarshal(resp.Data["users"], &page))
+		assert.Equal(t, pages > 0, page.PageInfo.HasPreviousPage)
+		require.NotEmpty(t, page.Edges)
+		assert.Equal(t, page.Edges[0].Cursor, *page.PageInfo.StartCursor)
+		assert.Equal(t, page.Edges[len(page.Edges)-1].Cursor, *page.PageInfo.EndCursor)
+		for _, e := range page.Edges {
+			names = append(names, e.Node.Username)
+		}
+		if !page.PageInfo.HasNextPage {
+			break
+		}
+		variables["after"] = *page.PageInfo.EndCursor
+	}
+	assert.ElementsMatch(t, []string{"ann", "bob", "cid", "dan", "eve"}, names)
+
+	// cursors only continue the sort they were made for
+	resp := post(t, engine, `query($after: String) { users(sort: [username], after: $after) { edges { cursor } } }`, variables)
+	require.Len(t, resp.Errors, 1)
+	assert.Contains(t, resp.Errors[0].Message, "cursor")
+
+	// cursors hold the sorted values, so write-only fields can't be sorted on
+	resp = post(t, engine, `{ webhooks(sort: [secret]) { edges { cursor } } }`, nil)
+	require.Len(t, resp.Errors, 1)
+	assert.Contains(t, resp.Errors[0].Message, "secret")
+}
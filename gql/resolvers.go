@@ -0,0 +1,331 @@
+package gql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/database"
+	"github.com/seebasoft/prompter/goback/filter"
+	"github.com/seebasoft/prompter/goback/logging"
+	"github.com/seebasoft/prompter/goback/problem"
+	"github.com/seebasoft/prompter/goback/registry"
+	"github.com/seebasoft/prompter/goback/schema"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Page sizes of list queries.
+const (
+	DefaultPageSize = 10
+	MaxPageSize     = 100
+)
+
+// resolver resolves the fields of one resource.
+type resolver struct {
+	server *Server
+	res    *registry.Resource
+	schema *schema.Schema
+}
+
+// Error is a resolver error. It carries the problem the REST API would
+// answer with, reported in the error's extensions.
+type Error struct {
+	Problem *problem.Problem
+}
+
+func (e *Error) Error() string {
+	return e.Problem.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Problem
+}
+
+// Extensions implements gqlerrors.ExtendedError.
+func (e *Error) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{
+		"code":   strings.ToUpper(strings.ReplaceAll(e.Problem.TypeName(), "-", "_")),
+		"status": e.Problem.Status,
+	}
+	if len(e.Problem.Errors) > 0 {
+		extensions["fieldErrors"] = e.Problem.Errors
+	}
+	return extensions
+}
+
+// fail converts err to an *Error, logging server errors with their cause.
+func fail(ctx context.Context, err error, fallbackStatus int) error {
+	p := problem.FromError(err, fallbackStatus)
+	if p.Status >= 500 {
+		logging.FromContext(ctx).Error(p.Title, "error", err, "status", p.Status)
+	}
+	return &Error{Problem: p}
+}
+
+func (r *resolver) authorize(ctx context.Context, op registry.Operation) error {
+	if r.res.Authorize == nil {
+		return nil
+	}
+	if err := r.res.Authorize(ctx, op); err != nil {
+		return fail(ctx, err, http.StatusForbidden)
+	}
+	return nil
+}
+
+// parseKey returns the key of the global ID in the id argument, which must
+// be one of the resource's.
+func (r *resolver) parseKey(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	id, _ := args["id"].(string)
+	name, segment, err := ParseGlobalID(id)
+	if err != nil || name != r.res.Name {
+		return nil, invalidID(ctx, id)
+	}
+	key, err := r.res.Keys.Parse(segment)
+	if err != nil {
+		return nil, invalidID(ctx, id)
+	}
+	return key, nil
+}
+
+// id resolves the id field of an item to its global ID.
+func (r *resolver) id(p graphql.ResolveParams) (interface{}, error) {
+	item, ok := p.Source.(dal.Item)
+	if !ok {
+		return nil, nil
+	}
+	return GlobalID(r.res, item.GetKey()), nil
+}
+
+// get resolves a single item by key; missing items are null.
+func (r *resolver) get(p graphql.ResolveParams) (interface{}, error) {
+	if err := r.authorize(p.Context, registry.OpRead); err != nil {
+		return nil, err
+	}
+	key, err := r.parseKey(p.Context, p.Args)
+	if err != nil {
+		return nil, err
+	}
+	return r.load(p.Context, key), nil
+}
+
+// load returns a thunk resolving to the item with key, or null if there is
+// none. Thunks are resolved after their sibling fields, so the keys of the
+// whole level are read in one go.
+func (r *resolver) load(ctx context.Context, key interface{}) func() (interface{}, error) {
+	load := r.server.loader(ctx).Load(ctx, key, r.res.Item)
+	return func() (interface{}, error) {
+		item, err := load()
+		if errors.Is(err, dal.ErrNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fail(ctx, err, http.StatusInternalServerError)
+		}
+		return item, nil
+	}
+}
+
+// list resolves a page of the items matching the filter argument, which
+// takes the same parameters as the REST list endpoint. Pages are read by
+// keyset: the after cursor holds the sorted values of the last item read.
+func (r *resolver) list(p graphql.ResolveParams) (interface{}, error) {
+	ctx := p.Context
+	if err := r.authorize(ctx, registry.OpList); err != nil {
+		return nil, err
+	}
+	first := DefaultPageSize
+	if n, ok := p.Args["first"].(int); ok {
+		first = n
+	}
+	if first < 1 || first > MaxPageSize {
+		return nil, fail(ctx, problem.New(http.StatusBadRequest, fmt.Sprintf("first must be between 1 and %d", MaxPageSize)), http.StatusBadRequest)
+	}
+
+	filterArg, _ := p.Args["filter"].(map[string]interface{})
+	mongoFilter, err := filter.Parse(r.res.Item, filterValues(filterArg), r.res.IsWriteOnly)
+	if err != nil {
+		return nil, fail(ctx, err, http.StatusBadRequest)
+	}
+	var sortFields []string
+	if fields, ok := p.Args["sort"].([]interface{}); ok {
+		for _, field := range fields {
+			sortFields = append(sortFields, field.(string))
+		}
+	}
+	sort := keysetSort(filter.Sort(sortFields))
+	after, hasAfter := p.Args["after"].(string)
+	if hasAfter {
+		keyset, err := afterCursor(after, sort)
+		if err != nil {
+			return nil, fail(ctx, problem.New(http.StatusBadRequest, "after isn't a valid cursor for this sort"), http.StatusBadRequest)
+		}
+		if len(mongoFilter) == 0 {
+			mongoFilter = keyset
+		} else {
+			mongoFilter = bson.M{"$and": []bson.M{mongoFilter, keyset}}
+		}
+	}
+
+	// Read one extra item to tell whether there's another page
+	queryOptions := database.NewMongoDalQueryOptions(database.NewMongoFilter(mongoFilter), sort, int64(first+1), 0)
+	iter, err := r.server.store.ReadByFilter(ctx, queryOptions, r.res.Item)
+	if err != nil {
+		return nil, fail(ctx, err, http.StatusInternalServerError)
+	}
+	defer iter.Close(ctx)
+
+	result := &connection{Edges: make([]edge, 0, first), PageInfo: pageInfo{HasPreviousPage: hasAfter}}
+	for iter.Next(ctx) {
+		if len(result.Edges) == first {
+			result.PageInfo.HasNextPage = true
+			break
+		}
+		item := r.res.New()
+		if err := iter.Decode(item); err != nil {
+			return nil, fail(ctx, err, http.StatusInternalServerError)
+		}
+		cursor, err := encodeCursor(item, sort)
+		if err != nil {
+			return nil, fail(ctx, err, http.StatusInternalServerError)
+		}
+		result.Edges = append(result.Edges, edge{Node: item, Cursor: cursor})
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fail(ctx, err, http.StatusInternalServerError)
+	}
+	if n := len(result.Edges); n > 0 {
+		result.PageInfo.StartCursor = &result.Edges[0].Cursor
+		result.PageInfo.EndCursor = &result.Edges[n-1].Cursor
+	}
+	return result, nil
+}
+
+// create resolves the create mutation like a REST POST: the input is checked
+// against the resource's JSON Schema, read-only fields are left to the
+// Store and the Item's own validation runs before it is stored.
+func (r *resolver) create(p graphql.ResolveParams) (interface{}, error) {
+	ctx := p.Context
+	if err := r.authorize(ctx, registry.OpCreate); err != nil {
+		return nil, err
+	}
+	item := r.res.New()
+	if err := r.decodeInput(ctx, p.Args["input"], item, false); err != nil {
+		return nil, err
+	}
+	r.res.KeepReadOnly(item, nil)
+	if err := dal.ValidateItem(ctx, item); err != nil {
+		return nil, fail(ctx, err, http.StatusBadRequest)
+	}
+
+	if r.res.Keys == registry.ObjectIDKeys {
+		item.SetKey(primitive.NewObjectID())
+	}
+	created, err := r.server.store.Create(ctx, item)
+	if err != nil {
+		return nil, fail(ctx, err, http.StatusBadRequest)
+	}
+	return created, nil
+}
+
+// update resolves the update mutation like a REST PATCH: the input is merged
+// into the stored item.
+func (r *resolver) update(p graphql.ResolveParams) (interface{}, error) {
+	ctx := p.Context
+	if err := r.authorize(ctx, registry.OpUpdate); err != nil {
+		return nil, err
+	}
+	key, err := r.parseKey(ctx, p.Args)
+	if err != nil {
+		return nil, err
+	}
+	item := r.res.New()
+	if err := r.server.store.ReadByKey(ctx, key, item); err != nil {
+		return nil, fail(ctx, err, http.StatusInternalServerError)
+	}
+	// Input types have no read-only fields, so those keep their stored values
+	if err := r.decodeInput(ctx, p.Args["input"], item, true); err != nil {
+		return nil, err
+	}
+	if err := dal.ValidateItem(ctx, item); err != nil {
+		return nil, fail(ctx, err, http.StatusBadRequest)
+	}
+
+	item.SetKey(key)
+	if _, err := r.server.store.UpdateByKey(ctx, key, item); err != nil {
+		return nil, fail(ctx, err, http.StatusInternalServerError)
+	}
+	return item, nil
+}
+
+// delete resolves the delete mutation, reporting whether an item was
+// deleted. Soft deletable items can be restored through the REST API.
+func (r *resolver) delete(p graphql.ResolveParams) (interface{}, error) {
+	ctx := p.Context
+	if err := r.authorize(ctx, registry.OpDelete); err != nil {
+		return nil, err
+	}
+	key, err := r.parseKey(ctx, p.Args)
+	if err != nil {
+		return nil, err
+	}
+	count, err := r.server.store.DeleteByKey(ctx, key, r.res.New())
+	if err != nil {
+		return nil, fail(ctx, err, http.StatusInternalServerError)
+	}
+	return count > 0, nil
+}
+
+// decodeInput validates an input argument against the resource's schema and
+// decodes it into item. With partial, required fields may be missing.
+func (r *resolver) decodeInput(ctx context.Context, input interface{}, item dal.Item, partial bool) error {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return fail(ctx, err, http.StatusBadRequest)
+	}
+	validate := r.schema.Validate
+	if partial {
+		validate = r.schema.ValidatePartial
+	}
+	if err := validate(data); err != nil {
+		return fail(ctx, err, http.StatusBadRequest)
+	}
+	if err := json.Unmarshal(data, item); err != nil {
+		return fail(ctx, err, http.StatusBadRequest)
+	}
+	return nil
+}
+
+// filterValues turns a filter argument into the query parameters the filter
+// package parses.
+func filterValues(args map[string]interface{}) url.Values {
+	values := url.Values{}
+	for name, value := range args {
+		switch value := value.(type) {
+		case time.Time:
+			values.Set(name, value.Format(time.RFC3339Nano))
+		case float64:
+			values.Set(name, strconv.FormatFloat(value, 'f', -1, 64))
+		case []interface{}:
+			parts := make([]string, 0, len(value))
+			for _, part := range value {
+				if t, ok := part.(time.Time); ok {
+					parts = append(parts, t.Format(time.RFC3339Nano))
+				}
+			}
+			values.Set(name, strings.Join(parts, ","))
+		case nil:
+		default:
+			values.Set(name, fmt.Sprint(value))
+		}
+	}
+	return values
+}
@@ -0,0 +1,363 @@
+// Package gql serves a GraphQL API over the resources of a registry.Registry.
+// Every resource gets object, input, filter and sort types derived from its
+// Item, a "user(id)" query, a "users(filter, sort, first, after)" query
+// returning a Relay connection and createUser, updateUser and deleteUser
+// mutations, each limited to the operations the resource allows. Objects
+// implement the Relay Node interface: their ids are global IDs, readable
+// with node(id) and nodes(ids). With a dal.Watcher there are userCreated,
+// userUpdated and userDeleted subscriptions too, served over WebSocket.
+// Resolvers go through the same dal.Store, filters, schema validation and
+// authorization as the REST API.
+package gql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/registry"
+	"github.com/seebasoft/prompter/goback/schema"
+)
+
+// Options configures the optional parts of a Server.
+type Options struct {
+	// GraphiQL serves the GraphiQL playground to browsers opening the
+	// endpoint. Meant for local development.
+	GraphiQL bool
+	// Watcher, if set, feeds the userCreated, userUpdated and userDeleted
+	// subscriptions, served over WebSocket. Without one there are none.
+	Watcher dal.Watcher
+	// Limits bound the depth, complexity and duration of requests.
+	Limits Limits
+	// PersistedQueries, if set, caches the queries of Automatic Persisted
+	// Queries by hash; without it requests must send the whole query.
+	PersistedQueries dal.Cache
+	// Allowlist, if set, holds the only queries that run, keyed by SHA-256
+	// hash. Clients send the hash, the query or both. See ReadAllowlist.
+	Allowlist map[string]string
+}
+
+// Server executes GraphQL requests against a Store.
+type Server struct {
+	store   dal.Store
+	options Options
+	schema  graphql.Schema
+
+	nodeInterface *graphql.Interface
+	nodeTypes     map[reflect.Type]*graphql.Object
+	readers       map[string]*resolver // resources node can read, by name
+}
+
+// NewServer builds the GraphQL schema of resources, resolved through store.
+func NewServer(store dal.Store, resources *registry.Registry, options Options) (*Server, error) {
+	s := &Server{
+		store:     store,
+		options:   options,
+		nodeTypes: make(map[reflect.Type]*graphql.Object),
+		readers:   make(map[string]*resolver),
+	}
+	s.nodeInterface = graphql.NewInterface(graphql.InterfaceConfig{
+		Name:        "Node",
+		Description: "An object with a global ID.",
+		Fields:      graphql.Fields{"id": {Type: graphql.NewNonNull(graphql.ID)}},
+		ResolveType: func(p graphql.ResolveTypeParams) *graphql.Object {
+			return s.nodeTypes[reflect.TypeOf(p.Value)]
+		},
+	})
+	query := graphql.Fields{}
+	mutation := graphql.Fields{}
+	subscription := graphql.Fields{}
+	types := newTypes()
+	for _, res := range resources.Resources() {
+		s.addResource(types, res, query, mutation, subscription)
+	}
+	s.addNodeFields(query)
+
+	config := graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: query}),
+	}
+	for _, object := range s.nodeTypes {
+		config.Types = append(config.Types, object)
+	}
+	if len(mutation) > 0 {
+		config.Mutation = graphql.NewObject(graphql.ObjectConfig{Name: "Mutation", Fields: mutation})
+	}
+	if len(subscription) > 0 {
+		config.Subscription = graphql.NewObject(graphql.ObjectConfig{Name: "Subscription", Fields: subscription})
+	}
+	var err error
+	if s.schema, err = graphql.NewSchema(config); err != nil {
+		return nil, fmt.Errorf("building GraphQL schema: %w", err)
+	}
+	return s, nil
+}
+
+// addResource adds the fields of one resource to the root types.
+func (s *Server) addResource(types *types, res *registry.Resource, query, mutation, subscription graphql.Fields) {
+	r := &resolver{server: s, res: res, schema: schema.ForResource(res)}
+	name := typeName(res)
+	itemType := reflect.TypeOf(res.Item).Elem()
+	object := types.objectWith(itemType, graphql.ObjectConfig{
+		Name:       name,
+		Interfaces: []*graphql.Interface{s.nodeInterface},
+	}, res.IsWriteOnly, graphql.Fields{
+		"id": {Type: graphql.NewNonNull(graphql.ID), Resolve: r.id},
+	})
+	s.nodeTypes[reflect.TypeOf(res.Item)] = object
+	idArgs := graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.ID)}}
+	filterType := filterInput(res)
+
+	if res.Allows(registry.OpRead) {
+		s.readers[res.Name] = r
+		query[lowerFirst(name)] = &graphql.Field{
+			Type:        object,
+			Description: res.Description,
+			Args:        idArgs,
+			Resolve:     r.get,
+		}
+		if s.options.Watcher != nil {
+			s.addSubscriptions(r, object, filterType, subscription)
+		}
+	}
+	if res.Allows(registry.OpList) {
+		query[res.Name] = &graphql.Field{
+			Type:        graphql.NewNonNull(connectionType(name, object)),
+			Description: res.Description,
+			Args: graphql.FieldConfigArgument{
+				"filter": {Type: filterType},
+				"sort":   {Type: graphql.NewList(graphql.NewNonNull(sortEnum(res))), Description: `Fields to sort by, "_desc" suffixed to sort descending.`},
+				"first":  {Type: graphql.Int, DefaultValue: DefaultPageSize},
+				"after":  {Type: graphql.String},
+			},
+			Resolve: r.list,
+		}
+	}
+
+	input := types.inputObject(itemType, name+"Input", res.IsReadOnly)
+	if res.Allows(registry.OpCreate) {
+		mutation["create"+name] = &graphql.Field{
+			Type:    object,
+			Args:    graphql.FieldConfigArgument{"input": {Type: graphql.NewNonNull(input)}},
+			Resolve: r.create,
+		}
+	}
+	if res.Allows(registry.OpUpdate) {
+		mutation["update"+name] = &graphql.Field{
+			Type:        object,
+			Description: "Sets the given fields, leaving the others as they are.",
+			Args: graphql.FieldConfigArgument{
+				"id":    {Type: graphql.NewNonNull(graphql.ID)},
+				"input": {Type: graphql.NewNonNull(input)},
+			},
+			Resolve: r.update,
+		}
+	}
+	if res.Allows(registry.OpDelete) {
+		mutation["delete"+name] = &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.Boolean),
+			Description: "Returns false if there was nothing to delete.",
+			Args:        idArgs,
+			Resolve:     r.delete,
+		}
+	}
+}
+
+// Schema returns the GraphQL schema.
+func (s *Server) Schema() graphql.Schema {
+	return s.schema
+}
+
+// loader returns the Loader of the request, or one for this read alone.
+func (s *Server) loader(ctx context.Context) *dal.Loader {
+	if loader := dal.LoaderFrom(ctx); loader != nil {
+		return loader
+	}
+	return dal.NewLoader(s.store, dal.LoaderOptions{})
+}
+
+// Request is a GraphQL request as sent over HTTP.
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    *Extensions            `json:"extensions,omitempty"`
+}
+
+// Do executes a query or mutation. Subscriptions need a WebSocket.
+func (s *Server) Do(ctx context.Context, req Request) *graphql.Result {
+	doc, op, errs := s.parse(req)
+	return s.do(ctx, req, doc, op, errs)
+}
+
+// do executes a parsed request.
+func (s *Server) do(ctx context.Context, req Request, doc *ast.Document, op *ast.OperationDefinition,
+	errs []gqlerrors.FormattedError) *graphql.Result {
+	if errs != nil {
+		return &graphql.Result{Errors: errs}
+	}
+	if op != nil && op.Operation == ast.OperationTypeSubscription {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(errors.New("subscriptions are only served over WebSocket"))}
+	}
+	return s.executeDocument(ctx, req, doc)
+}
+
+// execute executes a request, sending every event of a subscription or the
+// single result of anything else. Requests that aren't valid return errors
+// instead.
+func (s *Server) execute(ctx context.Context, req Request) (<-chan *graphql.Result, []gqlerrors.FormattedError) {
+	doc, op, errs := s.parse(req)
+	if errs != nil {
+		return nil, errs
+	}
+	if op != nil && op.Operation == ast.OperationTypeSubscription {
+		return graphql.ExecuteSubscription(graphql.ExecuteParams{
+			Schema:        s.schema,
+			AST:           doc,
+			OperationName: req.OperationName,
+			Args:          req.Variables,
+			Context:       ctx,
+		}), nil
+	}
+	results := make(chan *graphql.Result, 1)
+	results <- s.executeDocument(ctx, req, doc)
+	close(results)
+	return results, nil
+}
+
+// parse looks up, parses and validates the query of a request, also
+// returning the operation to execute if there is one by that name. Requests
+// over the Server's Limits are rejected.
+func (s *Server) parse(req Request) (*ast.Document, *ast.OperationDefinition, []gqlerrors.FormattedError) {
+	query, errs := s.resolveQuery(req)
+	if errs != nil {
+		return nil, nil, errs
+	}
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		return nil, nil, gqlerrors.FormatErrors(err)
+	}
+	if result := graphql.ValidateDocument(&s.schema, doc, nil); !result.IsValid {
+		return nil, nil, result.Errors
+	}
+	for _, definition := range doc.Definitions {
+		op, ok := definition.(*ast.OperationDefinition)
+		if ok && (req.OperationName == "" || op.Name != nil && op.Name.Value == req.OperationName) {
+			return doc, op, s.checkLimits(doc, op, req.Variables)
+		}
+	}
+	return doc, nil, nil
+}
+
+// executeDocument executes a query or mutation with a fresh dal.Loader, which
+// batches the reads of its resolvers, within the Timeout.
+func (s *Server) executeDocument(ctx context.Context, req Request, doc *ast.Document) *graphql.Result {
+	execCtx := ctx
+	if s.options.Limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		execCtx, cancel = context.WithTimeout(ctx, s.options.Limits.Timeout)
+		defer cancel()
+	}
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        s.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       dal.WithLoader(execCtx, dal.NewLoader(s.store, dal.LoaderOptions{})),
+	})
+	if ctx.Err() == nil && errors.Is(execCtx.Err(), context.DeadlineExceeded) {
+		timeout := s.options.Limits.Timeout
+		return &graphql.Result{Errors: reject(CodeTimeout, fmt.Sprintf("the request took longer than %s", timeout),
+			map[string]interface{}{"timeout": timeout.String()})}
+	}
+	return result
+}
+
+// Handler serves GraphQL over HTTP: POST with a JSON request body, or GET
+// with query, operationName, variables and extensions parameters. Results
+// are always sent with 200; requests that can't be read get 400 and
+// mutations sent with GET get 405, so links and prefetches can't write. If
+// the Server has a Watcher, WebSocket upgrades are served with the
+// graphql-transport-ws protocol.
+func (s *Server) Handler(c *gin.Context) {
+	if s.options.Watcher != nil && websocket.IsWebSocketUpgrade(c.Request) {
+		s.serveWebSocket(c)
+		return
+	}
+	var req Request
+	switch c.Request.Method {
+	case http.MethodGet:
+		req.Query = c.Query("query")
+		if req.Query == "" && s.options.GraphiQL && strings.Contains(c.GetHeader("Accept"), "text/html") {
+			c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(graphiQLPage))
+			return
+		}
+		req.OperationName = c.Query("operationName")
+		if variables := c.Query("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				badRequest(c, "variables must be a JSON object")
+				return
+			}
+		}
+		if extensions := c.Query("extensions"); extensions != "" {
+			if err := json.Unmarshal([]byte(extensions), &req.Extensions); err != nil {
+				badRequest(c, "extensions must be a JSON object")
+				return
+			}
+		}
+	default:
+		if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+			badRequest(c, "the request body must be a JSON object with a query")
+			return
+		}
+	}
+	if req.Query == "" && (req.Extensions == nil || req.Extensions.PersistedQuery == nil) {
+		badRequest(c, "query is missing")
+		return
+	}
+	doc, op, errs := s.parse(req)
+	if errs == nil && op != nil && op.Operation == ast.OperationTypeMutation && c.Request.Method == http.MethodGet {
+		c.Header("Allow", http.MethodPost)
+		c.AbortWithStatusJSON(http.StatusMethodNotAllowed, gin.H{"errors": []gin.H{{"message": "mutations must be sent with POST"}}})
+		return
+	}
+	c.JSON(http.StatusOK, s.do(c.Request.Context(), req, doc, op, errs))
+}
+
+func badRequest(c *gin.Context, message string) {
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": []gin.H{{"message": message}}})
+}
+
+// graphiQLPage loads GraphiQL from a CDN and points it at the page's own URL.
+const graphiQLPage = `<!DOCTYPE html>
+<html>
+<head>
+  <title>GraphiQL</title>
+  <link rel="stylesheet" href="https://unpkg.com/graphiql@3/graphiql.min.css" />
+</head>
+<body style="margin: 0;">
+  <div id="graphiql" style="height: 100vh;"></div>
+  <script crossorigin src="https://unpkg.com/react@18/umd/react.production.min.js"></script>
+  <script crossorigin src="https://unpkg.com/react-dom@18/umd/react-dom.production.min.js"></script>
+  <script crossorigin src="https://unpkg.com/graphiql@3/graphiql.min.js"></script>
+  <script>
+    const fetcher = GraphiQL.createFetcher({ url: window.location.pathname });
+    ReactDOM.createRoot(document.getElementById('graphiql')).render(React.createElement(GraphiQL, { fetcher }));
+  </script>
+</body>
+</html>
+`
@@ -0,0 +1,160 @@
+package gql_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/seebasoft/prompter/goback/database"
+	"github.com/seebasoft/prompter/goback/gql"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type response struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func newEngine(t *testing.T) *gin.Engine {
+	t.Helper()
+	return newEngineWith(t, gql.Options{GraphiQL: true})
+}
+
+func newEngineWith(t *testing.T, options gql.Options) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	resources, err := models.Resources()
+	require.NoError(t, err)
+	server, err := gql.NewServer(database.NewMemoryStore(), resources, options)
+	require.NoError(t, err)
+	engine := gin.New()
+	engine.Any("/graphql", server.Handler)
+	return engine
+}
+
+func post(t *testing.T, engine *gin.Engine, query string, variables map[string]interface{}) response {
+	t.Helper()
+	return postBody(t, engine, gql.Request{Query: query, Variables: variables})
+}
+
+func postBody(t *testing.T, engine *gin.Engine, req gql.Request) response {
+	t.Helper()
+	body, err := json.Marshal(req)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body))))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestQueriesAndMutations(t *testing.T) {
+	engine := newEngine(t)
+
+	var ids []string
+	for _, name := range []string{"jane", "john", "mary"} {
+		resp := post(t, engine, `mutation($input: UserInput!) { createUser(input: $input) { id username } }`,
+			map[string]interface{}{"input": map[string]interface{}{"username": name, "email": name + "@example.com", "birthdate": "1990-05-01T00:00:00Z"}})
+		require.Empty(t, resp.Errors)
+		var created struct{ ID, Username string }
+		require.NoError(t, json.Unmarshal(resp.Data["createUser"], &created))
+		assert.Equal(t, name, created.Username)
+		ids = append(ids, created.ID)
+	}
+
+	resp := post(t, engine, `query($id: ID!) { user(id: $id) { username email birthdate } }`, map[string]interface{}{"id": ids[0]})
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"username": "jane", "email": "jane@example.com", "birthdate": "1990-05-01T00:00:00Z"}`, string(resp.Data["user"]))
+
+	// same filter parameters as REST, paged with cursors
+	query := `query($after: String) {
+		users(filter: {username_startswith: "J"}, sort: [username_desc], first: 1, after: $after) {
+			edges { node { username } }
+			pageInfo { hasNextPage endCursor }
+		}
+	}`
+	var page struct {
+		Edges []struct {
+			Node struct{ Username string }
+		}
+		PageInfo struct {
+			HasNextPage bool
+			EndCursor   string
+		}
+	}
+	resp = post(t, engine, query, nil)
+	require.Empty(t, resp.Errors)
+	require.NoError(t, json.Unmarshal(resp.Data["users"], &page))
+	assert.Equal(t, "john", page.Edges[0].Node.Username)
+	assert.True(t, page.PageInfo.HasNextPage)
+	resp = post(t, engine, query, map[string]interface{}{"after": page.PageInfo.EndCursor})
+	require.NoError(t, json.Unmarshal(resp.Data["users"], &page))
+	assert.Equal(t, "jane", page.Edges[0].Node.Username)
+	assert.False(t, page.PageInfo.HasNextPage)
+
+	resp = post(t, engine, `mutation($id: ID!) { updateUser(id: $id, input: {email: "jane@example.org"}) { username email } }`, map[string]interface{}{"id": ids[0]})
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"username": "jane", "email": "jane@example.org"}`, string(resp.Data["updateUser"]))
+
+	resp = post(t, engine, `mutation($id: ID!) { deleteUser(id: $id) }`, map[string]interface{}{"id": ids[0]})
+	require.Empty(t, resp.Errors)
+	assert.JSONEq(t, `true`, string(resp.Data["deleteUser"]))
+	resp = post(t, engine, `query($id: ID!) { user(id: $id) { username } }`, map[string]interface{}{"id": ids[0]})
+	assert.JSONEq(t, `null`, string(resp.Data["user"]))
+}
+
+func TestErrors(t *testing.T) {
+	engine := newEngine(t)
+
+	resp := post(t, engine, `mutation { createUser(input: {username: "x", email: "nope"}) { id } }`, nil)
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, "VALIDATION_ERROR", resp.Errors[0].Extensions["code"])
+	assert.Equal(t, float64(http.StatusUnprocessableEntity), resp.Errors[0].Extensions["status"])
+	assert.Len(t, resp.Errors[0].Extensions["fieldErrors"], 2)
+
+	resp = post(t, engine, `{ users(filter: {birthdate_between: ["2000-01-01T00:00:00Z"]}) { edges { node { id } } } }`, nil)
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, "INVALID_FILTER", resp.Errors[0].Extensions["code"])
+
+	// secrets are write-only and users can't set audit fields
+	resp = post(t, engine, `{ webhooks { edges { node { secret } } } }`, nil)
+	require.Len(t, resp.Errors, 1)
+	assert.Contains(t, resp.Errors[0].Message, `Cannot query field "secret"`)
+	resp = post(t, engine, `mutation { createUser(input: {username: "jdoe", email: "jdoe@example.com", createdBy: "mallory"}) { id } }`, nil)
+	require.Len(t, resp.Errors, 1)
+	assert.Contains(t, resp.Errors[0].Message, `"createdBy"`)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/graphql", nil)
+	req.Header.Set("Accept", "text/html")
+	engine.ServeHTTP(w, req)
+	assert.Contains(t, w.Body.String(), "GraphiQL")
+}
+
+func TestGetRejectsMutations(t *testing.T) {
+	engine := newEngine(t)
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/graphql?"+url.Values{"query": {query}}.Encode(), nil))
+		return w
+	}
+
+	w := get(`mutation { createUser(input: {username: "jdoe", email: "jdoe@example.com"}) { id } }`)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, http.MethodPost, w.Header().Get("Allow"))
+	resp := post(t, engine, `{ users { edges { node { id } } } }`, nil)
+	assert.JSONEq(t, `{"edges": []}`, string(resp.Data["users"]), "nothing was created")
+
+	w = get(`{ users { edges { node { id } } } }`)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,142 @@
+package gql
+
+import (
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/database"
+	"github.com/seebasoft/prompter/goback/filter"
+	"github.com/seebasoft/prompter/goback/outbox"
+	"github.com/seebasoft/prompter/goback/registry"
+)
+
+// addSubscriptions adds the userCreated, userUpdated and userDeleted
+// subscriptions of a resource. They are fed by the Watcher's change feed,
+// filtered by the Store where it can.
+func (s *Server) addSubscriptions(r *resolver, object *graphql.Object, filterType *graphql.InputObject, subscription graphql.Fields) {
+	name := lowerFirst(typeName(r.res))
+	subscription[name+"Created"] = &graphql.Field{
+		Type:      graphql.NewNonNull(object),
+		Args:      graphql.FieldConfigArgument{"filter": {Type: filterType}},
+		Subscribe: r.subscribe(outbox.ActionCreated),
+		Resolve:   resolveChange,
+	}
+	subscription[name+"Updated"] = &graphql.Field{
+		Type: graphql.NewNonNull(object),
+		Args: graphql.FieldConfigArgument{
+			"id":     {Type: graphql.ID, Description: "Only report changes of this item."},
+			"filter": {Type: filterType},
+		},
+		Subscribe: r.subscribe(outbox.ActionUpdated),
+		Resolve:   resolveChange,
+	}
+	subscription[name+"Deleted"] = &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.ID),
+		Description: "Reports the ids of deleted items, soft deleted ones included.",
+		Args:        graphql.FieldConfigArgument{"id": {Type: graphql.ID}},
+		Subscribe:   r.subscribe(outbox.ActionDeleted),
+		Resolve:     resolveChange,
+	}
+}
+
+// subscribe returns the source of a subscription: the changes of the
+// resource the action describes, as payloads for resolveChange.
+func (r *resolver) subscribe(action string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		ctx := p.Context
+		if err := r.authorize(ctx, registry.OpRead); err != nil {
+			return nil, subscribeError(err)
+		}
+		var key interface{}
+		if _, ok := p.Args["id"]; ok {
+			var err error
+			if key, err = r.parseKey(ctx, p.Args); err != nil {
+				return nil, subscribeError(err)
+			}
+		}
+		filterArg, _ := p.Args["filter"].(map[string]interface{})
+		mongoFilter, err := filter.Parse(r.res.Item, filterValues(filterArg), r.res.IsWriteOnly)
+		if err != nil {
+			return nil, subscribeError(fail(ctx, err, http.StatusBadRequest))
+		}
+		if key != nil {
+			mongoFilter["_id"] = key
+		}
+
+		events, err := r.server.options.Watcher.Watch(ctx, r.res.Item, database.NewMongoFilter(mongoFilter))
+		if err != nil {
+			return nil, subscribeError(fail(ctx, err, http.StatusInternalServerError))
+		}
+		payloads := make(chan interface{})
+		go func() {
+			defer close(payloads)
+			for event := range events {
+				var payload interface{}
+				switch {
+				case event.Err != nil:
+					payload = event.Err
+				case changeAction(event) != action:
+					continue
+				case key != nil && r.res.Keys.Format(event.Key) != r.res.Keys.Format(key):
+					// The Store passes on every delete, matching or not
+					continue
+				case action == outbox.ActionDeleted:
+					payload = GlobalID(r.res, event.Key)
+				default:
+					payload = event.Item
+				}
+				select {
+				case payloads <- payload:
+				case <-ctx.Done():
+					return
+				}
+				if event.Err != nil {
+					return
+				}
+			}
+		}()
+		return payloads, nil
+	}
+}
+
+// resolveChange resolves a subscription field from a payload sent by
+// subscribe. A failed change feed ends the subscription with an error.
+func resolveChange(p graphql.ResolveParams) (interface{}, error) {
+	if err, ok := p.Source.(error); ok {
+		return nil, fail(p.Context, err, http.StatusInternalServerError)
+	}
+	return p.Source, nil
+}
+
+// subscribeError keeps the extensions of an *Error returned before a
+// subscription starts, which graphql-go only reads from wrapped errors.
+func subscribeError(err error) error {
+	return &gqlerrors.Error{Message: err.Error(), OriginalError: err}
+}
+
+// changeAction tells what a change means to clients. Soft deletes are
+// deletes, and purging an item that was already soft deleted isn't reported
+// again; other updates, restores included, are updates.
+func changeAction(event dal.ChangeEvent) string {
+	switch event.Op {
+	case dal.ChangeInsert:
+		return outbox.ActionCreated
+	case dal.ChangeDelete:
+		if isSoftDeleted(event.Item) {
+			return ""
+		}
+		return outbox.ActionDeleted
+	default:
+		if isSoftDeleted(event.Item) {
+			return outbox.ActionDeleted
+		}
+		return outbox.ActionUpdated
+	}
+}
+
+func isSoftDeleted(item dal.Item) bool {
+	softDeletable, ok := item.(dal.SoftDeletable)
+	return ok && softDeletable.GetDeletedAt() != nil
+}
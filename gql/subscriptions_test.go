@@ -0,0 +1,110 @@
+package gql_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/seebasoft/prompter/goback/database"
+	"github.com/seebasoft/prompter/goback/gql"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type message struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+func dial(t *testing.T) (*websocket.Conn, *gin.Engine) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	resources, err := models.Resources()
+	require.NoError(t, err)
+	store := database.NewMemoryStore()
+	server, err := gql.NewServer(store, resources, gql.Options{Watcher: store})
+	require.NoError(t, err)
+	engine := gin.New()
+	engine.Any("/graphql", server.Handler)
+	httpServer := httptest.NewServer(engine)
+	t.Cleanup(httpServer.Close)
+
+	dialer := websocket.Dialer{Subprotocols: []string{gql.Protocol}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http")+"/graphql", nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn, engine
+}
+
+func receive(t *testing.T, conn *websocket.Conn) message {
+	t.Helper()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var msg message
+	require.NoError(t, conn.ReadJSON(&msg))
+	return msg
+}
+
+func subscribe(t *testing.T, conn *websocket.Conn, id, query string) {
+	t.Helper()
+	payload, err := json.Marshal(gql.Request{Query: query})
+	require.NoError(t, err)
+	require.NoError(t, conn.WriteJSON(message{ID: id, Type: "subscribe", Payload: payload}))
+}
+
+func TestSubscriptions(t *testing.T) {
+	conn, engine := dial(t)
+	require.NoError(t, conn.WriteJSON(message{Type: "connection_init"}))
+	assert.Equal(t, "connection_ack", receive(t, conn).Type)
+
+	subscribe(t, conn, "1", `subscription { userCreated(filter: {username_startswith: "j"}) { username } }`)
+	subscribe(t, conn, "2", `subscription { userDeleted }`)
+	time.Sleep(100 * time.Millisecond) // let the subscriptions start
+
+	var ids []string
+	for _, name := range []string{"mary", "jane"} {
+		resp := post(t, engine, `mutation($input: UserInput!) { createUser(input: $input) { id } }`,
+			map[string]interface{}{"input": map[string]interface{}{"username": name, "email": name + "@example.com"}})
+		require.Empty(t, resp.Errors)
+		var created struct{ ID string }
+		require.NoError(t, json.Unmarshal(resp.Data["createUser"], &created))
+		ids = append(ids, created.ID)
+	}
+
+	// mary doesn't match the filter
+	msg := receive(t, conn)
+	assert.Equal(t, message{ID: "1", Type: "next", Payload: msg.Payload}, msg)
+	assert.JSONEq(t, `{"data": {"userCreated": {"username": "jane"}}}`, string(msg.Payload))
+
+	require.NoError(t, conn.WriteJSON(message{ID: "1", Type: "complete"}))
+	post(t, engine, `mutation($id: ID!) { deleteUser(id: $id) }`, map[string]interface{}{"id": ids[0]})
+	msg = receive(t, conn)
+	assert.Equal(t, "2", msg.ID)
+	assert.JSONEq(t, `{"data": {"userDeleted": "`+ids[0]+`"}}`, string(msg.Payload))
+
+	// invalid operations are rejected with an error message, queries work too
+	subscribe(t, conn, "3", `subscription { userDeleted { id } }`)
+	assert.Equal(t, "error", receive(t, conn).Type)
+	subscribe(t, conn, "4", `{ user(id: "`+ids[1]+`") { username } }`)
+	msg = receive(t, conn)
+	assert.JSONEq(t, `{"data": {"user": {"username": "jane"}}}`, string(msg.Payload))
+	assert.Equal(t, message{ID: "4", Type: "complete"}, receive(t, conn))
+
+	// subscriptions need a WebSocket
+	resp := post(t, engine, `subscription { userDeleted }`, nil)
+	require.Len(t, resp.Errors, 1)
+}
+
+func TestSubscribeBeforeInit(t *testing.T) {
+	conn, _ := dial(t)
+	subscribe(t, conn, "1", `subscription { userDeleted }`)
+	_, _, err := conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, 4401, closeErr.Code)
+}
@@ -0,0 +1,276 @@
+package gql
+
+import (
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/graphql-go/graphql"
+	"github.com/seebasoft/prompter/goback/filter"
+	"github.com/seebasoft/prompter/goback/registry"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	objectIDType = reflect.TypeOf(primitive.ObjectID{})
+)
+
+// types derives GraphQL types from Go types, creating each named type once.
+type types struct {
+	outputs map[reflect.Type]*graphql.Object
+	inputs  map[reflect.Type]*graphql.InputObject
+}
+
+func newTypes() *types {
+	return &types{
+		outputs: make(map[reflect.Type]*graphql.Object),
+		inputs:  make(map[reflect.Type]*graphql.InputObject),
+	}
+}
+
+// typeName is the GraphQL name of a resource's Item type, e.g. "User".
+func typeName(res *registry.Resource) string {
+	return reflect.TypeOf(res.Item).Elem().Name()
+}
+
+// lowerFirst turns a type name into a field name, e.g. "User" into "user".
+func lowerFirst(name string) string {
+	runes := []rune(name)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+// scalar returns the scalar type of t, or nil if t isn't a scalar.
+func scalar(t reflect.Type) *graphql.Scalar {
+	switch t {
+	case timeType:
+		return graphql.DateTime
+	case objectIDType:
+		return graphql.ID
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return graphql.String
+	case reflect.Bool:
+		return graphql.Boolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return graphql.Int
+	case reflect.Float32, reflect.Float64:
+		return graphql.Float
+	}
+	return nil
+}
+
+// jsonFields calls fn for the exported, JSON encoded fields of struct t.
+func jsonFields(t reflect.Type, fn func(name string, field reflect.StructField)) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fn(name, field)
+	}
+}
+
+// output returns the type of values of t. Pointers, slices and maps can be
+// null; other values can't. Maps have no GraphQL equivalent and give nil.
+func (b *types) output(t reflect.Type) graphql.Output {
+	nullable := false
+	if t.Kind() == reflect.Ptr {
+		t, nullable = t.Elem(), true
+	}
+
+	var out graphql.Output
+	if s := scalar(t); s != nil {
+		out = s
+	} else {
+		switch t.Kind() {
+		case reflect.Slice, reflect.Array:
+			elem := b.output(t.Elem())
+			if elem == nil {
+				return nil
+			}
+			out, nullable = graphql.NewList(elem), t.Kind() == reflect.Slice
+		case reflect.Struct:
+			out = b.object(t, t.Name(), nil)
+		default:
+			return nil
+		}
+	}
+	if nullable {
+		return out
+	}
+	return graphql.NewNonNull(out)
+}
+
+// object returns the object type of struct t, leaving out the fields hide
+// reports. Fields resolve straight from the struct, so Items don't need
+// anything beyond their json tags.
+func (b *types) object(t reflect.Type, name string, hide func(jsonName string) bool) *graphql.Object {
+	return b.objectWith(t, graphql.ObjectConfig{Name: name}, hide, nil)
+}
+
+// objectWith is object with the name and interfaces of config, and fields
+// that replace the ones derived from t.
+func (b *types) objectWith(t reflect.Type, config graphql.ObjectConfig, hide func(jsonName string) bool, overrides graphql.Fields) *graphql.Object {
+	if object, ok := b.outputs[t]; ok {
+		return object
+	}
+	fields := graphql.Fields{}
+	// Thunk, so self-referencing structs don't recurse forever
+	config.Fields = graphql.FieldsThunk(func() graphql.Fields { return fields })
+	object := graphql.NewObject(config)
+	b.outputs[t] = object
+
+	jsonFields(t, func(jsonName string, field reflect.StructField) {
+		if hide != nil && hide(jsonName) {
+			return
+		}
+		if out := b.output(field.Type); out != nil {
+			fields[jsonName] = &graphql.Field{Type: out, Resolve: resolveField(field.Index)}
+		}
+	})
+	for name, field := range overrides {
+		fields[name] = field
+	}
+	return object
+}
+
+// resolveField reads a struct field from the source value.
+func resolveField(index []int) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		v := reflect.ValueOf(p.Source)
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return nil, nil
+			}
+			v = v.Elem()
+		}
+		return fieldValue(v.FieldByIndex(index)), nil
+	}
+}
+
+// fieldValue converts a field to what its GraphQL type serializes.
+func fieldValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+	}
+	if v.Type() == objectIDType {
+		return v.Interface().(primitive.ObjectID).Hex()
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem() == objectIDType {
+		ids := make([]string, v.Len())
+		for i := range ids {
+			ids[i] = v.Index(i).Interface().(primitive.ObjectID).Hex()
+		}
+		return ids
+	}
+	return v.Interface()
+}
+
+// input returns the input type of values of t. Every input field is optional
+// so the same type serves creates and merge updates; missing required fields
+// are reported by validation.
+func (b *types) input(t reflect.Type) graphql.Input {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if s := scalar(t); s != nil {
+		return s
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		if elem := b.input(t.Elem()); elem != nil {
+			return graphql.NewList(graphql.NewNonNull(elem))
+		}
+	case reflect.Struct:
+		return b.inputObject(t, t.Name()+"Input", nil)
+	}
+	return nil
+}
+
+// inputObject returns the input type of struct t, leaving out the fields
+// skip reports.
+func (b *types) inputObject(t reflect.Type, name string, skip func(jsonName string) bool) *graphql.InputObject {
+	if object, ok := b.inputs[t]; ok {
+		return object
+	}
+	fields := graphql.InputObjectConfigFieldMap{}
+	object := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:   name,
+		Fields: graphql.InputObjectConfigFieldMapThunk(func() graphql.InputObjectConfigFieldMap { return fields }),
+	})
+	b.inputs[t] = object
+
+	jsonFields(t, func(jsonName string, field reflect.StructField) {
+		if skip != nil && skip(jsonName) {
+			return
+		}
+		if in := b.input(field.Type); in != nil {
+			fields[jsonName] = &graphql.InputObjectFieldConfig{Type: in}
+		}
+	})
+	return object
+}
+
+// filterInput returns the filter argument type of a resource: one field per
+// filter parameter, e.g. "username_startswith", typed like the field it
+// filters. Write-only fields can't be filtered on, and neither can keys,
+// which clients only know as global IDs.
+func filterInput(res *registry.Resource) *graphql.InputObject {
+	fields := graphql.InputObjectConfigFieldMap{}
+	for _, param := range filter.Params(res.Item, res.IsWriteOnly) {
+		bsonName, _, _ := strings.Cut(param.Field.Tag.Get("bson"), ",")
+		if bsonName == "_id" {
+			continue
+		}
+		t := param.Field.Type
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		var in graphql.Input = graphql.String
+		switch {
+		case param.Operator == "between":
+			in = graphql.NewList(graphql.NewNonNull(graphql.DateTime))
+		case t == timeType:
+			in = graphql.DateTime
+		case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+			in = graphql.Float
+		}
+		fields[param.Name] = &graphql.InputObjectFieldConfig{Type: in}
+	}
+	return graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:   typeName(res) + "Filter",
+		Fields: fields,
+	})
+}
+
+// sortEnum returns the sort argument type of a resource: its filterable
+// fields by JSON name for ascending order, with a "_desc" suffix for
+// descending. Cursors hold the sorted values, so only readable fields can be
+// sorted on.
+func sortEnum(res *registry.Resource) *graphql.Enum {
+	values := graphql.EnumValueConfigMap{}
+	for _, param := range filter.Params(res.Item, res.IsWriteOnly) {
+		bsonName, _, _ := strings.Cut(param.Field.Tag.Get("bson"), ",")
+		if param.Operator != "eq" || bsonName == "_id" {
+			continue
+		}
+		values[param.Name] = &graphql.EnumValueConfig{Value: bsonName}
+		values[param.Name+"_desc"] = &graphql.EnumValueConfig{Value: "-" + bsonName}
+	}
+	return graphql.NewEnum(graphql.EnumConfig{
+		Name:   typeName(res) + "Sort",
+		Values: values,
+	})
+}
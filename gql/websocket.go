@@ -0,0 +1,254 @@
+package gql
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/seebasoft/prompter/goback/logging"
+)
+
+// Protocol is the WebSocket subprotocol subscriptions are served with,
+// https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md
+const Protocol = "graphql-transport-ws"
+
+// Message types of the protocol.
+const (
+	msgConnectionInit = "connection_init"
+	msgConnectionAck  = "connection_ack"
+	msgPing           = "ping"
+	msgPong           = "pong"
+	msgSubscribe      = "subscribe"
+	msgNext           = "next"
+	msgError          = "error"
+	msgComplete       = "complete"
+)
+
+// Close codes of the protocol, plus 1013 for clients too slow to keep up.
+const (
+	closeInvalidMessage   = 4400
+	closeUnauthorized     = 4401
+	closeBadProtocol      = 4406
+	closeInitTimeout      = 4408
+	closeSubscriberExists = 4409
+	closeTooManyInits     = 4429
+	closeTooSlow          = websocket.CloseTryAgainLater
+)
+
+const (
+	// connectionInitTimeout is how long clients have to send connection_init.
+	connectionInitTimeout = 10 * time.Second
+	// sendBuffer is how many messages a client may fall behind. Clients that
+	// fall further behind are disconnected rather than holding up the change
+	// feed; they can reconnect and query what they missed.
+	sendBuffer   = 64
+	writeTimeout = 10 * time.Second
+)
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+var upgrader = websocket.Upgrader{Subprotocols: []string{Protocol}}
+
+// wsConn is one WebSocket connection. Its reader runs in the handler, a
+// writer goroutine drains the send queue and every subscription runs in its
+// own goroutine.
+type wsConn struct {
+	server *Server
+	ws     *websocket.Conn
+	ctx    context.Context
+	cancel context.CancelFunc
+	send   chan wsMessage
+	wg     sync.WaitGroup
+
+	mu            sync.Mutex
+	initialized   bool
+	acknowledged  bool
+	subscriptions map[string]context.CancelFunc
+	closeOnce     sync.Once
+}
+
+// serveWebSocket serves subscriptions, queries and mutations over a
+// WebSocket until the client goes away.
+func (s *Server) serveWebSocket(c *gin.Context) {
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return // Upgrade has answered the request
+	}
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	conn := &wsConn{
+		server:        s,
+		ws:            ws,
+		ctx:           ctx,
+		cancel:        cancel,
+		send:          make(chan wsMessage, sendBuffer),
+		subscriptions: make(map[string]context.CancelFunc),
+	}
+	if ws.Subprotocol() != Protocol {
+		conn.close(closeBadProtocol, "Subprotocol not acceptable")
+		return
+	}
+
+	go conn.write()
+	initTimer := time.AfterFunc(connectionInitTimeout, func() {
+		conn.mu.Lock()
+		defer conn.mu.Unlock()
+		if !conn.acknowledged {
+			conn.close(closeInitTimeout, "Connection initialisation timeout")
+		}
+	})
+	defer initTimer.Stop()
+	conn.read()
+	conn.close(websocket.CloseNormalClosure, "")
+	conn.wg.Wait()
+}
+
+func (c *wsConn) read() {
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg wsMessage
+		if err := json.Unmarshal(data, &msg); err != nil || msg.Type == "" {
+			c.close(closeInvalidMessage, "Invalid message received")
+			return
+		}
+
+		switch msg.Type {
+		case msgConnectionInit:
+			c.mu.Lock()
+			repeated := c.initialized
+			c.initialized, c.acknowledged = true, true
+			c.mu.Unlock()
+			if repeated {
+				c.close(closeTooManyInits, "Too many initialisation requests")
+				return
+			}
+			c.enqueue(wsMessage{Type: msgConnectionAck})
+		case msgPing:
+			c.enqueue(wsMessage{Type: msgPong})
+		case msgPong:
+		case msgSubscribe:
+			if !c.subscribe(msg) {
+				return
+			}
+		case msgComplete:
+			c.mu.Lock()
+			if cancel, ok := c.subscriptions[msg.ID]; ok {
+				cancel()
+				delete(c.subscriptions, msg.ID)
+			}
+			c.mu.Unlock()
+		default:
+			c.close(closeInvalidMessage, "Invalid message received")
+			return
+		}
+	}
+}
+
+// subscribe starts an operation, reporting false if the connection had to be
+// closed instead.
+func (c *wsConn) subscribe(msg wsMessage) bool {
+	var req Request
+	if msg.ID == "" || json.Unmarshal(msg.Payload, &req) != nil {
+		c.close(closeInvalidMessage, "Invalid message received")
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.acknowledged {
+		c.close(closeUnauthorized, "Unauthorized")
+		return false
+	}
+	if _, ok := c.subscriptions[msg.ID]; ok {
+		c.close(closeSubscriberExists, "Subscriber for "+msg.ID+" already exists")
+		return false
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.subscriptions[msg.ID] = cancel
+	c.wg.Add(1)
+	go c.run(ctx, cancel, msg.ID, req)
+	return true
+}
+
+// run executes an operation, sending its results until it ends or the
+// client completes it.
+func (c *wsConn) run(ctx context.Context, cancel context.CancelFunc, id string, req Request) {
+	defer c.wg.Done()
+	defer cancel()
+
+	results, errs := c.server.execute(ctx, req)
+	if errs != nil {
+		c.enqueue(wsMessage{ID: id, Type: msgError, Payload: marshal(errs)})
+	} else {
+		// Drain results even once cancelled; graphql-go blocks until read
+		for result := range results {
+			if ctx.Err() == nil {
+				c.enqueue(wsMessage{ID: id, Type: msgNext, Payload: marshal(result)})
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.subscriptions[id]; ok && ctx.Err() == nil {
+		delete(c.subscriptions, id)
+		if errs == nil {
+			c.enqueue(wsMessage{ID: id, Type: msgComplete})
+		}
+	}
+}
+
+// enqueue queues a message without blocking, disconnecting clients that
+// don't keep up.
+func (c *wsConn) enqueue(msg wsMessage) {
+	select {
+	case <-c.ctx.Done():
+	case c.send <- msg:
+	default:
+		logging.FromContext(c.ctx).Warn("disconnecting slow GraphQL subscriber", "queued", len(c.send))
+		c.close(closeTooSlow, "Client too slow")
+	}
+}
+
+func (c *wsConn) write() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case msg := <-c.send:
+			c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.ws.WriteJSON(msg); err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		}
+	}
+}
+
+// close ends the connection and every operation on it.
+func (c *wsConn) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.cancel()
+		if code != websocket.CloseAbnormalClosure {
+			c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeTimeout))
+		}
+		c.ws.Close()
+	})
+}
+
+func marshal(v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(gqlerrors.FormatErrors(err))
+	}
+	return data
+}
@@ -0,0 +1,22 @@
+// Package backoff computes the delays between retries.
+package backoff
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Delay returns how long to wait before retry number attempt, counting from
+// 1: base doubled per attempt up to maxDelay, with jitter in the upper half
+// so concurrent retries don't run in lockstep.
+func Delay(attempt int, base, maxDelay time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay > 0 && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay <= 0 || delay > maxDelay {
+		delay = maxDelay
+	}
+	half := int64(delay) / 2
+	return time.Duration(half + rand.Int63n(half+1))
+}
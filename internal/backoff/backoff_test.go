@@ -0,0 +1,18 @@
+package backoff_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/internal/backoff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDelay(t *testing.T) {
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 100: 5 * time.Second} {
+		delay := backoff.Delay(attempt, time.Second, 5*time.Second)
+		assert.GreaterOrEqual(t, delay, want/2, "attempt %d", attempt)
+		assert.LessOrEqual(t, delay, want, "attempt %d", attempt)
+	}
+	assert.Zero(t, backoff.Delay(1, time.Second, 0))
+}
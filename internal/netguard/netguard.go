@@ -0,0 +1,94 @@
+// Package netguard keeps requests to user-supplied URLs, such as webhook
+// deliveries, away from internal networks.
+package netguard
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// nonPublic lists ranges not covered by the net.IP predicates Public uses.
+var nonPublic = []*net.IPNet{
+	mustCIDR("0.0.0.0/8"),     // "this network"
+	mustCIDR("100.64.0.0/10"), // carrier-grade NAT
+	mustCIDR("192.0.0.0/24"),  // IETF protocol assignments
+	mustCIDR("198.18.0.0/15"), // benchmarking
+}
+
+func mustCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// Public reports whether ip is reachable on the internet, i.e. not a
+// loopback, private, link-local, unspecified or multicast address.
+func Public(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, network := range nonPublic {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL returns an error unless rawURL is an http or https URL whose host
+// is, or only resolves to, public addresses. Hosts that don't resolve yet are
+// accepted; Control checks the addresses actually dialled.
+func CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("parsing url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme %q isn't http or https", u.Scheme)
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		return checkIP(ip)
+	}
+	if host == "" || host == "localhost" {
+		return fmt.Errorf("host %q isn't public", host)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if err := checkIP(addr.IP); err != nil {
+			return fmt.Errorf("host %s: %w", host, err)
+		}
+	}
+	return nil
+}
+
+func checkIP(ip net.IP) error {
+	if !Public(ip) {
+		return fmt.Errorf("address %s isn't public", ip)
+	}
+	return nil
+}
+
+// Control is a net.Dialer Control function refusing connections to addresses
+// that aren't public. Checking at dial time also covers redirects and DNS
+// answers that changed since CheckURL.
+func Control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	return checkIP(net.ParseIP(host))
+}
@@ -0,0 +1,43 @@
+package netguard_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/internal/netguard"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckURL(t *testing.T) {
+	ctx := context.Background()
+	for _, rawURL := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://[::1]/hook",
+		"https://10.1.2.3/hook",
+		"https://192.168.0.10/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[fe80::1]/hook",
+		"http://0.0.0.0/hook",
+		"http://100.64.0.1/hook",
+		"http://localhost/hook",
+		"ftp://example.com/hook",
+	} {
+		assert.Error(t, netguard.CheckURL(ctx, rawURL), rawURL)
+	}
+	assert.NoError(t, netguard.CheckURL(ctx, "https://8.8.8.8/hook"))
+	assert.NoError(t, netguard.CheckURL(ctx, "https://[2001:4860:4860::8888]/hook"))
+}
+
+func TestControl(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dialer := &net.Dialer{Timeout: time.Second, Control: netguard.Control}
+	client := &http.Client{Transport: &http.Transport{DialContext: dialer.DialContext}}
+	_, err := client.Get(server.URL)
+	assert.ErrorContains(t, err, "isn't public")
+}
@@ -0,0 +1,97 @@
+// Package logging provides the structured (log/slog) loggers used across the
+// service: per-request loggers carried in the context, request IDs, and
+// redaction of sensitive fields.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Redacted replaces the value of sensitive fields.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are matched case-insensitively against attribute keys, body
+// and filter field names (the last segment of dotted paths) and headers.
+var sensitiveKeys = map[string]bool{
+	"email":         true,
+	"password":      true,
+	"authorization": true,
+	"cookie":        true,
+	"secret":        true,
+	"token":         true,
+}
+
+// IsSensitive reports whether a field or header name holds data that must
+// not be logged.
+func IsSensitive(key string) bool {
+	if i := strings.LastIndexByte(key, '.'); i >= 0 {
+		key = key[i+1:]
+	}
+	return sensitiveKeys[strings.ToLower(key)]
+}
+
+// New creates a logger writing JSON or text records at the given level, with
+// sensitive attributes redacted.
+func New(w io.Writer, level slog.Leveler, json bool) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	if json {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+func redactAttr(groups []string, attr slog.Attr) slog.Attr {
+	if IsSensitive(attr.Key) {
+		return slog.String(attr.Key, Redacted)
+	}
+	if attr.Value.Kind() == slog.KindAny {
+		attr.Value = slog.AnyValue(Redact(attr.Value.Any()))
+	}
+	return attr
+}
+
+// Setup installs a default logger writing to stderr at level, as JSON or
+// text.
+func Setup(level slog.Level, json bool) *slog.Logger {
+	logger := New(os.Stderr, level, json)
+	slog.SetDefault(logger)
+	return logger
+}
+
+type loggerKey struct{}
+type requestIDKey struct{}
+
+// WithLogger returns a context carrying logger.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the request logger, or the default logger outside a
+// request.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// WithRequestID returns a context carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID of the request ctx belongs to, if any.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Fatal logs an error with the default logger and exits.
+func Fatal(msg string, args ...interface{}) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,65 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/seebasoft/prompter/goback/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRedact(t *testing.T) {
+	filter := bson.M{"username": "jdoe", "$or": []bson.M{{"email": "a@b.c"}, {"profile.password": "x"}}}
+	assert.Equal(t, bson.M{"username": "jdoe", "$or": []bson.M{{"email": logging.Redacted}, {"profile.password": logging.Redacted}}}, logging.Redact(filter))
+
+	assert.JSONEq(t, `{"username":"jdoe","Email":"[REDACTED]"}`, logging.RedactJSON([]byte(`{"username":"jdoe","Email":"a@b.c"}`)))
+	assert.Equal(t, logging.Redacted, logging.RedactJSON([]byte("not json")))
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var out bytes.Buffer
+	engine := gin.New()
+	engine.Use(logging.Middleware(logging.New(&out, slog.LevelDebug, true)))
+	var handlerRequestID string
+	engine.POST("/users", func(c *gin.Context) {
+		handlerRequestID = logging.RequestID(c.Request.Context())
+		logging.FromContext(c.Request.Context()).Info("creating user")
+		c.Status(http.StatusCreated)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"username":"jdoe","email":"a@b.c"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set(logging.RequestIDHeader, "req-42")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+
+	assert.Equal(t, "req-42", w.Header().Get(logging.RequestIDHeader))
+	assert.Equal(t, "req-42", handlerRequestID)
+	assert.NotContains(t, out.String(), "a@b.c")
+	assert.NotContains(t, out.String(), "Bearer")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[2]), &record))
+	assert.Equal(t, "request", record["msg"])
+	assert.Equal(t, "req-42", record["requestId"])
+	assert.Equal(t, float64(http.StatusCreated), record["status"])
+
+	// Invalid IDs are replaced
+	req = httptest.NewRequest(http.MethodPost, "/users", nil)
+	req.Header.Set(logging.RequestIDHeader, "bad id\n")
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	assert.Len(t, w.Header().Get(logging.RequestIDHeader), 32)
+}
@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the request ID in requests and responses.
+const RequestIDHeader = "X-Request-ID"
+
+// maxLoggedBody caps request bodies logged at debug level.
+const maxLoggedBody = 4096
+
+// Incoming request IDs are reused only if they look like IDs, so clients
+// can't inject arbitrary text into the logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// NewRequestID returns a random 128-bit hex ID.
+func NewRequestID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// Middleware gives every request an ID, taken from the X-Request-ID header or
+// generated, echoes it in the response, and puts a logger tagged with it (and
+// the trace ID, when tracing) into the request context. Each request is logged
+// once it completes; at debug level the redacted JSON body is logged too.
+func Middleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		ctx := c.Request.Context()
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = NewRequestID()
+		}
+		c.Header(RequestIDHeader, requestID)
+
+		reqLogger := logger.With("requestId", requestID)
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+			reqLogger = reqLogger.With("traceId", spanContext.TraceID().String())
+		}
+		ctx = WithLogger(WithRequestID(ctx, requestID), reqLogger)
+		c.Request = c.Request.WithContext(ctx)
+
+		if reqLogger.Enabled(ctx, slog.LevelDebug) {
+			logBody(c, reqLogger)
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("clientIp", c.ClientIP()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+		reqLogger.LogAttrs(ctx, level, "request", attrs...)
+	}
+}
+
+// logBody logs a JSON request body and puts it back for the handler.
+func logBody(c *gin.Context, logger *slog.Logger) {
+	if c.Request.Body == nil || !strings.HasPrefix(c.ContentType(), "application/json") {
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil || len(body) == 0 {
+		return
+	}
+	logged := Redacted
+	if len(body) <= maxLoggedBody {
+		logged = RedactJSON(body)
+	}
+	logger.DebugContext(c.Request.Context(), "request body",
+		slog.String("body", logged), slog.Any("headers", c.Request.Header))
+}
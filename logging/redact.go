@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Redact returns a copy of a body, filter or header set with the values of
+// sensitive fields replaced. It understands JSON-like maps and slices, BSON
+// documents and http.Header; anything else is returned as is.
+func Redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return redactMap(v)
+	case bson.M:
+		return bson.M(redactMap(v))
+	case bson.D:
+		redacted := make(bson.D, len(v))
+		for i, elem := range v {
+			redacted[i] = bson.E{Key: elem.Key, Value: redactField(elem.Key, elem.Value)}
+		}
+		return redacted
+	case []bson.M:
+		redacted := make([]bson.M, len(v))
+		for i, elem := range v {
+			redacted[i] = redactMap(elem)
+		}
+		return redacted
+	case bson.A:
+		return bson.A(redactSlice(v))
+	case []interface{}:
+		return redactSlice(v)
+	case http.Header:
+		redacted := make(http.Header, len(v))
+		for key, values := range v {
+			if IsSensitive(key) {
+				values = []string{Redacted}
+			}
+			redacted[key] = values
+		}
+		return redacted
+	}
+	return value
+}
+
+// RedactJSON redacts a JSON document. Bodies that aren't JSON are replaced
+// entirely, since there's no telling what they contain.
+func RedactJSON(body []byte) string {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return Redacted
+	}
+	redacted, err := json.Marshal(Redact(doc))
+	if err != nil {
+		return Redacted
+	}
+	return string(redacted)
+}
+
+func redactMap(m map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		redacted[key] = redactField(key, value)
+	}
+	return redacted
+}
+
+func redactField(key string, value interface{}) interface{} {
+	if IsSensitive(key) {
+		return Redacted
+	}
+	return Redact(value)
+}
+
+func redactSlice(s []interface{}) []interface{} {
+	redacted := make([]interface{}, len(s))
+	for i, elem := range s {
+		redacted[i] = Redact(elem)
+	}
+	return redacted
+}
@@ -0,0 +1,117 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/dal"
+)
+
+// store is a dal.Store decorator logging every operation with the request
+// logger from the context: at debug level when it succeeds, at warn level
+// when it fails for a reason other than not found.
+type store struct {
+	dal.Store
+}
+
+// NewStore wraps a Store with operation logging.
+func NewStore(inner dal.Store) dal.Store {
+	return &store{Store: inner}
+}
+
+func logOperation(ctx context.Context, op string, item dal.Item, start time.Time, err error, attrs ...slog.Attr) {
+	logger := FromContext(ctx)
+	level := slog.LevelDebug
+	if err != nil && !errors.Is(err, dal.ErrNotFound) {
+		level = slog.LevelWarn
+	}
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	attrs = append(attrs,
+		slog.String("op", op),
+		slog.String("namespace", item.Namespace()),
+		slog.String("group", item.ItemGroup()),
+		slog.Duration("duration", time.Since(start)),
+	)
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	logger.LogAttrs(ctx, level, "store operation", attrs...)
+}
+
+func (s *store) Create(ctx context.Context, item dal.Item) (dal.Item, error) {
+	start := time.Now()
+	created, err := s.Store.Create(ctx, item)
+	logOperation(ctx, "Create", item, start, err)
+	return created, err
+}
+
+func (s *store) ReadByKey(ctx context.Context, key interface{}, item dal.Item) error {
+	start := time.Now()
+	err := s.Store.ReadByKey(ctx, key, item)
+	logOperation(ctx, "ReadByKey", item, start, err, slog.Any("key", key))
+	return err
+}
+
+func (s *store) ReadByKeys(ctx context.Context, keys []interface{}, itemType dal.Item) ([]dal.Item, error) {
+	start := time.Now()
+	items, err := s.Store.ReadByKeys(ctx, keys, itemType)
+	logOperation(ctx, "ReadByKeys", itemType, start, err, slog.Int("keys", len(keys)), slog.Int("found", found(items)))
+	return items, err
+}
+
+// found counts the items ReadByKeys found.
+func found(items []dal.Item) int {
+	n := 0
+	for _, item := range items {
+		if item != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *store) ReadByFilter(ctx context.Context, opts dal.QueryOptions, itemType dal.Item) (dal.ItemIterator, error) {
+	start := time.Now()
+	iter, err := s.Store.ReadByFilter(ctx, opts, itemType)
+	var attrs []slog.Attr
+	if opts != nil {
+		if filter := opts.GetFilter(); filter != nil {
+			attrs = append(attrs, slog.Any("filter", Redact(filter.ToNative())))
+		}
+		attrs = append(attrs, slog.Int64("limit", opts.GetLimit()), slog.Int64("skip", opts.GetSkip()))
+	}
+	logOperation(ctx, "ReadByFilter", itemType, start, err, attrs...)
+	return iter, err
+}
+
+func (s *store) UpdateByKey(ctx context.Context, key interface{}, item dal.Item) (int64, error) {
+	start := time.Now()
+	count, err := s.Store.UpdateByKey(ctx, key, item)
+	logOperation(ctx, "UpdateByKey", item, start, err, slog.Any("key", key), slog.Int64("count", count))
+	return count, err
+}
+
+func (s *store) DeleteByKey(ctx context.Context, key interface{}, itemType dal.Item) (int64, error) {
+	start := time.Now()
+	count, err := s.Store.DeleteByKey(ctx, key, itemType)
+	logOperation(ctx, "DeleteByKey", itemType, start, err, slog.Any("key", key), slog.Int64("count", count))
+	return count, err
+}
+
+func (s *store) RestoreByKey(ctx context.Context, key interface{}, itemType dal.Item) (int64, error) {
+	start := time.Now()
+	count, err := s.Store.RestoreByKey(ctx, key, itemType)
+	logOperation(ctx, "RestoreByKey", itemType, start, err, slog.Any("key", key), slog.Int64("count", count))
+	return count, err
+}
+
+func (s *store) PurgeByKey(ctx context.Context, key interface{}, itemType dal.Item) (int64, error) {
+	start := time.Now()
+	count, err := s.Store.PurgeByKey(ctx, key, itemType)
+	logOperation(ctx, "PurgeByKey", itemType, start, err, slog.Any("key", key), slog.Int64("count", count))
+	return count, err
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"github.com/seebasoft/prompter/goback/registry"
+)
+
+// auditFields are set by the Store, never by clients.
+var auditFields = []string{"id", "createdAt", "createdBy", "updatedAt", "updatedBy"}
+
+// Resources returns the registry of Items served by the APIs.
+func Resources() (*registry.Registry, error) {
+	resources := registry.New()
+	if _, err := resources.Register(&User{}, registry.Options{
+		Description:    "People using the prompter.",
+		ReadOnlyFields: append(auditFields, "deletedAt"),
+	}); err != nil {
+		return nil, err
+	}
+	if _, err := resources.Register(&Webhook{}, registry.Options{
+		Description:     "Partner subscriptions to change events.",
+		Operations:      []registry.Operation{registry.OpCreate, registry.OpRead, registry.OpList, registry.OpUpdate, registry.OpDelete},
+		ReadOnlyFields:  auditFields,
+		WriteOnlyFields: []string{"secret"},
+	}); err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
@@ -11,9 +11,14 @@ import (
 
 type User struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Username  string             `bson:"username" json:"username"`
-	Email     string             `bson:"email" json:"email"`
+	Username  string             `bson:"username" json:"username" validate:"required,min=3,max=20,alphanum"`
+	Email     string             `bson:"email" json:"email" validate:"required,email"`
 	Birthdate time.Time          `bson:"birthdate" json:"birthdate"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	CreatedBy string             `bson:"createdBy,omitempty" json:"createdBy,omitempty"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+	UpdatedBy string             `bson:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+	DeletedAt *time.Time         `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
 }
 
 func (u *User) Namespace() string {
@@ -24,6 +29,21 @@ func (u *User) ItemGroup() string {
 	return "users"
 }
 
+// Indexes declares the unique constraints on users. They include deletedAt,
+// which users that aren't soft deleted lack and index as null, so a deleted
+// user's username and email can be reused.
+func (u *User) Indexes() []dal.Index {
+	return []dal.Index{
+		{Fields: []dal.IndexField{dal.Asc("username"), dal.Asc(dal.DeletedAtField)}, Unique: true},
+		{Fields: []dal.IndexField{dal.Asc("email"), dal.Asc(dal.DeletedAtField)}, Unique: true},
+	}
+}
+
+// RetiredIndexes names the unique indexes that covered deleted users too.
+func (u *User) RetiredIndexes() []string {
+	return []string{"username_1", "email_1"}
+}
+
 func (u *User) Marshal() ([]byte, error) {
 	return bson.Marshal(u)
 }
@@ -61,6 +81,28 @@ func (u *User) GetKey() interface{} {
 	return u.ID
 }	
 
+func (u *User) GetAuditInfo() dal.AuditInfo {
+	return dal.AuditInfo{CreatedAt: u.CreatedAt, CreatedBy: u.CreatedBy, UpdatedAt: u.UpdatedAt, UpdatedBy: u.UpdatedBy}
+}
+
+func (u *User) SetAuditInfo(info dal.AuditInfo) {
+	u.CreatedAt, u.CreatedBy = info.CreatedAt, info.CreatedBy
+	u.UpdatedAt, u.UpdatedBy = info.UpdatedAt, info.UpdatedBy
+}
+
+// TrackHistory keeps a revision history of every user.
+func (u *User) TrackHistory() bool {
+	return true
+}
+
+func (u *User) GetDeletedAt() *time.Time {
+	return u.DeletedAt
+}
+
+func (u *User) SetDeletedAt(deletedAt *time.Time) {
+	u.DeletedAt = deletedAt
+}
+
 var ErrInvalidKey = errors.New("invalid key")
 
 func (u *User) SetKey(key interface{}) error {
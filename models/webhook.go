@@ -0,0 +1,153 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/internal/netguard"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Webhook is a partner subscription to resource change events. Events are
+// "<resource>.<action>" names such as "users.created"; "users.*" and "*" are
+// wildcards.
+type Webhook struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	URL         string             `bson:"url" json:"url" validate:"required,url"`
+	Events      []string           `bson:"events" json:"events" validate:"required,min=1"`
+	Secret      string             `bson:"secret" json:"secret" validate:"required,min=16"`
+	Active      bool               `bson:"active" json:"active"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	CreatedBy   string             `bson:"createdBy,omitempty" json:"createdBy,omitempty"`
+	UpdatedAt   time.Time          `bson:"updatedAt" json:"updatedAt"`
+	UpdatedBy   string             `bson:"updatedBy,omitempty" json:"updatedBy,omitempty"`
+}
+
+func (w *Webhook) Namespace() string {
+	return "core"
+}
+
+func (w *Webhook) ItemGroup() string {
+	return "webhooks"
+}
+
+// Validate refuses URLs pointing into internal networks, so webhooks can't
+// be used to reach services the API can see but partners shouldn't.
+func (w *Webhook) Validate(ctx context.Context) error {
+	if err := netguard.CheckURL(ctx, w.URL); err != nil {
+		return dal.NewFieldError("url", "public_url", "url must point to a public host: "+err.Error())
+	}
+	return nil
+}
+
+// MarshalJSON leaves the signing secret out of every response and event; it
+// can be set, never read back.
+func (w *Webhook) MarshalJSON() ([]byte, error) {
+	type webhook Webhook
+	masked := webhook(*w)
+	masked.Secret = ""
+	return json.Marshal(struct {
+		webhook
+		Secret string `json:"secret,omitempty"`
+	}{webhook: masked})
+}
+
+func (w *Webhook) Marshal() ([]byte, error) {
+	return bson.Marshal(w)
+}
+
+func (w *Webhook) Unmarshal(raw []byte) error {
+	return bson.Unmarshal(raw, w)
+}
+
+func (w *Webhook) New() dal.Item {
+	return &Webhook{}
+}
+
+func (w *Webhook) GetKey() interface{} {
+	return w.ID
+}
+
+func (w *Webhook) SetKey(key interface{}) error {
+	if id, ok := key.(primitive.ObjectID); ok {
+		w.ID = id
+		return nil
+	}
+	return ErrInvalidKey
+}
+
+func (w *Webhook) GetAuditInfo() dal.AuditInfo {
+	return dal.AuditInfo{CreatedAt: w.CreatedAt, CreatedBy: w.CreatedBy, UpdatedAt: w.UpdatedAt, UpdatedBy: w.UpdatedBy}
+}
+
+func (w *Webhook) SetAuditInfo(info dal.AuditInfo) {
+	w.CreatedAt, w.CreatedBy = info.CreatedAt, info.CreatedBy
+	w.UpdatedAt, w.UpdatedBy = info.UpdatedAt, info.UpdatedBy
+}
+
+// Webhook delivery statuses.
+const (
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed" // attempt failed, will be retried
+	DeliveryDead      = "dead"   // last attempt failed; the delivery is dead-lettered
+)
+
+// WebhookDelivery logs one attempt to deliver an event to a webhook.
+type WebhookDelivery struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	WebhookID   primitive.ObjectID `bson:"webhookId" json:"webhookId"`
+	EventID     string             `bson:"eventId" json:"eventId"`
+	EventType   string             `bson:"eventType" json:"eventType"`
+	Attempt     int                `bson:"attempt" json:"attempt"`
+	Status      string             `bson:"status" json:"status"`
+	StatusCode  int                `bson:"statusCode,omitempty" json:"statusCode,omitempty"`
+	Error       string             `bson:"error,omitempty" json:"error,omitempty"`
+	Payload     string             `bson:"payload" json:"payload"`
+	AttemptedAt time.Time          `bson:"attemptedAt" json:"attemptedAt"`
+}
+
+func (d *WebhookDelivery) Namespace() string {
+	return "core"
+}
+
+func (d *WebhookDelivery) ItemGroup() string {
+	return "webhook_deliveries"
+}
+
+func (d *WebhookDelivery) Marshal() ([]byte, error) {
+	return bson.Marshal(d)
+}
+
+func (d *WebhookDelivery) Unmarshal(raw []byte) error {
+	return bson.Unmarshal(raw, d)
+}
+
+func (d *WebhookDelivery) New() dal.Item {
+	return &WebhookDelivery{}
+}
+
+func (d *WebhookDelivery) GetKey() interface{} {
+	return d.ID
+}
+
+func (d *WebhookDelivery) SetKey(key interface{}) error {
+	if id, ok := key.(primitive.ObjectID); ok {
+		d.ID = id
+		return nil
+	}
+	return ErrInvalidKey
+}
+
+// Indexes supports the delivery log and dead-letter queries, and looking up
+// earlier attempts of an event.
+func (d *WebhookDelivery) Indexes() []dal.Index {
+	return []dal.Index{
+		{Fields: []dal.IndexField{dal.Asc("webhookId"), dal.Asc("eventId")}},
+		{Fields: []dal.IndexField{dal.Asc("webhookId"), dal.Desc("attemptedAt")}},
+		{Fields: []dal.IndexField{dal.Asc("status"), dal.Desc("attemptedAt")}},
+	}
+}
@@ -0,0 +1,412 @@
+// Package openapi generates an OpenAPI 3.1 description of the REST API from
+// the resource registry: schemas from the Items' struct fields, the CRUD
+// paths each resource allows, the filter, sort and pagination parameters
+// ReadByFilter understands, and problem+json error responses.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/filter"
+	"github.com/seebasoft/prompter/goback/problem"
+	"github.com/seebasoft/prompter/goback/registry"
+	"github.com/seebasoft/prompter/goback/rest"
+	"github.com/seebasoft/prompter/goback/schema"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Version is the OpenAPI version of generated documents.
+const Version = "3.1.0"
+
+// Document is an OpenAPI document.
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+// Info describes the API.
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations on a path.
+type PathItem struct {
+	Get    *Operation `json:"get,omitempty"`
+	Put    *Operation `json:"put,omitempty"`
+	Post   *Operation `json:"post,omitempty"`
+	Delete *Operation `json:"delete,omitempty"`
+	Patch  *Operation `json:"patch,omitempty"`
+}
+
+// Operation is a single API call.
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary"`
+	Tags        []string             `json:"tags"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Parameter is a path or query parameter, or a reference to a shared one.
+type Parameter struct {
+	Ref         string  `json:"$ref,omitempty"`
+	Name        string  `json:"name,omitempty"`
+	In          string  `json:"in,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+// RequestBody is the body an operation accepts.
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// MediaType is the schema of a body in one media type.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Response is an operation's response, or a reference to a shared one.
+type Response struct {
+	Ref         string               `json:"$ref,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Headers     map[string]*Header   `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// Header is a response header.
+type Header struct {
+	Description string  `json:"description"`
+	Schema      *Schema `json:"schema"`
+}
+
+// Components holds the definitions operations refer to.
+type Components struct {
+	Schemas    map[string]*Schema    `json:"schemas"`
+	Parameters map[string]*Parameter `json:"parameters"`
+	Responses  map[string]*Response  `json:"responses"`
+}
+
+// Schema is a JSON Schema; OpenAPI 3.1 uses them unchanged.
+type Schema = schema.Schema
+
+const (
+	jsonType       = "application/json"
+	mergePatchType = "application/merge-patch+json"
+)
+
+// errorResponses names the shared problem responses by status.
+var errorResponses = map[int]string{
+	http.StatusBadRequest:          "BadRequest",
+	http.StatusForbidden:           "Forbidden",
+	http.StatusNotFound:            "NotFound",
+	http.StatusMethodNotAllowed:    "MethodNotAllowed",
+	http.StatusConflict:            "Conflict",
+	http.StatusUnprocessableEntity: "ValidationFailed",
+	http.StatusServiceUnavailable:  "Unavailable",
+}
+
+// Generate describes the resources served under basePath.
+func Generate(resources *registry.Registry, basePath string, info Info) *Document {
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   make(map[string]*PathItem),
+		Components: Components{
+			Schemas:    sharedSchemas(),
+			Parameters: sharedParameters(),
+			Responses:  sharedResponses(),
+		},
+	}
+	for _, res := range resources.Resources() {
+		g := &generator{doc: doc, res: res, basePath: basePath}
+		g.addResource()
+	}
+	doc.Paths[path.Join(basePath, "schemas/{resource}")] = &PathItem{Get: &Operation{
+		OperationID: "schemas.read",
+		Summary:     "Read the JSON Schema of a resource",
+		Tags:        []string{"schemas"},
+		Parameters:  []*Parameter{{Name: "resource", In: "path", Required: true, Schema: &Schema{Type: "string"}}},
+		Responses: map[string]*Response{
+			"200":     {Description: "The JSON Schema", Content: map[string]MediaType{schema.ContentType: {Schema: &Schema{Type: "object"}}}},
+			"404":     {Ref: "#/components/responses/NotFound"},
+			"default": {Ref: "#/components/responses/Error"},
+		},
+	}}
+	return doc
+}
+
+// generator adds one resource to a document.
+type generator struct {
+	doc      *Document
+	res      *registry.Resource
+	basePath string
+}
+
+// schemaName is the component name of the resource's schema, e.g. "User".
+func (g *generator) schemaName() string {
+	return reflect.TypeOf(g.res.Item).Elem().Name()
+}
+
+func (g *generator) ref() *Schema {
+	return &Schema{Ref: "#/components/schemas/" + g.schemaName()}
+}
+
+func (g *generator) path(suffix string) *PathItem {
+	p := path.Join(g.basePath, g.res.Name) + suffix
+	item, ok := g.doc.Paths[p]
+	if !ok {
+		item = &PathItem{}
+		g.doc.Paths[p] = item
+	}
+	return item
+}
+
+func (g *generator) operation(op, summary string, statuses ...int) *Operation {
+	operation := &Operation{
+		OperationID: g.res.Name + "." + op,
+		Summary:     summary,
+		Tags:        []string{g.res.Name},
+		Responses:   map[string]*Response{"default": {Ref: "#/components/responses/Error"}},
+	}
+	for _, status := range statuses {
+		operation.Responses[strconv.Itoa(status)] = &Response{Ref: "#/components/responses/" + errorResponses[status]}
+	}
+	if g.res.Authorize != nil {
+		operation.Responses[strconv.Itoa(http.StatusForbidden)] = &Response{Ref: "#/components/responses/Forbidden"}
+	}
+	return operation
+}
+
+func (g *generator) keyParam() *Parameter {
+	keySchema := &Schema{Type: "string"}
+	if g.res.Keys == registry.ObjectIDKeys {
+		keySchema = schema.ForType(reflect.TypeOf(primitive.ObjectID{}))
+	}
+	return &Parameter{Name: "id", In: "path", Required: true, Schema: keySchema}
+}
+
+func (g *generator) body() *RequestBody {
+	return &RequestBody{Required: true, Content: map[string]MediaType{jsonType: {Schema: g.ref()}}}
+}
+
+func jsonResponse(description string, schema *Schema) *Response {
+	return &Response{Description: description, Content: map[string]MediaType{jsonType: {Schema: schema}}}
+}
+
+func sharedRef(name string) *Parameter {
+	return &Parameter{Ref: "#/components/parameters/" + name}
+}
+
+func (g *generator) addResource() {
+	res, item := g.res, g.res.Item
+	name := g.schemaName()
+	component := schema.ForResource(res)
+	// The document's dialect applies, and the component is named already
+	component.Dialect, component.Title = "", ""
+	g.doc.Components.Schemas[name] = component
+	softDeletable := dal.IsSoftDeletable(item)
+
+	if res.Allows(registry.OpList) {
+		op := g.operation("list", "List "+res.Name, http.StatusBadRequest, http.StatusServiceUnavailable)
+		op.Parameters = append(g.filterParams(), sharedRef("sort"), sharedRef("page"), sharedRef("pageSize"), sharedRef("onDecodeError"))
+		if softDeletable {
+			op.Parameters = append(op.Parameters, sharedRef("includeDeleted"))
+		}
+		list := jsonResponse("The matching "+res.Name, &Schema{Type: "array", Items: g.ref()})
+		list.Headers = map[string]*Header{
+			"X-Partial-Result": {Description: "true when items that can't be decoded were skipped", Schema: &Schema{Type: "boolean"}},
+			"X-Skipped-Count":  {Description: "how many items were skipped", Schema: &Schema{Type: "integer"}},
+			"X-Skipped-Items":  {Description: "comma separated keys of the first 20 skipped items", Schema: &Schema{Type: "string"}},
+		}
+		op.Responses["200"] = list
+		g.path("").Get = op
+	}
+	if res.Allows(registry.OpCreate) {
+		op := g.operation("create", "Create a "+name, http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity, http.StatusServiceUnavailable)
+		op.RequestBody = g.body()
+		op.Responses["201"] = jsonResponse("The created "+name, g.ref())
+		g.path("").Post = op
+	}
+	if res.Allows(registry.OpRead) {
+		op := g.operation("read", "Read a "+name, http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable)
+		op.Parameters = []*Parameter{g.keyParam()}
+		if softDeletable {
+			op.Parameters = append(op.Parameters, sharedRef("includeDeleted"))
+		}
+		if res.Allows(registry.OpHistory) {
+			op.Parameters = append(op.Parameters, &Parameter{Name: "asOf", In: "query",
+				Description: "Read the item as it was at this time, from its history",
+				Schema:      &Schema{Type: "string", Format: "date-time"}})
+		}
+		op.Responses["200"] = jsonResponse("The "+name, g.ref())
+		g.path("/{id}").Get = op
+	}
+	if res.Allows(registry.OpUpdate) {
+		op := g.operation("update", "Replace a "+name, http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity, http.StatusServiceUnavailable)
+		op.Parameters = []*Parameter{g.keyParam()}
+		op.RequestBody = g.body()
+		op.Responses["200"] = jsonResponse("The updated "+name, g.ref())
+		g.path("/{id}").Put = op
+
+		op = g.operation("patch", "Update some fields of a "+name, http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity, http.StatusServiceUnavailable)
+		op.Parameters = []*Parameter{g.keyParam()}
+		op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{
+			mergePatchType: {Schema: g.ref()},
+			jsonType:       {Schema: g.ref()},
+		}}
+		op.Responses["200"] = jsonResponse("The updated "+name, g.ref())
+		g.path("/{id}").Patch = op
+	}
+	if res.Allows(registry.OpDelete) {
+		op := g.operation("delete", "Delete a "+name, http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable)
+		op.Parameters = []*Parameter{g.keyParam()}
+		if softDeletable {
+			op.Parameters = append(op.Parameters, &Parameter{Name: "purge", In: "query",
+				Description: "Remove the item for good instead of soft deleting it",
+				Schema:      &Schema{Type: "boolean", Default: false}})
+		}
+		op.Responses["200"] = jsonResponse("How many items were deleted", &Schema{Ref: "#/components/schemas/Message"})
+		g.path("/{id}").Delete = op
+	}
+	if res.Allows(registry.OpRestore) && softDeletable {
+		op := g.operation("restore", "Restore a deleted "+name, http.StatusBadRequest, http.StatusNotFound, http.StatusServiceUnavailable)
+		op.Parameters = []*Parameter{g.keyParam()}
+		op.Responses["200"] = jsonResponse("The restored "+name, g.ref())
+		g.path("/{id}:restore").Post = op
+	}
+	if res.Allows(registry.OpHistory) {
+		op := g.operation("history", "List the revisions of a "+name, http.StatusBadRequest, http.StatusNotFound)
+		op.Parameters = []*Parameter{g.keyParam()}
+		op.Responses["200"] = jsonResponse("The revisions, oldest first", &Schema{Type: "array", Items: &Schema{Ref: "#/components/schemas/Revision"}})
+		g.path("/{id}/history").Get = op
+
+		op = g.operation("revision", "Read a revision of a "+name, http.StatusBadRequest, http.StatusNotFound)
+		op.Parameters = []*Parameter{g.keyParam(), {Name: "rev", In: "path", Required: true, Schema: &Schema{Type: "integer"}}}
+		op.Responses["200"] = jsonResponse("The revision with the item as it was", &Schema{Ref: "#/components/schemas/Revision"})
+		g.path("/{id}/history/{rev}").Get = op
+
+		if res.Allows(registry.OpUpdate) {
+			op = g.operation("revert", "Revert a "+name+" to a revision", http.StatusBadRequest, http.StatusNotFound, http.StatusConflict)
+			op.Parameters = []*Parameter{g.keyParam(), {Name: "revision", In: "query", Required: true, Schema: &Schema{Type: "integer"}}}
+			op.Responses["200"] = jsonResponse("The reverted "+name, g.ref())
+			g.path("/{id}:revert").Post = op
+		}
+	}
+}
+
+// operatorDescriptions explain the filter operators; %s is the field.
+var operatorDescriptions = map[string]string{
+	"eq":         "%s equals the value",
+	"ne":         "%s doesn't equal the value",
+	"gt":         "%s is greater than the value",
+	"gte":        "%s is greater than or equal to the value",
+	"lt":         "%s is less than the value",
+	"lte":        "%s is less than or equal to the value",
+	"after":      "%s is after the value",
+	"before":     "%s is before the value",
+	"between":    "%s is between two comma separated times, inclusive",
+	"contains":   "%s contains the value, ignoring case",
+	"startswith": "%s starts with the value, ignoring case",
+	"endswith":   "%s ends with the value, ignoring case",
+}
+
+// filterParams documents the filter parameters of the resource's fields,
+// leaving out the write-only ones.
+func (g *generator) filterParams() []*Parameter {
+	var params []*Parameter
+	for _, param := range filter.Params(g.res.Item, g.res.IsWriteOnly) {
+		jsonName, _, _ := strings.Cut(param.Field.Tag.Get("json"), ",")
+		valueSchema := schema.ForType(param.Field.Type)
+		if param.Field.Type.Kind() == reflect.Ptr {
+			valueSchema = schema.ForType(param.Field.Type.Elem())
+		}
+		switch param.Operator {
+		case "contains", "startswith", "endswith", "between":
+			valueSchema = &Schema{Type: "string"}
+		}
+		params = append(params, &Parameter{
+			Name:        param.Name,
+			In:          "query",
+			Description: fmt.Sprintf(operatorDescriptions[param.Operator], jsonName),
+			Schema:      valueSchema,
+		})
+	}
+	return params
+}
+
+func sharedSchemas() map[string]*Schema {
+	return map[string]*Schema{
+		"Problem": {
+			Type:        "object",
+			Description: "An RFC 7807 problem detail",
+			Required:    []string{"type", "title", "status"},
+			Properties: map[string]*Schema{
+				"type":     {Type: "string", Format: "uri-reference"},
+				"title":    {Type: "string"},
+				"status":   {Type: "integer"},
+				"detail":   {Type: "string"},
+				"instance": {Type: "string", Format: "uri-reference"},
+				"errors":   {Type: "array", Items: &Schema{Ref: "#/components/schemas/FieldError"}},
+			},
+		},
+		"FieldError": schema.ForStruct(reflect.TypeOf(dal.FieldError{}), nil),
+		"Revision": {
+			Type: "object",
+			Properties: map[string]*Schema{
+				"revision": {Type: "integer"},
+				"op":       {Type: "string", Enum: []interface{}{dal.OpCreate, dal.OpUpdate, dal.OpDelete, dal.OpRestore, dal.OpPurge}},
+				"actor":    {Type: "string"},
+				"at":       {Type: "string", Format: "date-time"},
+				"item":     {Type: "object", Description: "The item as of this revision"},
+			},
+		},
+		"Message": {Type: "object", Properties: map[string]*Schema{"message": {Type: "string"}}},
+	}
+}
+
+func sharedParameters() map[string]*Parameter {
+	one := 1.0
+	return map[string]*Parameter{
+		"sort": {Name: "sort", In: "query",
+			Description: "Field to sort by, descending with a - prefix; repeat for more fields",
+			Schema:      &Schema{Type: "array", Items: &Schema{Type: "string"}}},
+		"page": {Name: "page", In: "query", Description: "Page number, from 1",
+			Schema: &Schema{Type: "integer", Minimum: &one, Default: 1}},
+		"pageSize": {Name: "pageSize", In: "query", Description: "Items per page",
+			Schema: &Schema{Type: "integer", Minimum: &one, Default: rest.DefaultPageSize}},
+		"onDecodeError": {Name: "onDecodeError", In: "query",
+			Description: "What to do with stored items that can't be read: fail the request or skip them",
+			Schema:      &Schema{Type: "string", Enum: []interface{}{"fail", "skip"}, Default: "fail"}},
+		"includeDeleted": {Name: "includeDeleted", In: "query", Description: "Include soft deleted items",
+			Schema: &Schema{Type: "boolean", Default: false}},
+	}
+}
+
+func sharedResponses() map[string]*Response {
+	responses := map[string]*Response{"Error": problemResponse("Unexpected error")}
+	for status, name := range errorResponses {
+		responses[name] = problemResponse(http.StatusText(status))
+	}
+	return responses
+}
+
+func problemResponse(description string) *Response {
+	return &Response{
+		Description: description,
+		Content:     map[string]MediaType{problem.ContentType: {Schema: &Schema{Ref: "#/components/schemas/Problem"}}},
+	}
+}
@@ -0,0 +1,59 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/seebasoft/prompter/goback/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	resources, err := models.Resources()
+	require.NoError(t, err)
+	doc := openapi.Generate(resources, "/rest/v1", openapi.Info{Title: "API", Version: "1"})
+	assert.Equal(t, "3.1.0", doc.OpenAPI)
+
+	users := doc.Paths["/rest/v1/users"]
+	require.NotNil(t, users)
+	require.NotNil(t, users.Get)
+	require.NotNil(t, users.Post)
+	params := make(map[string]*openapi.Parameter)
+	for _, param := range users.Get.Parameters {
+		params[param.Name+param.Ref] = param
+	}
+	assert.Contains(t, params, "username")
+	assert.Contains(t, params, "username_contains")
+	assert.Equal(t, "date-time", params["birthdate_gte"].Schema.Format)
+	assert.Equal(t, "string", params["birthdate_between"].Schema.Type)
+	assert.NotContains(t, params, "birthdate_contains")
+	assert.Contains(t, params, "#/components/parameters/sort")
+	assert.Contains(t, params, "#/components/parameters/includeDeleted")
+	assert.Equal(t, "#/components/responses/ValidationFailed", users.Post.Responses["422"].Ref)
+
+	assert.NotNil(t, doc.Paths["/rest/v1/users/{id}:restore"])
+	assert.NotNil(t, doc.Paths["/rest/v1/users/{id}/history/{rev}"])
+	// webhooks aren't soft deletable and keep no history
+	assert.Nil(t, doc.Paths["/rest/v1/webhooks/{id}:restore"])
+	assert.Nil(t, doc.Paths["/rest/v1/webhooks/{id}/history"])
+	assert.NotNil(t, doc.Paths["/rest/v1/webhooks/{id}"].Put)
+	for _, param := range doc.Paths["/rest/v1/webhooks"].Get.Parameters {
+		assert.NotContains(t, param.Name, "secret", "write-only fields can't be filtered on")
+	}
+
+	user := doc.Components.Schemas["User"]
+	require.NotNil(t, user)
+	assert.ElementsMatch(t, []string{"username", "email"}, user.Required)
+	assert.Equal(t, "date-time", user.Properties["birthdate"].Format)
+	assert.Equal(t, []string{"string", "null"}, user.Properties["deletedAt"].Type)
+	assert.True(t, user.Properties["createdAt"].ReadOnly)
+	assert.False(t, user.Properties["username"].ReadOnly)
+	assert.Empty(t, user.Dialect)
+	assert.Empty(t, user.Title)
+	assert.True(t, doc.Components.Schemas["Webhook"].Properties["secret"].WriteOnly)
+
+	_, err = json.Marshal(doc)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,139 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/database"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/seebasoft/prompter/goback/outbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type flakySink struct {
+	name     string
+	mu       sync.Mutex
+	failures int
+	calls    int
+}
+
+func (f *flakySink) Name() string {
+	return f.name
+}
+
+func (f *flakySink) Publish(ctx context.Context, event outbox.Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls <= f.failures {
+		return errors.New("sink unavailable")
+	}
+	return nil
+}
+
+func newUser(name string) *models.User {
+	return &models.User{ID: primitive.NewObjectID(), Username: name, Email: name + "@example.com"}
+}
+
+func TestOutboxPublishesCreatedEvents(t *testing.T) {
+	ctx := context.Background()
+	mem := database.NewMemoryStore()
+	require.NoError(t, mem.EnsureIndexes(ctx, &models.User{}))
+	store := outbox.NewStore(mem, mem)
+
+	user := newUser("alice")
+	_, err := store.Create(ctx, user)
+	require.NoError(t, err)
+
+	// The duplicate is rolled back together with its outbox record
+	_, err = store.Create(ctx, &models.User{ID: primitive.NewObjectID(), Username: "alice", Email: "x@example.com"})
+	require.Error(t, err)
+
+	bus := outbox.NewMemoryBus()
+	relay := outbox.NewRelay(mem, "core", bus)
+	published, err := relay.ProcessOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+
+	events := bus.Events()
+	require.Len(t, events, 1)
+	assert.Equal(t, "users.created", events[0].Type)
+	assert.Equal(t, user.ID.Hex(), events[0].Key)
+	assert.Contains(t, string(events[0].Data), `"username":"alice"`)
+
+	published, err = relay.ProcessOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, published)
+}
+
+func TestOutboxRetriesWithBackoff(t *testing.T) {
+	ctx := context.Background()
+	mem := database.NewMemoryStore()
+	store := outbox.NewStore(mem, mem)
+	_, err := store.Create(ctx, newUser("bob"))
+	require.NoError(t, err)
+
+	sink := &flakySink{name: "flaky", failures: 1}
+	steady := &flakySink{name: "steady"}
+	relay := outbox.NewRelay(mem, "core", sink, steady)
+	relay.BaseBackoff = time.Millisecond
+	relay.MaxBackoff = time.Millisecond
+
+	published, err := relay.ProcessOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, published)
+
+	time.Sleep(5 * time.Millisecond)
+	published, err = relay.ProcessOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.Equal(t, 2, sink.calls)
+	assert.Equal(t, 1, steady.calls, "the retry only goes to the sink that failed")
+}
+
+func TestRelaysClaimRecords(t *testing.T) {
+	ctx := context.Background()
+	mem := database.NewMemoryStore()
+	store := outbox.NewStore(mem, mem)
+	for i := 0; i < 20; i++ {
+		_, err := store.Create(ctx, newUser(fmt.Sprintf("user%d", i)))
+		require.NoError(t, err)
+	}
+
+	sink := &flakySink{name: "sink"}
+	var wg sync.WaitGroup
+	var published atomic.Int64
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, err := outbox.NewRelay(mem, "core", sink).ProcessOnce(ctx)
+			assert.NoError(t, err)
+			published.Add(int64(n))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(20), published.Load())
+	assert.Equal(t, 20, sink.calls, "each event is published once")
+}
+
+func TestMemoryBusDropsDuplicates(t *testing.T) {
+	bus := outbox.NewMemoryBus()
+	received := 0
+	bus.Subscribe(func(ctx context.Context, event outbox.Event) error {
+		received++
+		return nil
+	})
+
+	event := outbox.Event{ID: "evt-1", Type: "users.created"}
+	require.NoError(t, bus.Publish(context.Background(), event))
+	require.NoError(t, bus.Publish(context.Background(), event))
+	assert.Equal(t, 1, received)
+}
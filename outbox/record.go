@@ -0,0 +1,92 @@
+// Package outbox implements the transactional outbox pattern: Store writes
+// insert an event record in the same transaction as the item, and a Relay
+// publishes pending records to Sinks afterwards. Delivery is at least once;
+// every event carries a stable ID sinks use to drop duplicates.
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ItemGroup is the collection outbox records are stored in, next to the items
+// they describe.
+const ItemGroup = "outbox"
+
+// Event is what sinks receive.
+type Event struct {
+	ID         string          `json:"id"`   // Stable across retries; use it to dedupe
+	Type       string          `json:"type"` // "<group>.<action>", e.g. "users.created"
+	Namespace  string          `json:"namespace"`
+	ItemGroup  string          `json:"itemGroup"`
+	Key        string          `json:"key"`
+	Actor      string          `json:"actor,omitempty"`
+	OccurredAt time.Time       `json:"occurredAt"`
+	Data       json.RawMessage `json:"data,omitempty"`
+}
+
+// Record is an outbox entry: an Event plus its delivery state.
+type Record struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Event         Event              `bson:"event" json:"event"`
+	CreatedAt     time.Time          `bson:"createdAt" json:"createdAt"`
+	Attempts      int                `bson:"attempts" json:"attempts"`
+	NextAttemptAt time.Time          `bson:"nextAttemptAt" json:"nextAttemptAt"`
+	PublishedAt   *time.Time         `bson:"publishedAt" json:"publishedAt,omitempty"`
+	FailedAt      *time.Time         `bson:"failedAt" json:"failedAt,omitempty"` // Set once retries are exhausted
+	LastError     string             `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	Delivered     []string           `bson:"delivered,omitempty" json:"delivered,omitempty"`   // Names of the sinks that accepted the event
+	LeaseOwner    string             `bson:"leaseOwner,omitempty" json:"leaseOwner,omitempty"` // Relay publishing the record
+}
+
+// NewRecordType returns an empty Record for reading the outbox of a namespace.
+func NewRecordType(namespace string) *Record {
+	return &Record{Event: Event{Namespace: namespace}}
+}
+
+func (r *Record) Namespace() string {
+	return r.Event.Namespace
+}
+
+func (r *Record) ItemGroup() string {
+	return ItemGroup
+}
+
+func (r *Record) Marshal() ([]byte, error) {
+	return bson.Marshal(r)
+}
+
+func (r *Record) Unmarshal(raw []byte) error {
+	return bson.Unmarshal(raw, r)
+}
+
+func (r *Record) New() dal.Item {
+	return NewRecordType(r.Event.Namespace)
+}
+
+func (r *Record) GetKey() interface{} {
+	return r.ID
+}
+
+var ErrInvalidKey = errors.New("invalid key")
+
+func (r *Record) SetKey(key interface{}) error {
+	if id, ok := key.(primitive.ObjectID); ok {
+		r.ID = id
+		return nil
+	}
+	return ErrInvalidKey
+}
+
+// Indexes lets the relay find pending records without a collection scan.
+func (r *Record) Indexes() []dal.Index {
+	return []dal.Index{
+		{Fields: []dal.IndexField{dal.Asc("publishedAt"), dal.Asc("failedAt"), dal.Asc("nextAttemptAt")}},
+		{Fields: []dal.IndexField{dal.Asc("event.id")}, Unique: true},
+	}
+}
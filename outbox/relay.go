@@ -0,0 +1,182 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/database"
+	"github.com/seebasoft/prompter/goback/internal/backoff"
+	"github.com/seebasoft/prompter/goback/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Relay publishes pending outbox records to its sinks, retrying failed
+// records with exponential backoff until MaxAttempts is reached. Relays claim
+// each record before publishing it, so several can share an outbox, and
+// retries only go to the sinks that haven't accepted the event yet.
+type Relay struct {
+	store     Queue
+	namespace string
+	sinks     []Sink
+	names     []string // of sinks, as recorded in Record.Delivered
+	owner     string   // claims records as Record.LeaseOwner
+
+	BatchSize    int64
+	PollInterval time.Duration
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	// LeaseTimeout is how long a claimed record is left to its relay before
+	// others may take it over. It must outlast publishing to every sink.
+	LeaseTimeout time.Duration
+
+	now func() time.Time
+}
+
+// Queue is the store a Relay reads the outbox from.
+type Queue interface {
+	dal.Store
+	dal.Claimer
+}
+
+// NewRelay creates a relay for the outbox of a namespace.
+func NewRelay(store Queue, namespace string, sinks ...Sink) *Relay {
+	names := make([]string, len(sinks))
+	seen := make(map[string]int)
+	for i, sink := range sinks {
+		names[i] = sinkName(sink)
+		if seen[names[i]]++; seen[names[i]] > 1 {
+			names[i] = fmt.Sprintf("%s#%d", names[i], seen[names[i]])
+		}
+	}
+	return &Relay{
+		store:        store,
+		namespace:    namespace,
+		sinks:        sinks,
+		names:        names,
+		owner:        primitive.NewObjectID().Hex(),
+		BatchSize:    100,
+		PollInterval: 2 * time.Second,
+		MaxAttempts:  10,
+		BaseBackoff:  time.Second,
+		MaxBackoff:   10 * time.Minute,
+		LeaseTimeout: 5 * time.Minute,
+		now:          func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Run processes the outbox every PollInterval until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.ProcessOnce(ctx); err != nil && ctx.Err() == nil {
+			logging.FromContext(ctx).Error("outbox relay failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessOnce claims and publishes up to BatchSize records that are due when
+// it starts and returns how many were published.
+func (r *Relay) ProcessOnce(ctx context.Context) (int, error) {
+	due := r.now()
+	published := 0
+	var errs []error
+	for i := int64(0); i < r.BatchSize && ctx.Err() == nil; i++ {
+		record, err := r.claim(ctx, due)
+		if errors.Is(err, dal.ErrNotFound) {
+			break
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("claiming outbox record: %w", err))
+			break
+		}
+		if r.deliver(ctx, record) {
+			published++
+		}
+		if err := r.release(ctx, record); err != nil {
+			errs = append(errs, fmt.Errorf("updating outbox record %s: %w", record.Event.ID, err))
+		}
+	}
+	return published, errors.Join(errs...)
+}
+
+// claim takes the oldest record due at due, leasing it to this relay for
+// LeaseTimeout.
+func (r *Relay) claim(ctx context.Context, due time.Time) (*Record, error) {
+	filter := bson.M{"publishedAt": nil, "failedAt": nil, "nextAttemptAt": bson.M{"$lte": due}}
+	opts := database.NewMongoDalQueryOptions(database.NewMongoFilter(filter), bson.D{{Key: "createdAt", Value: 1}}, 1, 0)
+	record := NewRecordType(r.namespace)
+	lease := map[string]interface{}{"leaseOwner": r.owner, "nextAttemptAt": r.now().Add(r.LeaseTimeout)}
+	if err := r.store.Claim(ctx, opts, lease, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// release stores the delivery state of a claimed record, unless another
+// relay took it over after the lease ran out.
+func (r *Relay) release(ctx context.Context, record *Record) error {
+	filter := bson.M{"_id": record.ID, "leaseOwner": r.owner}
+	opts := database.NewMongoDalQueryOptions(database.NewMongoFilter(filter), nil, 1, 0)
+	state := map[string]interface{}{
+		"attempts":      record.Attempts,
+		"delivered":     record.Delivered,
+		"nextAttemptAt": record.NextAttemptAt,
+		"publishedAt":   record.PublishedAt,
+		"failedAt":      record.FailedAt,
+		"lastError":     record.LastError,
+		"leaseOwner":    "",
+	}
+	if err := r.store.Claim(ctx, opts, state, NewRecordType(r.namespace)); err != nil {
+		if errors.Is(err, dal.ErrNotFound) {
+			return errors.New("its lease ran out")
+		}
+		return err
+	}
+	return nil
+}
+
+// deliver publishes a record to the sinks that haven't accepted it yet and
+// updates its delivery state.
+func (r *Relay) deliver(ctx context.Context, record *Record) bool {
+	var errs []error
+	for i, sink := range r.sinks {
+		if slices.Contains(record.Delivered, r.names[i]) {
+			continue
+		}
+		if err := sink.Publish(ctx, record.Event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.names[i], err))
+			continue
+		}
+		record.Delivered = append(record.Delivered, r.names[i])
+	}
+	err := errors.Join(errs...)
+
+	now := r.now()
+	record.Attempts++
+	if err == nil {
+		record.PublishedAt = &now
+		record.LastError = ""
+		return true
+	}
+
+	record.LastError = err.Error()
+	if record.Attempts >= r.MaxAttempts {
+		record.FailedAt = &now
+		logging.FromContext(ctx).Error("outbox relay giving up on event", "eventId", record.Event.ID, "attempts", record.Attempts, "error", err)
+	} else {
+		record.NextAttemptAt = now.Add(backoff.Delay(record.Attempts, r.BaseBackoff, r.MaxBackoff))
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Sink receives published events. Publish may be called again with an event
+// it already accepted (after a crash or a lost lease), so sinks or their
+// consumers must dedupe on Event.ID.
+type Sink interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// Named is implemented by Sinks that name themselves. Relays record which
+// sinks accepted an event by name, so names must stay the same across
+// restarts; sinks without one are named after their type.
+type Named interface {
+	Name() string
+}
+
+func sinkName(sink Sink) string {
+	if named, ok := sink.(Named); ok {
+		return named.Name()
+	}
+	return fmt.Sprintf("%T", sink)
+}
+
+// WebhookSink POSTs each event as JSON to a URL. The event ID is sent as the
+// Idempotency-Key header.
+type WebhookSink struct {
+	URL     string
+	Headers map[string]string
+	Client  *http.Client
+}
+
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (w *WebhookSink) Name() string {
+	return "webhook " + w.URL
+}
+
+func (w *WebhookSink) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encoding event: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("building webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", event.ID)
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("posting event: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("posting event: webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// FileSink appends each event as a JSON line to a file.
+type FileSink struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func NewFileSink(path string) *FileSink {
+	return &FileSink{Path: path}
+}
+
+func (f *FileSink) Name() string {
+	return "file " + f.Path
+}
+
+func (f *FileSink) Publish(ctx context.Context, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encoding event: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening outbox file: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("writing outbox file: %w", err)
+	}
+	return nil
+}
+
+// MemoryBus is an in-process sink. Handlers subscribed to it get every event
+// once: redeliveries of an event ID it has seen are dropped.
+type MemoryBus struct {
+	mu       sync.Mutex
+	seen     map[string]bool
+	events   []Event
+	handlers []func(context.Context, Event) error
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{seen: make(map[string]bool)}
+}
+
+// Subscribe registers a handler for events published after the call.
+func (b *MemoryBus) Subscribe(handler func(context.Context, Event) error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+func (b *MemoryBus) Publish(ctx context.Context, event Event) error {
+	b.mu.Lock()
+	if b.seen[event.ID] {
+		b.mu.Unlock()
+		return nil
+	}
+	handlers := append([]func(context.Context, Event) error(nil), b.handlers...)
+	b.mu.Unlock()
+
+	for _, handler := range handlers {
+		if err := handler(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seen[event.ID] = true
+	b.events = append(b.events, event)
+	return nil
+}
+
+// Events returns the events delivered so far.
+func (b *MemoryBus) Events() []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Event(nil), b.events...)
+}
@@ -0,0 +1,122 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Event actions, appended to the item group to form Event.Type.
+const (
+	ActionCreated  = "created"
+	ActionUpdated  = "updated"
+	ActionDeleted  = "deleted"
+	ActionRestored = "restored"
+	ActionPurged   = "purged"
+)
+
+// Store is a dal.Store decorator that records an outbox event for every
+// successful write, in the same transaction as the write itself.
+type Store struct {
+	dal.Store
+	tx  dal.Transactor
+	now func() time.Time
+}
+
+// NewStore wraps store so writes also insert outbox records. tx is usually
+// the backend at the bottom of the decorator stack.
+func NewStore(store dal.Store, tx dal.Transactor) dal.Store {
+	return &Store{Store: store, tx: tx, now: func() time.Time { return time.Now().UTC() }}
+}
+
+func (s *Store) record(ctx context.Context, action string, key interface{}, item dal.Item, withData bool) error {
+	event := Event{
+		ID:         primitive.NewObjectID().Hex(),
+		Type:       item.ItemGroup() + "." + action,
+		Namespace:  item.Namespace(),
+		ItemGroup:  item.ItemGroup(),
+		Key:        keyString(key),
+		Actor:      dal.ActorFrom(ctx),
+		OccurredAt: s.now(),
+	}
+	if withData {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return fmt.Errorf("encoding outbox event: %w", err)
+		}
+		event.Data = data
+	}
+
+	record := &Record{ID: primitive.NewObjectID(), Event: event, CreatedAt: event.OccurredAt, NextAttemptAt: event.OccurredAt}
+	if _, err := s.Store.Create(ctx, record); err != nil {
+		return fmt.Errorf("writing outbox record: %w", err)
+	}
+	return nil
+}
+
+func keyString(key interface{}) string {
+	if id, ok := key.(primitive.ObjectID); ok {
+		return id.Hex()
+	}
+	return fmt.Sprint(key)
+}
+
+func isRecord(item dal.Item) bool {
+	_, ok := item.(*Record)
+	return ok
+}
+
+func (s *Store) Create(ctx context.Context, item dal.Item) (dal.Item, error) {
+	if isRecord(item) {
+		return s.Store.Create(ctx, item)
+	}
+	var created dal.Item
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if created, err = s.Store.Create(ctx, item); err != nil {
+			return err
+		}
+		return s.record(ctx, ActionCreated, created.GetKey(), created, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (s *Store) UpdateByKey(ctx context.Context, key interface{}, item dal.Item) (int64, error) {
+	return s.write(ctx, ActionUpdated, key, item, true, s.Store.UpdateByKey)
+}
+
+func (s *Store) DeleteByKey(ctx context.Context, key interface{}, itemType dal.Item) (int64, error) {
+	return s.write(ctx, ActionDeleted, key, itemType, false, s.Store.DeleteByKey)
+}
+
+func (s *Store) RestoreByKey(ctx context.Context, key interface{}, itemType dal.Item) (int64, error) {
+	return s.write(ctx, ActionRestored, key, itemType, false, s.Store.RestoreByKey)
+}
+
+func (s *Store) PurgeByKey(ctx context.Context, key interface{}, itemType dal.Item) (int64, error) {
+	return s.write(ctx, ActionPurged, key, itemType, false, s.Store.PurgeByKey)
+}
+
+// write runs a keyed write and records its event when it changed something.
+func (s *Store) write(ctx context.Context, action string, key interface{}, item dal.Item, withData bool,
+	writeFn func(context.Context, interface{}, dal.Item) (int64, error)) (int64, error) {
+	if isRecord(item) {
+		return writeFn(ctx, key, item)
+	}
+	var count int64
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if count, err = writeFn(ctx, key, item); err != nil || count == 0 {
+			return err
+		}
+		return s.record(ctx, action, key, item, withData)
+	})
+	return count, err
+}
@@ -0,0 +1,54 @@
+package problem
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/seebasoft/prompter/goback/logging"
+)
+
+// Write sends a problem as the response, setting its instance to the request
+// path. Server errors are logged with their cause.
+func Write(c *gin.Context, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = c.Request.URL.Path
+	}
+	if p.Status >= 500 {
+		logger := logging.FromContext(c.Request.Context())
+		if p.cause != nil {
+			logger.Error(p.Title, "error", p.cause, "status", p.Status)
+		} else {
+			logger.Error(p.Title, "detail", p.Detail, "status", p.Status)
+		}
+	}
+	for key, values := range p.Header() {
+		c.Writer.Header()[key] = values
+	}
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+// WriteError converts err with FromError and sends it.
+func WriteError(c *gin.Context, err error, fallbackStatus int) {
+	Write(c, FromError(err, fallbackStatus))
+}
+
+// Recovery turns panics in handlers into 500 problems instead of dropping the
+// connection.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
+		p := New(http.StatusInternalServerError, "")
+		p.cause = fmt.Errorf("panic: %v", recovered)
+		Write(c, p)
+	})
+}
+
+// NoRoute answers requests for unknown paths.
+func NoRoute(c *gin.Context) {
+	Write(c, New(http.StatusNotFound, "No such resource."))
+}
+
+// NoMethod answers requests with a method the path doesn't support.
+func NoMethod(c *gin.Context) {
+	Write(c, New(http.StatusMethodNotAllowed, c.Request.Method+" isn't supported here."))
+}
@@ -0,0 +1,174 @@
+// Package problem renders API errors as RFC 7807 application/problem+json
+// documents.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/dal"
+)
+
+// ContentType is the media type of problem documents.
+const ContentType = "application/problem+json"
+
+// TypeBase prefixes the problem type names below to form type URIs. RFC 7807
+// allows relative references; they resolve against the API's own origin.
+var TypeBase = "/problems/"
+
+// Problem types.
+const (
+	TypeBadRequest       = "bad-request"
+	TypeInvalidFilter    = "invalid-filter"
+	TypeValidation       = "validation-error"
+	TypeForbidden        = "forbidden"
+	TypeNotFound         = "not-found"
+	TypeMethodNotAllowed = "method-not-allowed"
+	TypeConflict         = "conflict"
+	TypeDuplicateKey     = "duplicate-key"
+	TypeUnavailable      = "unavailable"
+	TypeDecode           = "decode-error"
+	TypeInternal         = "internal-error"
+)
+
+var statusTypes = map[int]string{
+	http.StatusBadRequest:          TypeBadRequest,
+	http.StatusForbidden:           TypeForbidden,
+	http.StatusNotFound:            TypeNotFound,
+	http.StatusMethodNotAllowed:    TypeMethodNotAllowed,
+	http.StatusConflict:            TypeConflict,
+	http.StatusUnprocessableEntity: TypeValidation,
+	http.StatusInternalServerError: TypeInternal,
+	http.StatusServiceUnavailable:  TypeUnavailable,
+}
+
+// Problem is an RFC 7807 problem detail. Errors is an extension listing the
+// individual fields at fault.
+type Problem struct {
+	Type     string           `json:"type"`
+	Title    string           `json:"title"`
+	Status   int              `json:"status"`
+	Detail   string           `json:"detail,omitempty"`
+	Instance string           `json:"instance,omitempty"`
+	Errors   []dal.FieldError `json:"errors,omitempty"`
+
+	// RetryAfter is sent as the Retry-After header, not in the body.
+	RetryAfter time.Duration `json:"-"`
+	// cause is the error the problem was built from; it is logged, not sent.
+	cause error
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+	return fmt.Sprintf("%s: %s", p.Title, p.Detail)
+}
+
+// Unwrap returns the error the problem was built from, if any.
+func (p *Problem) Unwrap() error {
+	return p.cause
+}
+
+// TypeName returns the problem type without TypeBase, e.g. "not-found".
+func (p *Problem) TypeName() string {
+	return strings.TrimPrefix(p.Type, TypeBase)
+}
+
+// New creates a problem with the generic type of its status code.
+func New(status int, detail string) *Problem {
+	typeName, ok := statusTypes[status]
+	if !ok {
+		return &Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail}
+	}
+	return Typed(status, typeName, detail)
+}
+
+// Typed creates a problem of a specific type.
+func Typed(status int, typeName string, detail string) *Problem {
+	return &Problem{Type: TypeBase + typeName, Title: titles[typeName], Status: status, Detail: detail}
+}
+
+var titles = map[string]string{
+	TypeBadRequest:       "Bad request",
+	TypeInvalidFilter:    "Invalid filter",
+	TypeValidation:       "Validation failed",
+	TypeForbidden:        "Forbidden",
+	TypeNotFound:         "Not found",
+	TypeMethodNotAllowed: "Method not allowed",
+	TypeConflict:         "Conflict",
+	TypeDuplicateKey:     "Duplicate key",
+	TypeUnavailable:      "Service unavailable",
+	TypeDecode:           "Stored item can't be read",
+	TypeInternal:         "Internal error",
+}
+
+// FromError converts an error from the dal layer or request parsing into a
+// problem. Errors with no specific mapping get fallbackStatus.
+func FromError(err error, fallbackStatus int) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+
+	var validationErr *dal.ValidationError
+	var duplicateErr *dal.DuplicateKeyError
+	var unavailableErr *dal.UnavailableError
+	var filterErr *dal.FilterError
+	var decodeErr *dal.DecodeError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &validationErr):
+		p = Typed(http.StatusUnprocessableEntity, TypeValidation, "The request body has invalid fields.")
+		p.Errors = validationErr.Errors
+	case errors.As(err, &duplicateErr):
+		p = Typed(http.StatusConflict, TypeDuplicateKey, duplicateErr.Error())
+		for _, field := range duplicateErr.Fields {
+			p.Errors = append(p.Errors, dal.FieldError{Field: field, Rule: "unique", Message: field + " is already taken"})
+		}
+	case errors.As(err, &unavailableErr):
+		p = Typed(http.StatusServiceUnavailable, TypeUnavailable, "The database is unavailable, try again later.")
+		p.RetryAfter = unavailableErr.RetryAfter
+	case errors.As(err, &filterErr):
+		p = Typed(http.StatusBadRequest, TypeInvalidFilter, filterErr.Error())
+		p.Errors = []dal.FieldError{{Field: filterErr.Param, Rule: "filter", Message: filterErr.Reason}}
+	case errors.As(err, &decodeErr):
+		p = Typed(http.StatusInternalServerError, TypeDecode,
+			fmt.Sprintf("Item %v doesn't match the resource schema. Retry with onDecodeError=skip to leave it out.", decodeErr.Key))
+	case errors.Is(err, dal.ErrNotFound), errors.Is(err, dal.ErrRevisionNotFound):
+		p = New(http.StatusNotFound, err.Error())
+	case errors.Is(err, dal.ErrRevertRemoved):
+		p = Typed(http.StatusConflict, TypeConflict, err.Error())
+	case errors.Is(err, dal.ErrNotSoftDeletable):
+		p = New(http.StatusMethodNotAllowed, err.Error())
+	case errors.As(err, &syntaxErr):
+		p = New(http.StatusBadRequest, fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset))
+	case errors.As(err, &typeErr):
+		p = New(http.StatusBadRequest, "The request body has fields of the wrong type.")
+		p.Errors = []dal.FieldError{{Field: typeErr.Field, Rule: "type", Param: typeErr.Type.String(), Message: fmt.Sprintf("%s can't be a JSON %s", typeErr.Field, typeErr.Value)}}
+	case fallbackStatus >= 500:
+		// Don't leak internals; the cause is logged instead
+		p = New(fallbackStatus, "")
+	default:
+		p = New(fallbackStatus, err.Error())
+	}
+	p.cause = err
+	return p
+}
+
+// Header returns the headers to send with a problem.
+func (p *Problem) Header() http.Header {
+	header := http.Header{"Content-Type": []string{ContentType}}
+	if p.RetryAfter > 0 {
+		seconds := int(math.Ceil(p.RetryAfter.Seconds()))
+		header.Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	}
+	return header
+}
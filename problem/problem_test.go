@@ -0,0 +1,62 @@
+package problem_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/problem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromError(t *testing.T) {
+	p := problem.FromError(fmt.Errorf("creating entity: %w", &dal.DuplicateKeyError{Index: "email_1", Fields: []string{"email"}}), http.StatusBadRequest)
+	assert.Equal(t, http.StatusConflict, p.Status)
+	assert.Equal(t, problem.TypeDuplicateKey, p.TypeName())
+	assert.Equal(t, "email", p.Errors[0].Field)
+
+	p = problem.FromError(&dal.FilterError{Param: "birthdate_after", Value: "yesterday", Reason: "must be an RFC 3339 date"}, http.StatusInternalServerError)
+	assert.Equal(t, http.StatusBadRequest, p.Status)
+	assert.Equal(t, problem.TypeInvalidFilter, p.TypeName())
+	assert.Equal(t, "birthdate_after", p.Errors[0].Field)
+
+	p = problem.FromError(fmt.Errorf("reading: %w", dal.ErrNotFound), http.StatusInternalServerError)
+	assert.Equal(t, http.StatusNotFound, p.Status)
+
+	// Details of unexpected server errors stay out of the response
+	p = problem.FromError(fmt.Errorf("connection string mongodb://user:pw@host"), http.StatusInternalServerError)
+	assert.Equal(t, http.StatusInternalServerError, p.Status)
+	assert.Empty(t, p.Detail)
+}
+
+func TestWriteAndRecovery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(problem.Recovery())
+	engine.GET("/busy", func(c *gin.Context) {
+		problem.WriteError(c, &dal.UnavailableError{RetryAfter: 1500 * time.Millisecond}, http.StatusInternalServerError)
+	})
+	engine.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/busy", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "/problems/unavailable", body["type"])
+	assert.Equal(t, "/busy", body["instance"])
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+	assert.NotContains(t, w.Body.String(), "boom")
+}
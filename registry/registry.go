@@ -0,0 +1,264 @@
+// Package registry declares the dal Items served as API resources. Each Item
+// type is registered once with the operations it supports, how its keys
+// appear in URLs, which fields clients can't set and who may use it; the REST
+// routes, the discovery document, GraphQL and the API docs are all generated
+// from the same Registry.
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Operation is something a client can do with a resource.
+type Operation string
+
+const (
+	OpCreate  Operation = "create"
+	OpRead    Operation = "read" // a single item by key
+	OpList    Operation = "list" // items matching a filter
+	OpUpdate  Operation = "update"
+	OpDelete  Operation = "delete" // soft delete or, with ?purge=true, purge
+	OpRestore Operation = "restore"
+	OpHistory Operation = "history" // revisions and ?asOf= reads
+)
+
+// AllOperations lists every operation, in the order documents show them.
+var AllOperations = []Operation{OpCreate, OpRead, OpList, OpUpdate, OpDelete, OpRestore, OpHistory}
+
+// ReadOnly are the operations that don't change anything.
+var ReadOnly = []Operation{OpRead, OpList, OpHistory}
+
+// ErrForbidden is returned by an Authorizer to deny a request.
+var ErrForbidden = errors.New("forbidden")
+
+// Authorizer decides whether the caller in ctx may perform op. It returns
+// nil to allow it, or an error, normally wrapping ErrForbidden, to deny it.
+type Authorizer func(ctx context.Context, op Operation) error
+
+// RequireActor returns an Authorizer that only lets authenticated requests,
+// those auth.Middleware found an actor for, perform the given operations. It
+// checks that the caller is known, not what they may do.
+func RequireActor(ops ...Operation) Authorizer {
+	return func(ctx context.Context, op Operation) error {
+		for _, guarded := range ops {
+			if op == guarded && dal.ActorFrom(ctx) == "" {
+				return fmt.Errorf("%s requires an actor: %w", op, ErrForbidden)
+			}
+		}
+		return nil
+	}
+}
+
+// KeyCodec converts between item keys and the path segments addressing them.
+type KeyCodec interface {
+	Parse(segment string) (interface{}, error)
+	Format(key interface{}) string
+}
+
+// ObjectIDKeys addresses items by the hex form of a Mongo ObjectID.
+var ObjectIDKeys KeyCodec = objectIDCodec{}
+
+// StringKeys addresses items by a string key used as is.
+var StringKeys KeyCodec = stringCodec{}
+
+type objectIDCodec struct{}
+
+func (objectIDCodec) Parse(segment string) (interface{}, error) {
+	return primitive.ObjectIDFromHex(segment)
+}
+
+func (objectIDCodec) Format(key interface{}) string {
+	if id, ok := key.(primitive.ObjectID); ok {
+		return id.Hex()
+	}
+	return fmt.Sprint(key)
+}
+
+type stringCodec struct{}
+
+func (stringCodec) Parse(segment string) (interface{}, error) {
+	if segment == "" {
+		return nil, errors.New("empty key")
+	}
+	return segment, nil
+}
+
+func (stringCodec) Format(key interface{}) string {
+	return fmt.Sprint(key)
+}
+
+// Options describes how an Item is served. The zero value serves every
+// operation under the Item's group name with ObjectID keys.
+type Options struct {
+	// Name is the path segment and type name of the resource; defaults to
+	// the Item's ItemGroup.
+	Name string
+	// Description is shown in the discovery document and API docs.
+	Description string
+	// Operations the resource supports; nil means AllOperations.
+	Operations []Operation
+	// Keys parses and formats keys; defaults to ObjectIDKeys.
+	Keys KeyCodec
+	// ReadOnlyFields are the JSON names of fields clients can't set. Values
+	// sent for them are ignored: new items get the zero value, updated items
+	// keep the stored one.
+	ReadOnlyFields []string
+	// WriteOnlyFields are the JSON names of fields clients can set but never
+	// read back, such as secrets.
+	WriteOnlyFields []string
+	// Authorize, if set, is asked before every operation.
+	Authorize Authorizer
+}
+
+// Resource is a registered Item.
+type Resource struct {
+	Name            string
+	Description     string
+	Item            dal.Item
+	Operations      []Operation
+	Keys            KeyCodec
+	ReadOnlyFields  []string
+	WriteOnlyFields []string
+	Authorize       Authorizer
+
+	readOnly map[string][]int // JSON name to struct field index
+}
+
+// New returns a fresh Item of the resource's type.
+func (r *Resource) New() dal.Item {
+	return r.Item.New()
+}
+
+// Allows reports whether the resource supports op.
+func (r *Resource) Allows(op Operation) bool {
+	for _, allowed := range r.Operations {
+		if allowed == op {
+			return true
+		}
+	}
+	return false
+}
+
+// IsReadOnly reports whether clients can't set the field with this JSON name.
+func (r *Resource) IsReadOnly(jsonName string) bool {
+	_, ok := r.readOnly[jsonName]
+	return ok
+}
+
+// IsWriteOnly reports whether clients can't read the field with this JSON
+// name.
+func (r *Resource) IsWriteOnly(jsonName string) bool {
+	for _, name := range r.WriteOnlyFields {
+		if name == jsonName {
+			return true
+		}
+	}
+	return false
+}
+
+// KeepReadOnly copies the read-only fields of from into item, discarding
+// whatever the client sent for them; a nil from resets them to zero values.
+func (r *Resource) KeepReadOnly(item, from dal.Item) {
+	dst := reflect.ValueOf(item).Elem()
+	for _, index := range r.readOnly {
+		field := dst.FieldByIndex(index)
+		if from == nil {
+			field.SetZero()
+		} else {
+			field.Set(reflect.ValueOf(from).Elem().FieldByIndex(index))
+		}
+	}
+}
+
+// Registry holds the registered resources in registration order.
+type Registry struct {
+	resources []*Resource
+	byName    map[string]*Resource
+}
+
+// New creates an empty Registry.
+func New() *Registry {
+	return &Registry{byName: make(map[string]*Resource)}
+}
+
+// Register adds an Item type. Names must be unique and read-only and
+// write-only fields must exist on the Item's struct.
+func (r *Registry) Register(item dal.Item, options Options) (*Resource, error) {
+	res := &Resource{
+		Name:            options.Name,
+		Description:     options.Description,
+		Item:            item,
+		Operations:      options.Operations,
+		Keys:            options.Keys,
+		ReadOnlyFields:  options.ReadOnlyFields,
+		WriteOnlyFields: options.WriteOnlyFields,
+		Authorize:       options.Authorize,
+		readOnly:        make(map[string][]int),
+	}
+	if res.Name == "" {
+		res.Name = item.ItemGroup()
+	}
+	if res.Operations == nil {
+		res.Operations = AllOperations
+	}
+	if res.Keys == nil {
+		res.Keys = ObjectIDKeys
+	}
+	if _, ok := r.byName[res.Name]; ok {
+		return nil, fmt.Errorf("resource %q is already registered", res.Name)
+	}
+
+	t := reflect.TypeOf(item)
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("resource %q: item must be a pointer to a struct", res.Name)
+	}
+	for _, name := range res.ReadOnlyFields {
+		index, ok := fieldIndex(t.Elem(), name)
+		if !ok {
+			return nil, fmt.Errorf("resource %q: read-only field %q doesn't exist", res.Name, name)
+		}
+		res.readOnly[name] = index
+	}
+	for _, name := range res.WriteOnlyFields {
+		if _, ok := fieldIndex(t.Elem(), name); !ok {
+			return nil, fmt.Errorf("resource %q: write-only field %q doesn't exist", res.Name, name)
+		}
+	}
+
+	r.resources = append(r.resources, res)
+	r.byName[res.Name] = res
+	return res, nil
+}
+
+// Resources returns the registered resources in registration order.
+func (r *Registry) Resources() []*Resource {
+	return r.resources
+}
+
+// Lookup finds a resource by name.
+func (r *Registry) Lookup(name string) (*Resource, bool) {
+	res, ok := r.byName[name]
+	return res, ok
+}
+
+// fieldIndex finds the field of t with the given JSON name.
+func fieldIndex(t reflect.Type, jsonName string) ([]int, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" {
+			name = field.Name
+		}
+		if name == jsonName && field.IsExported() {
+			return field.Index, true
+		}
+	}
+	return nil, false
+}
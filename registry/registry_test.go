@@ -0,0 +1,65 @@
+package registry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/seebasoft/prompter/goback/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRegister(t *testing.T) {
+	resources := registry.New()
+	users, err := resources.Register(&models.User{}, registry.Options{ReadOnlyFields: []string{"createdAt"}})
+	require.NoError(t, err)
+	assert.Equal(t, "users", users.Name)
+	assert.Equal(t, registry.AllOperations, users.Operations)
+	assert.True(t, users.IsReadOnly("createdAt"))
+	assert.False(t, users.IsReadOnly("username"))
+
+	_, err = resources.Register(&models.User{}, registry.Options{})
+	assert.ErrorContains(t, err, "already registered")
+	_, err = resources.Register(&models.User{}, registry.Options{Name: "people", ReadOnlyFields: []string{"nope"}})
+	assert.ErrorContains(t, err, `read-only field "nope"`)
+
+	found, ok := resources.Lookup("users")
+	assert.True(t, ok)
+	assert.Same(t, users, found)
+	assert.Len(t, resources.Resources(), 1)
+}
+
+func TestKeepReadOnly(t *testing.T) {
+	resources := registry.New()
+	users, err := resources.Register(&models.User{}, registry.Options{ReadOnlyFields: []string{"createdAt", "createdBy"}})
+	require.NoError(t, err)
+
+	stored := &models.User{Username: "jdoe", CreatedAt: time.Unix(100, 0), CreatedBy: "alice"}
+	sent := &models.User{Username: "john", CreatedAt: time.Unix(200, 0), CreatedBy: "mallory"}
+	users.KeepReadOnly(sent, stored)
+	assert.Equal(t, &models.User{Username: "john", CreatedAt: time.Unix(100, 0), CreatedBy: "alice"}, sent)
+
+	users.KeepReadOnly(sent, nil)
+	assert.Equal(t, &models.User{Username: "john"}, sent)
+}
+
+func TestKeysAndAuthorizers(t *testing.T) {
+	id := primitive.NewObjectID()
+	key, err := registry.ObjectIDKeys.Parse(id.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, id, key)
+	assert.Equal(t, id.Hex(), registry.ObjectIDKeys.Format(key))
+	_, err = registry.ObjectIDKeys.Parse("nope")
+	assert.Error(t, err)
+
+	authorize := registry.RequireActor(registry.OpDelete)
+	ctx := context.Background()
+	assert.NoError(t, authorize(ctx, registry.OpRead))
+	assert.True(t, errors.Is(authorize(ctx, registry.OpDelete), registry.ErrForbidden))
+	assert.NoError(t, authorize(dal.WithActor(ctx, "alice"), registry.OpDelete))
+}
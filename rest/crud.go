@@ -0,0 +1,582 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/logging"
+	"github.com/seebasoft/prompter/goback/database"
+	"github.com/seebasoft/prompter/goback/filter"
+	"github.com/seebasoft/prompter/goback/problem"
+	"github.com/seebasoft/prompter/goback/registry"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Implement handlers that correspond to all of the Store options
+
+// readContext returns the request context, widened to include soft deleted
+// items when the client asks for them with ?includeDeleted=true.
+func readContext(c *gin.Context) context.Context {
+	ctx := c.Request.Context()
+	if include, _ := strconv.ParseBool(c.Query("includeDeleted")); include {
+		ctx = dal.WithIncludeDeleted(ctx)
+	}
+	return ctx
+}
+
+// parseKey parses a key from the path, writing a problem if it is invalid.
+func parseKey(c *gin.Context, res *registry.Resource, segment string) (interface{}, bool) {
+	key, err := res.Keys.Parse(segment)
+	if err != nil {
+		problem.Write(c, problem.New(http.StatusBadRequest, fmt.Sprintf("Invalid %s key %q", res.Name, segment)))
+		return nil, false
+	}
+	return key, true
+}
+
+// authorize asks the resource's Authorizer whether op is allowed, writing a
+// problem if it isn't.
+func authorize(c *gin.Context, res *registry.Resource, op registry.Operation) bool {
+	if res.Authorize == nil {
+		return true
+	}
+	if err := res.Authorize(c.Request.Context(), op); err != nil {
+		problem.WriteError(c, err, http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// readBody reads the request body and validates it against the resource's
+// JSON Schema before it is bound, writing a problem if it is invalid. With
+// partial, required fields may be missing. The body is left in place for
+// ShouldBindJSON.
+func (s *Server) readBody(c *gin.Context, res *registry.Resource, partial bool) ([]byte, bool) {
+	body, err := c.GetRawData()
+	if err != nil {
+		problem.WriteError(c, err, http.StatusBadRequest)
+		return nil, false
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		problem.Write(c, problem.New(http.StatusBadRequest, "The request body is empty."))
+		return nil, false
+	}
+
+	validate := s.schema(res).Validate
+	if partial {
+		validate = s.schema(res).ValidatePartial
+	}
+	if err := validate(body); err != nil {
+		problem.WriteError(c, err, http.StatusBadRequest)
+		return nil, false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return body, true
+}
+
+// clearReadOnlyFields resets fields clients may not set through a request
+// body; the Store manages them.
+func clearReadOnlyFields(item dal.Item) {
+	if softDeletable, ok := item.(dal.SoftDeletable); ok {
+		softDeletable.SetDeletedAt(nil)
+	}
+	if audited, ok := item.(dal.Audited); ok {
+		audited.SetAuditInfo(dal.AuditInfo{})
+	}
+}
+
+// Provide a CRUD interface for dal.Item, enabling a REST API for
+// any entity implementing this interface.
+func (s *Server) Create(c *gin.Context, res *registry.Resource) {
+	item := res.New()
+	if !authorize(c, res, registry.OpCreate) {
+		return
+	}
+
+	if _, ok := s.readBody(c, res, false); !ok {
+		return
+	}
+	if err := c.ShouldBindJSON(item); err != nil {
+		problem.WriteError(c, err, http.StatusBadRequest)
+		return
+	}
+	clearReadOnlyFields(item)
+	res.KeepReadOnly(item, nil)
+	if err := dal.ValidateItem(c.Request.Context(), item); err != nil {
+		problem.WriteError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	if res.Keys == registry.ObjectIDKeys {
+		item.SetKey(primitive.NewObjectID())
+	}
+	created, err := s.store.Create(c.Request.Context(), item)
+
+	if err != nil {
+		problem.WriteError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+func (s *Server) ReadByKey(c *gin.Context, res *registry.Resource) {
+	item := res.New()
+	key, ok := parseKey(c, res, c.Param("id"))
+	if !ok || !authorize(c, res, registry.OpRead) {
+		return
+	}
+
+	if asOf := c.Query("asOf"); asOf != "" {
+		if !res.Allows(registry.OpHistory) {
+			problem.Write(c, problem.New(http.StatusBadRequest, "asOf isn't supported by "+res.Name))
+			return
+		}
+		s.ReadAsOf(c, key, asOf, item)
+		return
+	}
+
+	err := s.store.ReadByKey(readContext(c), key, item)
+
+	if err != nil {
+		problem.WriteError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// Policies for documents ReadByFilter can't decode, picked with
+// ?onDecodeError=. "fail" (the default) fails the request; "skip" leaves them
+// out and reports a partial result in the headers below: how many items were
+// skipped and the keys of the first maxSkippedKeys.
+const (
+	decodeErrorFail = "fail"
+	decodeErrorSkip = "skip"
+
+	partialResultHeader = "X-Partial-Result"
+	skippedCountHeader  = "X-Skipped-Count"
+	skippedItemsHeader  = "X-Skipped-Items"
+	maxSkippedKeys      = 20
+)
+
+func (s *Server) ReadByFilter(c *gin.Context, res *registry.Resource) {
+	item := res.New()
+	if !authorize(c, res, registry.OpList) {
+		return
+	}
+	ctx := readContext(c)
+	onDecodeError := c.DefaultQuery("onDecodeError", decodeErrorFail)
+	if onDecodeError != decodeErrorFail && onDecodeError != decodeErrorSkip {
+		problem.Write(c, problem.New(http.StatusBadRequest, "onDecodeError must be skip or fail"))
+		return
+	}
+	queryOptions, err := ExtractQueryOptions(c, res)
+	if err != nil {
+		problem.WriteError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	iter, err := s.store.ReadByFilter(ctx, queryOptions, item)
+	if err != nil {
+		problem.WriteError(c, err, http.StatusInternalServerError)
+		return
+	}
+	defer iter.Close(ctx)
+
+	entities := make([]dal.Item, 0)
+	skipped := make([]string, 0)
+	skippedCount := 0
+	for iter.Next(ctx) {
+		ent := item.New()
+		if err := iter.Decode(ent); err != nil {
+			if onDecodeError == decodeErrorFail {
+				problem.WriteError(c, err, http.StatusInternalServerError)
+				return
+			}
+			logging.FromContext(ctx).Warn("skipping item that can't be decoded", "error", err)
+			skippedCount++
+			var decodeErr *dal.DecodeError
+			if errors.As(err, &decodeErr) && len(skipped) < maxSkippedKeys {
+				skipped = append(skipped, formatKey(decodeErr.Key))
+			}
+			continue
+		}
+		entities = append(entities, ent)
+	}
+	if err := iter.Err(); err != nil {
+		problem.WriteError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	if skippedCount > 0 {
+		c.Header(partialResultHeader, "true")
+		c.Header(skippedCountHeader, strconv.Itoa(skippedCount))
+		c.Header(skippedItemsHeader, strings.Join(skipped, ","))
+	}
+	c.JSON(http.StatusOK, entities)
+}
+
+// formatKey renders an item key for headers and messages.
+func formatKey(key interface{}) string {
+	if id, ok := key.(primitive.ObjectID); ok {
+		return id.Hex()
+	}
+	return fmt.Sprint(key)
+}
+
+// ExtractQueryOptions builds the filter, sort and page of a list request;
+// without ?pageSize= it is the first DefaultPageSize items. Write-only fields
+// can't be filtered or sorted on, as the results would give their values
+// away.
+func ExtractQueryOptions(c *gin.Context, res *registry.Resource) (queryOptions dal.QueryOptions, err error) {
+	var mongoFilter bson.M
+	queryOptions = database.NewMongoDalQueryOptions(database.NewMongoFilter(mongoFilter), bson.D{}, 0, 0)
+
+	query := c.Request.URL.Query()
+	for _, field := range query["sort"] {
+		if res.IsWriteOnly(strings.TrimPrefix(field, "-")) {
+			return queryOptions, &dal.FilterError{Param: "sort", Value: field, Reason: "field can't be sorted on"}
+		}
+	}
+	sortOptions := filter.Sort(query["sort"])
+	pageSize, page, err := getPagination(query)
+	if err != nil {
+		return queryOptions, err
+	}
+	mongoFilter, err = filter.Parse(res.Item, query, res.IsWriteOnly)
+	if err == nil {
+		queryOptions = database.NewMongoDalQueryOptions(database.NewMongoFilter(mongoFilter), sortOptions, pageSize, (page-1)*pageSize)
+	}
+	
+	return queryOptions, err
+}
+
+// DefaultPageSize is the page size of list requests without ?pageSize=.
+const DefaultPageSize = 10
+
+func getPagination(query url.Values) (pageSize int64, page int64, err error) {
+	if pageSize, err = positiveParam(query, "pageSize", DefaultPageSize); err != nil {
+		return 0, 0, err
+	}
+	if page, err = positiveParam(query, "page", 1); err != nil {
+		return 0, 0, err
+	}
+	return pageSize, page, nil
+}
+
+// positiveParam reads a query parameter that must be a whole number from 1.
+func positiveParam(query url.Values, name string, fallback int64) (int64, error) {
+	value := query.Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 1 {
+		return 0, &dal.FilterError{Param: name, Value: value, Reason: "must be a whole number from 1"}
+	}
+	return n, nil
+}
+
+func (s *Server) UpdateByKey(c *gin.Context, res *registry.Resource) {
+	item := res.New()
+	key, ok := parseKey(c, res, c.Param("id"))
+	if !ok || !authorize(c, res, registry.OpUpdate) {
+		return
+	}
+
+	if _, ok := s.readBody(c, res, false); !ok {
+		return
+	}
+	if err := c.ShouldBindJSON(item); err != nil {
+		problem.WriteError(c, err, http.StatusBadRequest)
+		return
+	}
+	clearReadOnlyFields(item)
+	if len(res.ReadOnlyFields) > 0 {
+		stored := res.New()
+		if err := s.store.ReadByKey(c.Request.Context(), key, stored); err != nil {
+			problem.WriteError(c, err, http.StatusInternalServerError)
+			return
+		}
+		res.KeepReadOnly(item, stored)
+	}
+	if err := dal.ValidateItem(c.Request.Context(), item); err != nil {
+		problem.WriteError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	item.SetKey(key)
+	_, err := s.store.UpdateByKey(c.Request.Context(), key, item)
+	if err != nil {
+		problem.WriteError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// PatchByKey applies a JSON merge patch (RFC 7386) to an item: fields in the
+// body replace the stored ones, nested objects are merged field by field and
+// null clears pointer, list and map fields. Read-only fields are ignored.
+func (s *Server) PatchByKey(c *gin.Context, res *registry.Resource) {
+	item := res.New()
+	key, ok := parseKey(c, res, c.Param("id"))
+	if !ok || !authorize(c, res, registry.OpUpdate) {
+		return
+	}
+
+	patch, ok := s.readBody(c, res, true)
+	if !ok {
+		return
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &fields); err != nil {
+		problem.Write(c, problem.New(http.StatusBadRequest, "A merge patch must be a JSON object."))
+		return
+	}
+	for name := range fields {
+		if res.IsReadOnly(name) {
+			delete(fields, name)
+		}
+	}
+	patch, err := json.Marshal(fields)
+	if err != nil {
+		problem.WriteError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.store.ReadByKey(c.Request.Context(), key, item); err != nil {
+		problem.WriteError(c, err, http.StatusInternalServerError)
+		return
+	}
+	if err := json.Unmarshal(patch, item); err != nil {
+		problem.WriteError(c, err, http.StatusBadRequest)
+		return
+	}
+	clearReadOnlyFields(item)
+	if err := dal.ValidateItem(c.Request.Context(), item); err != nil {
+		problem.WriteError(c, err, http.StatusBadRequest)
+		return
+	}
+
+	item.SetKey(key)
+	if _, err := s.store.UpdateByKey(c.Request.Context(), key, item); err != nil {
+		problem.WriteError(c, err, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+func (s *Server) DeleteByKey(c *gin.Context, res *registry.Resource) {
+	item := res.New()
+	key, ok := parseKey(c, res, c.Param("id"))
+	if !ok || !authorize(c, res, registry.OpDelete) {
+		return
+	}
+
+	// ?purge=true removes soft deletable items for good
+	purge, _ := strconv.ParseBool(c.Query("purge"))
+
+	// Save the result to get the DeletedCount
+	deleteFn := s.store.DeleteByKey
+	if purge {
+		deleteFn = s.store.PurgeByKey
+	}
+	deletedCount, err := deleteFn(c.Request.Context(), key, item)
+	if err != nil {
+		problem.WriteError(c, err, http.StatusInternalServerError)
+		return
+	}
+	if deletedCount == 0 {
+		problem.Write(c, problem.New(http.StatusNotFound, "No entity found to delete"))
+		return
+	}
+
+	if !purge && dal.IsSoftDeletable(item) {
+		c.JSON(http.StatusOK, gin.H{"message": "Deleted 1 entry (restorable)"})
+		return
+	}
+
+	label := "entries"
+	if deletedCount == 1 {
+		label = "entry"
+	}
+	msg := fmt.Sprintf("Deleted %d %s", deletedCount, label)
+	c.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+// PostAction handles custom actions addressed as POST /{resource}/:id:{action},
+// e.g. POST /users/6791...:restore. Gin only allows one parameter per path
+// segment, so the action is split off the id here.
+func (s *Server) PostAction(c *gin.Context, res *registry.Resource) {
+	id, action, _ := strings.Cut(c.Param("id"), ":")
+	switch {
+	case action == "restore" && res.Allows(registry.OpRestore):
+		s.RestoreByKey(c, id, res)
+	case action == "revert" && res.Allows(registry.OpHistory) && res.Allows(registry.OpUpdate):
+		s.RevertByKey(c, id, res)
+	default:
+		problem.Write(c, problem.New(http.StatusNotFound, fmt.Sprintf("unknown action %q", action)))
+	}
+}
+
+func (s *Server) RestoreByKey(c *gin.Context, id string, res *registry.Resource) {
+	item := res.New()
+	key, ok := parseKey(c, res, id)
+	if !ok || !authorize(c, res, registry.OpRestore) {
+		return
+	}
+
+	restoredCount, err := s.store.RestoreByKey(c.Request.Context(), key, item)
+	if errors.Is(err, dal.ErrNotSoftDeletable) {
+		problem.WriteError(c, err, http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		problem.WriteError(c, err, http.StatusInternalServerError)
+		return
+	}
+	if restoredCount == 0 {
+		problem.Write(c, problem.New(http.StatusNotFound, "No deleted entity found to restore"))
+		return
+	}
+
+	if err := s.store.ReadByKey(c.Request.Context(), key, item); err != nil {
+		problem.WriteError(c, err, http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, item)
+}
+
+// ReadAsOf returns an item as it was at the given RFC3339 time, served from
+// its history.
+func (s *Server) ReadAsOf(c *gin.Context, key interface{}, asOf string, item dal.Item) {
+	if !s.requireHistory(c) {
+		return
+	}
+	at, err := time.Parse(time.RFC3339, asOf)
+	if err != nil {
+		problem.Write(c, problem.New(http.StatusBadRequest, fmt.Sprintf("invalid asOf time: %v", err)))
+		return
+	}
+
+	rev, err := s.history.AsOf(c.Request.Context(), key, at, item)
+	if err != nil {
+		problem.WriteError(c, err, http.StatusInternalServerError)
+		return
+	}
+	if rev.Removed() {
+		problem.Write(c, problem.New(http.StatusNotFound, fmt.Sprintf("entity was deleted at %s", rev.At.Format(time.RFC3339))))
+		return
+	}
+
+	historic, err := rev.Decode(item)
+	if err != nil {
+		problem.WriteError(c, err, http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, historic)
+}
+
+// revisionSummary is how a revision is listed by the history endpoints.
+type revisionSummary struct {
+	Revision int64     `json:"revision"`
+	Op       string    `json:"op"`
+	Actor    string    `json:"actor,omitempty"`
+	At       time.Time `json:"at"`
+	Item     dal.Item  `json:"item,omitempty"`
+}
+
+func (s *Server) ReadHistory(c *gin.Context, res *registry.Resource) {
+	item := res.New()
+	if !s.requireHistory(c) {
+		return
+	}
+	key, ok := parseKey(c, res, c.Param("id"))
+	if !ok || !authorize(c, res, registry.OpHistory) {
+		return
+	}
+
+	revisions, err := s.history.List(c.Request.Context(), key, item)
+	if err != nil {
+		problem.WriteError(c, err, http.StatusInternalServerError)
+		return
+	}
+	if len(revisions) == 0 {
+		problem.Write(c, problem.New(http.StatusNotFound, "No history found"))
+		return
+	}
+
+	summaries := make([]revisionSummary, 0, len(revisions))
+	for _, rev := range revisions {
+		summaries = append(summaries, revisionSummary{Revision: rev.Number, Op: rev.Op, Actor: rev.Actor, At: rev.At})
+	}
+	c.JSON(http.StatusOK, summaries)
+}
+
+func (s *Server) ReadRevision(c *gin.Context, res *registry.Resource) {
+	item := res.New()
+	if !s.requireHistory(c) {
+		return
+	}
+	key, ok := parseKey(c, res, c.Param("id"))
+	if !ok || !authorize(c, res, registry.OpHistory) {
+		return
+	}
+	number, err := strconv.ParseInt(c.Param("rev"), 10, 64)
+	if err != nil {
+		problem.Write(c, problem.New(http.StatusBadRequest, "Invalid revision number"))
+		return
+	}
+
+	rev, err := s.history.Get(c.Request.Context(), key, number, item)
+	if err != nil {
+		problem.WriteError(c, err, http.StatusInternalServerError)
+		return
+	}
+	historic, err := rev.Decode(item)
+	if err != nil {
+		problem.WriteError(c, err, http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, revisionSummary{Revision: rev.Number, Op: rev.Op, Actor: rev.Actor, At: rev.At, Item: historic})
+}
+
+// RevertByKey handles POST /{resource}/:id:revert?revision=N.
+func (s *Server) RevertByKey(c *gin.Context, id string, res *registry.Resource) {
+	item := res.New()
+	if !s.requireHistory(c) {
+		return
+	}
+	key, ok := parseKey(c, res, id)
+	if !ok || !authorize(c, res, registry.OpHistory) || !authorize(c, res, registry.OpUpdate) {
+		return
+	}
+	number, err := strconv.ParseInt(c.Query("revision"), 10, 64)
+	if err != nil {
+		problem.Write(c, problem.New(http.StatusBadRequest, "revision query parameter must be a revision number"))
+		return
+	}
+
+	reverted, err := dal.Revert(c.Request.Context(), s.store, s.history, key, number, item)
+	if err != nil {
+		problem.WriteError(c, err, http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, reverted)
+}
@@ -0,0 +1,181 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/database"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/seebasoft/prompter/goback/registry"
+)
+
+
+func usersResource(t *testing.T) *registry.Resource {
+	t.Helper()
+	resources, err := models.Resources()
+	require.NoError(t, err)
+	users, ok := resources.Lookup("users")
+	require.True(t, ok)
+	return users
+}
+
+func TestReadByKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := database.NewMemoryStore()
+	objectID := primitive.NewObjectID()
+	_, err := store.Create(context.Background(), &models.User{ID: objectID, Username: "jdoe", Email: "jdoe@example.com"})
+	require.NoError(t, err)
+
+	server := NewServer(store, Options{})
+	router := gin.Default()
+	router.GET("/read/:id", func(c *gin.Context) {
+		server.ReadByKey(c, usersResource(t))
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/read/"+objectID.Hex(), nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"username":"jdoe"`)
+}
+
+func TestCreateRejectsInvalidItem(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := NewServer(database.NewMemoryStore(), Options{})
+	router := gin.Default()
+	router.POST("/users", func(c *gin.Context) {
+		server.Create(c, usersResource(t))
+	})
+
+	body := strings.NewReader(`{"username": "x", "email": "nope"}`)
+	req, _ := http.NewRequest(http.MethodPost, "/users", body)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"field":"username"`)
+	assert.Contains(t, resp.Body.String(), `"field":"email"`)
+}
+
+func TestReadByFilterRejectsInvalidFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := NewServer(database.NewMemoryStore(), Options{})
+	router := gin.Default()
+	router.GET("/users", func(c *gin.Context) {
+		server.ReadByFilter(c, usersResource(t))
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/users?birthdate_after=yesterday", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "application/problem+json", resp.Header().Get("Content-Type"))
+	assert.Contains(t, resp.Body.String(), `"type":"/problems/invalid-filter"`)
+	assert.Contains(t, resp.Body.String(), `"field":"birthdate_after"`)
+}
+
+func TestReadByFilterRejectsWriteOnlyFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	resources, err := models.Resources()
+	require.NoError(t, err)
+	webhooks, _ := resources.Lookup("webhooks")
+	server := NewServer(database.NewMemoryStore(), Options{})
+	router := gin.Default()
+	router.GET("/webhooks", func(c *gin.Context) {
+		server.ReadByFilter(c, webhooks)
+	})
+
+	for _, query := range []string{"secret_startswith=a", "secret=x", "sort=-secret"} {
+		req, _ := http.NewRequest(http.MethodGet, "/webhooks?"+query, nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, query)
+		assert.Contains(t, resp.Body.String(), `"type":"/problems/invalid-filter"`, query)
+	}
+}
+
+// brokenUser is stored with the users but can't be decoded as a models.User.
+type brokenUser struct {
+	ID       primitive.ObjectID `bson:"_id"`
+	Username int                `bson:"username"`
+}
+
+func (u *brokenUser) Namespace() string            { return "core" }
+func (u *brokenUser) ItemGroup() string            { return "users" }
+func (u *brokenUser) Marshal() ([]byte, error)     { return bson.Marshal(u) }
+func (u *brokenUser) Unmarshal(raw []byte) error   { return bson.Unmarshal(raw, u) }
+func (u *brokenUser) New() dal.Item                { return &brokenUser{} }
+func (u *brokenUser) GetKey() interface{}          { return u.ID }
+func (u *brokenUser) SetKey(key interface{}) error { u.ID = key.(primitive.ObjectID); return nil }
+
+func TestReadByFilterCapsSkippedKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := database.NewMemoryStore()
+	ctx := context.Background()
+	for i := 0; i < 25; i++ {
+		_, err := store.Create(ctx, &brokenUser{ID: primitive.NewObjectID(), Username: i})
+		require.NoError(t, err)
+	}
+	_, err := store.Create(ctx, &models.User{ID: primitive.NewObjectID(), Username: "jdoe", Email: "jdoe@example.com"})
+	require.NoError(t, err)
+
+	server := NewServer(store, Options{})
+	router := gin.Default()
+	router.GET("/users", func(c *gin.Context) {
+		server.ReadByFilter(c, usersResource(t))
+	})
+	req, _ := http.NewRequest(http.MethodGet, "/users?onDecodeError=skip&pageSize=100", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"username":"jdoe"`)
+	assert.Equal(t, "true", resp.Header().Get("X-Partial-Result"))
+	assert.Equal(t, "25", resp.Header().Get("X-Skipped-Count"))
+	assert.Len(t, strings.Split(resp.Header().Get("X-Skipped-Items"), ","), 20)
+}
+
+func TestReadByFilterPagesByDefault(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := database.NewMemoryStore()
+	ctx := context.Background()
+	for i := 0; i < DefaultPageSize+2; i++ {
+		_, err := store.Create(ctx, &models.User{ID: primitive.NewObjectID(), Username: fmt.Sprintf("user%d", i), Email: fmt.Sprintf("user%d@example.com", i)})
+		require.NoError(t, err)
+	}
+
+	server := NewServer(store, Options{})
+	router := gin.Default()
+	router.GET("/users", func(c *gin.Context) {
+		server.ReadByFilter(c, usersResource(t))
+	})
+	list := func(target string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, target, nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := list("/users")
+	require.Equal(t, http.StatusOK, resp.Code)
+	var users []models.User
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &users))
+	assert.Len(t, users, DefaultPageSize)
+
+	for _, target := range []string{"/users?pageSize=0", "/users?page=0", "/users?pageSize=ten"} {
+		assert.Equal(t, http.StatusBadRequest, list(target).Code, target)
+	}
+}
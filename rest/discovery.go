@@ -0,0 +1,57 @@
+package rest
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/seebasoft/prompter/goback/registry"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Discovery is the root document listing the API's resources.
+type Discovery struct {
+	Title     string              `json:"title"`
+	Body      string              `json:"body"`
+	Resources []DiscoveryResource `json:"resources"`
+}
+
+// DiscoveryResource describes one resource and where to find it.
+type DiscoveryResource struct {
+	Name        string               `json:"name"`
+	Description string               `json:"description,omitempty"`
+	Operations  []registry.Operation `json:"operations"`
+	Links       map[string]string    `json:"links"`
+}
+
+// NewDiscovery describes the resources served under basePath.
+func NewDiscovery(title, basePath string, resources *registry.Registry) *Discovery {
+	doc := &Discovery{Title: title, Resources: make([]DiscoveryResource, 0)}
+	names := make([]string, 0)
+	for _, res := range resources.Resources() {
+		collection := path.Join(basePath, res.Name)
+		links := map[string]string{
+			"collection": collection,
+			"item":       collection + "/{id}",
+			"schema":     path.Join(basePath, "schemas", res.Name),
+		}
+		if res.Allows(registry.OpHistory) {
+			links["history"] = collection + "/{id}/history"
+		}
+		doc.Resources = append(doc.Resources, DiscoveryResource{
+			Name:        res.Name,
+			Description: res.Description,
+			Operations:  res.Operations,
+			Links:       links,
+		})
+		names = append(names, res.Name)
+	}
+	doc.Body = "Endpoints: " + strings.Join(names, ", ")
+	return doc
+}
+
+// Handler serves the document.
+func (d *Discovery) Handler(c *gin.Context) {
+	c.JSON(http.StatusOK, d)
+}
@@ -0,0 +1,117 @@
+// Package rest serves dal Items as REST resources. Handlers work on the Store
+// the Server is built with, so any backend, or a decorated stack of them, can
+// be plugged in.
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/problem"
+	"github.com/seebasoft/prompter/goback/registry"
+	"github.com/seebasoft/prompter/goback/schema"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Options configures the optional parts of a Server.
+type Options struct {
+	// History serves the history endpoints and ?asOf= reads; without it they
+	// answer 501.
+	History dal.HistoryLog
+}
+
+// Server holds the dependencies of the REST handlers.
+type Server struct {
+	store   dal.Store
+	history dal.HistoryLog
+
+	schemasMu sync.Mutex
+	schemas   map[*registry.Resource]*schema.Schema
+}
+
+// NewServer creates a Server whose handlers use store.
+func NewServer(store dal.Store, options Options) *Server {
+	return &Server{
+		store:   store,
+		history: options.History,
+		schemas: make(map[*registry.Resource]*schema.Schema),
+	}
+}
+
+// SetRoutes registers the routes of every resource in resources, and
+// schemas/:resource serving their JSON Schemas.
+func (s *Server) SetRoutes(engine *gin.RouterGroup, resources *registry.Registry) {
+	for _, res := range resources.Resources() {
+		s.SetResourceRoutes(engine, res)
+	}
+	engine.GET("schemas/:resource", func(c *gin.Context) { s.ReadSchema(c, resources) })
+}
+
+// SetResourceRoutes registers the routes of the operations a resource allows.
+// Every request gets a fresh item from res.New() so concurrent requests don't
+// share state.
+func (s *Server) SetResourceRoutes(engine *gin.RouterGroup, res *registry.Resource) {
+	handle := func(handler func(*gin.Context, *registry.Resource)) gin.HandlerFunc {
+		return func(c *gin.Context) { handler(c, res) }
+	}
+	collection, member := res.Name, fmt.Sprintf("%s/:id", res.Name)
+	if res.Allows(registry.OpCreate) {
+		engine.POST(collection, handle(s.Create))
+	}
+	if res.Allows(registry.OpList) {
+		engine.GET(collection, handle(s.ReadByFilter))
+	}
+	if res.Allows(registry.OpRead) {
+		engine.GET(member, handle(s.ReadByKey))
+	}
+	if res.Allows(registry.OpUpdate) {
+		engine.PUT(member, handle(s.UpdateByKey))
+		engine.PATCH(member, handle(s.PatchByKey))
+	}
+	if res.Allows(registry.OpDelete) {
+		engine.DELETE(member, handle(s.DeleteByKey))
+	}
+	if res.Allows(registry.OpRestore) || res.Allows(registry.OpHistory) {
+		engine.POST(member, handle(s.PostAction))
+	}
+	if res.Allows(registry.OpHistory) {
+		engine.GET(member+"/history", handle(s.ReadHistory))
+		engine.GET(member+"/history/:rev", handle(s.ReadRevision))
+	}
+}
+
+// schema returns the resource's JSON Schema, deriving it on first use.
+func (s *Server) schema(res *registry.Resource) *schema.Schema {
+	s.schemasMu.Lock()
+	defer s.schemasMu.Unlock()
+	resourceSchema, ok := s.schemas[res]
+	if !ok {
+		resourceSchema = schema.ForResource(res)
+		s.schemas[res] = resourceSchema
+	}
+	return resourceSchema
+}
+
+// ReadSchema serves the JSON Schema of a registered resource.
+func (s *Server) ReadSchema(c *gin.Context, resources *registry.Registry) {
+	res, ok := resources.Lookup(c.Param("resource"))
+	if !ok {
+		problem.Write(c, problem.New(http.StatusNotFound, fmt.Sprintf("unknown resource %q", c.Param("resource"))))
+		return
+	}
+	c.Header("Content-Type", schema.ContentType)
+	c.JSON(http.StatusOK, s.schema(res))
+}
+
+// requireHistory writes a problem and returns false when the Server has no
+// history log.
+func (s *Server) requireHistory(c *gin.Context) bool {
+	if s.history == nil {
+		problem.Write(c, problem.New(http.StatusNotImplemented, "history isn't recorded for this resource"))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/seebasoft/prompter/goback/auth"
+	"github.com/seebasoft/prompter/goback/database"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/seebasoft/prompter/goback/problem"
+	"github.com/seebasoft/prompter/goback/registry"
+	"github.com/seebasoft/prompter/goback/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetRoutesFromRegistry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	resources := registry.New()
+	_, err := resources.Register(&models.User{}, registry.Options{
+		Operations:     registry.ReadOnly,
+		ReadOnlyFields: []string{"id"},
+	})
+	require.NoError(t, err)
+	_, err = resources.Register(&models.Webhook{}, registry.Options{
+		Authorize: registry.RequireActor(registry.OpCreate),
+	})
+	require.NoError(t, err)
+
+	engine := gin.New()
+	engine.HandleMethodNotAllowed = true
+	engine.NoMethod(problem.NoMethod)
+	secret := []byte("test-secret")
+	engine.Use(auth.Middleware(auth.Options{Secret: secret}))
+	v1 := engine.Group("/rest/v1")
+	engine.GET("/", NewDiscovery("API", v1.BasePath(), resources).Handler)
+	NewServer(database.NewMemoryStore(), Options{}).SetRoutes(v1, resources)
+
+	serve := func(method, target, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	// users are read only
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/rest/v1/users", "", nil).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPost, "/rest/v1/users", `{}`, nil).Code)
+
+	// creating webhooks needs an actor
+	webhook := `{"url": "https://example.com/hook", "events": ["*"], "secret": "0123456789abcdef"}`
+	w := serve(http.MethodPost, "/rest/v1/webhooks", webhook, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), `"type":"/problems/forbidden"`)
+	forged, err := auth.Sign(auth.Claims{"sub": "alice"}, []byte("guessed"))
+	require.NoError(t, err)
+	w = serve(http.MethodPost, "/rest/v1/webhooks", webhook, http.Header{"Authorization": {"Bearer " + forged}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	token, err := auth.Sign(auth.Claims{"sub": "alice"}, secret)
+	require.NoError(t, err)
+	w = serve(http.MethodPost, "/rest/v1/webhooks", webhook, http.Header{"Authorization": {"Bearer " + token}})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = serve(http.MethodGet, "/", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"title": "API",
+		"body": "Endpoints: users, webhooks",
+		"resources": [
+			{"name": "users", "operations": ["read", "list", "history"], "links": {
+				"collection": "/rest/v1/users", "item": "/rest/v1/users/{id}", "schema": "/rest/v1/schemas/users", "history": "/rest/v1/users/{id}/history"}},
+			{"name": "webhooks", "operations": ["create", "read", "list", "update", "delete", "restore", "history"], "links": {
+				"collection": "/rest/v1/webhooks", "item": "/rest/v1/webhooks/{id}", "schema": "/rest/v1/schemas/webhooks", "history": "/rest/v1/webhooks/{id}/history"}}
+		]
+	}`, w.Body.String())
+}
+
+func TestSchemasAndPatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	resources, err := models.Resources()
+	require.NoError(t, err)
+	engine := gin.New()
+	v1 := engine.Group("/rest/v1")
+	NewServer(database.NewMemoryStore(), Options{}).SetRoutes(v1, resources)
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	w := serve(http.MethodGet, "/rest/v1/schemas/users", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, schema.ContentType, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `"minLength":3`)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/rest/v1/schemas/nope", "").Code)
+
+	// bodies are checked against the schema before binding
+	w = serve(http.MethodPost, "/rest/v1/webhooks", `{"url": "https://example.com/hook", "events": ["*", 3], "secret": "0123456789abcdef"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"events[1]"`)
+
+	w = serve(http.MethodPost, "/rest/v1/users", `{"username": "jdoe", "email": "jdoe@example.com", "createdBy": "mallory"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var user models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	target := "/rest/v1/users/" + user.ID.Hex()
+
+	w = serve(http.MethodPatch, target, `{"username": "x"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"username"`)
+
+	w = serve(http.MethodPatch, target, `{"username": "janedoe", "createdBy": "mallory"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	assert.Equal(t, "janedoe", user.Username)
+	assert.Equal(t, "jdoe@example.com", user.Email)
+	assert.Empty(t, user.CreatedBy)
+}
@@ -0,0 +1,70 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/seebasoft/prompter/goback/database"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/seebasoft/prompter/goback/problem"
+	"github.com/seebasoft/prompter/goback/registry"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetWebhookRoutes registers the delivery log of a registered webhooks
+// resource; reading it counts as reading the webhook.
+func (s *Server) SetWebhookRoutes(engine *gin.RouterGroup, webhooks *registry.Resource) {
+	engine.GET(webhooks.Name+"/deadletters", func(c *gin.Context) { s.ReadDeadLetters(c, webhooks) })
+	engine.GET(webhooks.Name+"/:id/deliveries", func(c *gin.Context) { s.ReadDeliveries(c, webhooks) })
+}
+
+// ReadDeliveries returns the delivery log of a webhook, newest first.
+func (s *Server) ReadDeliveries(c *gin.Context, webhooks *registry.Resource) {
+	key, ok := parseKey(c, webhooks, c.Param("id"))
+	if !ok || !authorize(c, webhooks, registry.OpRead) {
+		return
+	}
+	s.readDeliveries(c, bson.M{"webhookId": key})
+}
+
+// ReadDeadLetters returns the deliveries that failed for good.
+func (s *Server) ReadDeadLetters(c *gin.Context, webhooks *registry.Resource) {
+	if !authorize(c, webhooks, registry.OpList) {
+		return
+	}
+	s.readDeliveries(c, bson.M{"status": models.DeliveryDead})
+}
+
+func (s *Server) readDeliveries(c *gin.Context, filter bson.M) {
+	ctx := c.Request.Context()
+	pageSize, page, err := getPagination(c.Request.URL.Query())
+	if err != nil {
+		problem.WriteError(c, err, http.StatusBadRequest)
+		return
+	}
+	sort := bson.D{{Key: "attemptedAt", Value: -1}}
+	opts := database.NewMongoDalQueryOptions(database.NewMongoFilter(filter), sort, pageSize, (page-1)*pageSize)
+
+	iter, err := s.store.ReadByFilter(ctx, opts, &models.WebhookDelivery{})
+	if err != nil {
+		problem.WriteError(c, err, http.StatusInternalServerError)
+		return
+	}
+	defer iter.Close(ctx)
+
+	deliveries := make([]*models.WebhookDelivery, 0)
+	for iter.Next(ctx) {
+		delivery := &models.WebhookDelivery{}
+		if err := iter.Decode(delivery); err != nil {
+			problem.WriteError(c, err, http.StatusInternalServerError)
+			return
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := iter.Err(); err != nil {
+		problem.WriteError(c, err, http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
@@ -0,0 +1,238 @@
+// Package schema derives JSON Schemas (draft 2020-12) from Item structs and
+// validates request bodies against them. Types come from the Go fields,
+// formats from well known types such as time.Time, and constraints from the
+// same `validate` tags dal.ValidateItem checks.
+package schema
+
+import (
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/registry"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Draft is the JSON Schema dialect of generated schemas.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// ContentType is the media type schemas are served as.
+const ContentType = "application/schema+json"
+
+// Schema is the subset of JSON Schema the package generates and validates.
+type Schema struct {
+	Dialect     string             `json:"$schema,omitempty"`
+	Ref         string             `json:"$ref,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Type        interface{}        `json:"type,omitempty"` // a type name, or a list of them for nullable values
+	Format      string             `json:"format,omitempty"`
+	Pattern     string             `json:"pattern,omitempty"`
+	Enum        []interface{}      `json:"enum,omitempty"`
+	Default     interface{}        `json:"default,omitempty"`
+	MinLength   *int               `json:"minLength,omitempty"`
+	MaxLength   *int               `json:"maxLength,omitempty"`
+	Minimum     *float64           `json:"minimum,omitempty"`
+	Maximum     *float64           `json:"maximum,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	MinItems    *int               `json:"minItems,omitempty"`
+	MaxItems    *int               `json:"maxItems,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	ReadOnly    bool               `json:"readOnly,omitempty"`
+	WriteOnly   bool               `json:"writeOnly,omitempty"`
+
+	// patternRule is the validate tag a Pattern came from, e.g. "alphanum",
+	// so errors name the same rule dal.ValidateItem would.
+	patternRule string
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	objectIDType = reflect.TypeOf(primitive.ObjectID{})
+)
+
+// ForResource returns the schema of a registered resource's Item, marking
+// its read-only and write-only fields.
+func ForResource(res *registry.Resource) *Schema {
+	s := ForStruct(reflect.TypeOf(res.Item).Elem(), res.IsReadOnly)
+	for _, name := range res.WriteOnlyFields {
+		s.Properties[name].WriteOnly = true
+	}
+	s.Dialect = Draft
+	s.Title = res.Name
+	s.Description = res.Description
+	return s
+}
+
+// ForType describes a Go type as its JSON encoding.
+func ForType(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Ptr {
+		return nullable(ForType(t.Elem()))
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case objectIDType:
+		return &Schema{Type: "string", Pattern: "^[0-9a-f]{24}$", patternRule: "objectid"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice:
+		// nil slices encode as null
+		return nullable(&Schema{Type: "array", Items: ForType(t.Elem())})
+	case reflect.Array:
+		return &Schema{Type: "array", Items: ForType(t.Elem())}
+	case reflect.Map:
+		return nullable(&Schema{Type: "object"})
+	case reflect.Struct:
+		return ForStruct(t, nil)
+	}
+	return &Schema{}
+}
+
+// ForStruct describes a struct's exported, JSON encoded fields. readOnly, if
+// given, reports the JSON names clients can't set.
+func ForStruct(t reflect.Type, readOnly func(jsonName string) bool) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := ForType(field.Type)
+		if readOnly != nil && readOnly(name) {
+			property.ReadOnly = true
+		}
+		if applyRules(property, field.Tag.Get("validate")) && !property.ReadOnly {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = property
+	}
+	return s
+}
+
+// nullable adds "null" to the schema's type.
+func nullable(s *Schema) *Schema {
+	if name, ok := s.Type.(string); ok {
+		s.Type = []string{name, "null"}
+	}
+	return s
+}
+
+// types returns the schema's type names.
+func (s *Schema) types() []string {
+	switch t := s.Type.(type) {
+	case string:
+		return []string{t}
+	case []string:
+		return t
+	}
+	return nil
+}
+
+// applyRules translates validate tag rules into schema keywords and reports
+// whether the field is required. Rules without a JSON Schema equivalent are
+// left to dal.ValidateItem, and so are all the rules of omitempty fields:
+// they don't apply to empty values, which the keywords would reject.
+func applyRules(s *Schema, tag string) (required bool) {
+	if tag == "" || tag == "-" {
+		return false
+	}
+	rules := strings.Split(tag, ",")
+	if slices.Contains(rules, "omitempty") {
+		return false
+	}
+	kind := ""
+	if types := s.types(); len(types) > 0 {
+		kind = types[0]
+	}
+	for _, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "email":
+			s.Format = "email"
+		case "url", "uri":
+			s.Format = "uri"
+		case "uuid":
+			s.Format = "uuid"
+		case "alphanum":
+			s.Pattern, s.patternRule = "^[a-zA-Z0-9]*$", name
+		case "alpha":
+			s.Pattern, s.patternRule = "^[a-zA-Z]*$", name
+		case "numeric":
+			s.Pattern, s.patternRule = "^[-+]?[0-9]+(\\.[0-9]+)?$", name
+		case "oneof":
+			for _, value := range strings.Fields(param) {
+				s.Enum = append(s.Enum, enumValue(kind, value))
+			}
+		case "min", "gte":
+			setBound(s, kind, param, true)
+		case "max", "lte":
+			setBound(s, kind, param, false)
+		case "len":
+			setBound(s, kind, param, true)
+			setBound(s, kind, param, false)
+		}
+	}
+	return required
+}
+
+// setBound sets a length, count or value limit depending on the field's kind.
+func setBound(s *Schema, kind, param string, lower bool) {
+	switch kind {
+	case "string", "array":
+		n, err := strconv.Atoi(param)
+		if err != nil {
+			return
+		}
+		switch {
+		case kind == "string" && lower:
+			s.MinLength = &n
+		case kind == "string":
+			s.MaxLength = &n
+		case lower:
+			s.MinItems = &n
+		default:
+			s.MaxItems = &n
+		}
+	case "integer", "number":
+		f, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return
+		}
+		if lower {
+			s.Minimum = &f
+		} else {
+			s.Maximum = &f
+		}
+	}
+}
+
+func enumValue(kind, value string) interface{} {
+	switch kind {
+	case "integer", "number":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return value
+}
@@ -0,0 +1,105 @@
+package schema_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/seebasoft/prompter/goback/registry"
+	"github.com/seebasoft/prompter/goback/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func resourceSchema(t *testing.T, name string) *schema.Schema {
+	t.Helper()
+	resources, err := models.Resources()
+	require.NoError(t, err)
+	res, ok := resources.Lookup(name)
+	require.True(t, ok)
+	return schema.ForResource(res)
+}
+
+func TestForResource(t *testing.T) {
+	users := resourceSchema(t, "users")
+	assert.Equal(t, schema.Draft, users.Dialect)
+	assert.ElementsMatch(t, []string{"username", "email"}, users.Required)
+
+	username := users.Properties["username"]
+	assert.Equal(t, "string", username.Type)
+	assert.Equal(t, 3, *username.MinLength)
+	assert.Equal(t, 20, *username.MaxLength)
+	assert.Equal(t, "^[a-zA-Z0-9]*$", username.Pattern)
+	assert.Equal(t, "email", users.Properties["email"].Format)
+	assert.Equal(t, "date-time", users.Properties["birthdate"].Format)
+	assert.True(t, users.Properties["createdAt"].ReadOnly)
+
+	webhooks := resourceSchema(t, "webhooks")
+	assert.Equal(t, []string{"array", "null"}, webhooks.Properties["events"].Type)
+	assert.Equal(t, 1, *webhooks.Properties["events"].MinItems)
+	assert.Equal(t, "uri", webhooks.Properties["url"].Format)
+}
+
+type ticket struct {
+	Priority int    `json:"priority" validate:"min=1,max=5"`
+	Status   string `json:"status" validate:"required,oneof=open closed"`
+	Password string `json:"password" validate:"omitempty,min=8"`
+	Contact  string `json:"contact" validate:"omitempty,email"`
+}
+
+func (t *ticket) Namespace() string           { return "test" }
+func (t *ticket) ItemGroup() string           { return "tickets" }
+func (t *ticket) GetKey() interface{}         { return nil }
+func (t *ticket) SetKey(interface{}) error    { return nil }
+func (t *ticket) Marshal() ([]byte, error)    { return nil, nil }
+func (t *ticket) Unmarshal(data []byte) error { return nil }
+func (t *ticket) New() dal.Item               { return &ticket{} }
+
+func fieldErrors(t *testing.T, err error) map[string]dal.FieldError {
+	t.Helper()
+	var validationErr *dal.ValidationError
+	require.True(t, errors.As(err, &validationErr), "got %v", err)
+	byField := make(map[string]dal.FieldError)
+	for _, fe := range validationErr.Errors {
+		byField[fe.Field] = fe
+	}
+	return byField
+}
+
+func TestValidate(t *testing.T) {
+	webhooks := resourceSchema(t, "webhooks")
+	assert.NoError(t, webhooks.Validate([]byte(`{"url": "https://example.com", "events": ["*"], "secret": "0123456789abcdef", "createdAt": "ignored"}`)))
+
+	errs := fieldErrors(t, webhooks.Validate([]byte(`{"url": "nope", "events": ["users.created", 7], "active": "yes"}`)))
+	assert.Equal(t, "url", errs["url"].Rule)
+	assert.Equal(t, "type", errs["events[1]"].Rule)
+	assert.Equal(t, "events[1] must be a string", errs["events[1]"].Message)
+	assert.Equal(t, "type", errs["active"].Rule)
+	assert.Equal(t, "required", errs["secret"].Rule)
+	assert.Len(t, errs, 4)
+
+	// Partial documents may leave out required fields
+	assert.NoError(t, webhooks.ValidatePartial([]byte(`{"active": false}`)))
+	assert.Contains(t, fieldErrors(t, webhooks.ValidatePartial([]byte(`{"events": []}`))), "events")
+
+	resources := registry.New()
+	res, err := resources.Register(&ticket{}, registry.Options{})
+	require.NoError(t, err)
+	tickets := schema.ForResource(res)
+	assert.Equal(t, []interface{}{"open", "closed"}, tickets.Properties["status"].Enum)
+	errs = fieldErrors(t, tickets.Validate([]byte(`{"priority": 9, "status": "stale"}`)))
+	assert.Equal(t, dal.FieldError{Field: "priority", Rule: "max", Param: "5", Message: "priority must be at most 5"}, errs["priority"])
+	assert.Equal(t, "oneof", errs["status"].Rule)
+	errs = fieldErrors(t, tickets.Validate([]byte(`{"priority": 1.5, "status": "open"}`)))
+	assert.Equal(t, "type", errs["priority"].Rule)
+
+	assert.Error(t, tickets.Validate([]byte(`{"priority":`)))
+
+	// omitempty rules are left to dal.ValidateItem, which skips empty values
+	assert.NoError(t, tickets.Validate([]byte(`{"priority": 1, "status": "open", "password": "", "contact": ""}`)))
+	assert.NoError(t, dal.ValidateItem(context.Background(), &ticket{Priority: 1, Status: "open"}))
+	assert.Nil(t, tickets.Properties["password"].MinLength)
+	assert.Empty(t, tickets.Properties["contact"].Format)
+}
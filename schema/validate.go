@@ -0,0 +1,244 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/seebasoft/prompter/goback/dal"
+)
+
+// Validate checks a JSON document against the schema. Violations are
+// returned together as a *dal.ValidationError whose field paths point into
+// the document, e.g. "events[2]"; malformed JSON is returned as the decoding
+// error. Read-only properties aren't checked since their values are ignored.
+func (s *Schema) Validate(data []byte) error {
+	return s.validate(data, false)
+}
+
+// ValidatePartial is Validate for partial documents such as merge patches:
+// required properties may be missing.
+func (s *Schema) ValidatePartial(data []byte) error {
+	return s.validate(data, true)
+}
+
+func (s *Schema) validate(data []byte, partial bool) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return err
+	}
+	v := &validation{partial: partial}
+	v.check(s, doc, "")
+	if len(v.errs) > 0 {
+		return &dal.ValidationError{Errors: v.errs}
+	}
+	return nil
+}
+
+type validation struct {
+	partial bool
+	errs    []dal.FieldError
+}
+
+func (v *validation) fail(path, rule, param, message string) {
+	if path == "" {
+		path = "(body)"
+	}
+	v.errs = append(v.errs, dal.FieldError{Field: path, Rule: rule, Param: param, Message: path + " " + message})
+}
+
+func (v *validation) check(s *Schema, value interface{}, path string) {
+	if !v.checkType(s, value, path) {
+		return
+	}
+
+	switch value := value.(type) {
+	case string:
+		v.checkString(s, value, path)
+	case json.Number:
+		f, _ := value.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			v.fail(path, "min", formatFloat(*s.Minimum), "must be at least "+formatFloat(*s.Minimum))
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			v.fail(path, "max", formatFloat(*s.Maximum), "must be at most "+formatFloat(*s.Maximum))
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(value) < *s.MinItems {
+			v.fail(path, "min", fmt.Sprint(*s.MinItems), fmt.Sprintf("must have at least %d items", *s.MinItems))
+		}
+		if s.MaxItems != nil && len(value) > *s.MaxItems {
+			v.fail(path, "max", fmt.Sprint(*s.MaxItems), fmt.Sprintf("must have at most %d items", *s.MaxItems))
+		}
+		if s.Items != nil {
+			for i, item := range value {
+				v.check(s.Items, item, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	case map[string]interface{}:
+		v.checkObject(s, value, path)
+	}
+	if len(s.Enum) > 0 && value != nil && !inEnum(s.Enum, value) {
+		v.fail(path, "oneof", enumParam(s.Enum), "must be one of ["+enumParam(s.Enum)+"]")
+	}
+}
+
+// checkType reports whether value has one of the schema's types.
+func (v *validation) checkType(s *Schema, value interface{}, path string) bool {
+	types := s.types()
+	if len(types) == 0 {
+		return true
+	}
+	actual := jsonType(value)
+	for _, t := range types {
+		if t == actual || t == "number" && actual == "integer" {
+			return true
+		}
+	}
+	v.fail(path, "type", strings.Join(types, ","), "must be "+article(types[0])+" "+strings.Join(types, " or "))
+	return false
+}
+
+func (v *validation) checkString(s *Schema, value, path string) {
+	length := utf8.RuneCountInString(value)
+	if s.MinLength != nil && length < *s.MinLength {
+		v.fail(path, "min", fmt.Sprint(*s.MinLength), fmt.Sprintf("must be at least %d characters", *s.MinLength))
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		v.fail(path, "max", fmt.Sprint(*s.MaxLength), fmt.Sprintf("must be at most %d characters", *s.MaxLength))
+	}
+	if s.Pattern != "" && !compile(s.Pattern).MatchString(value) {
+		rule, message := s.patternRule, "must match "+s.Pattern
+		switch rule {
+		case "":
+			rule = "pattern"
+		case "alphanum":
+			message = "must contain only letters and digits"
+		case "alpha":
+			message = "must contain only letters"
+		case "numeric":
+			message = "must be a number"
+		case "objectid":
+			message = "must be a 24 character hex id"
+		}
+		v.fail(path, rule, "", message)
+	}
+
+	switch s.Format {
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			v.fail(path, "datetime", time.RFC3339, "must be an RFC 3339 date-time")
+		}
+	case "email":
+		if addr, err := mail.ParseAddress(value); err != nil || addr.Address != value {
+			v.fail(path, "email", "", "must be a valid email address")
+		}
+	case "uri":
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" {
+			v.fail(path, "url", "", "must be an absolute URL")
+		}
+	}
+}
+
+func (v *validation) checkObject(s *Schema, value map[string]interface{}, path string) {
+	prefix := path
+	if prefix != "" {
+		prefix += "."
+	}
+	if !v.partial {
+		for _, name := range s.Required {
+			if _, ok := value[name]; !ok {
+				v.fail(prefix+name, "required", "", "is required")
+			}
+		}
+	}
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if item, ok := value[name]; ok && !s.Properties[name].ReadOnly {
+			v.check(s.Properties[name], item, prefix+name)
+		}
+	}
+}
+
+func jsonType(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if f, err := value.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func article(typeName string) string {
+	switch typeName[0] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return "an"
+	}
+	return "a"
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, allowed := range enum {
+		if fmt.Sprint(allowed) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func enumParam(enum []interface{}) string {
+	values := make([]string, len(enum))
+	for i, value := range enum {
+		values[i] = fmt.Sprint(value)
+	}
+	return strings.Join(values, " ")
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+var (
+	patterns   = make(map[string]*regexp.Regexp)
+	patternsMu sync.Mutex
+)
+
+// compile caches the schema patterns, which come from struct tags.
+func compile(pattern string) *regexp.Regexp {
+	patternsMu.Lock()
+	defer patternsMu.Unlock()
+	re, ok := patterns[pattern]
+	if !ok {
+		re = regexp.MustCompile(pattern)
+		patterns[pattern] = re
+	}
+	return re
+}
@@ -0,0 +1,83 @@
+// Package stack assembles the Store decorators and background workers shared
+// by the REST and GraphQL APIs, so both write through the same layers.
+package stack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/seebasoft/prompter/goback/config"
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/database"
+	"github.com/seebasoft/prompter/goback/logging"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/seebasoft/prompter/goback/outbox"
+	"github.com/seebasoft/prompter/goback/telemetry"
+	"github.com/seebasoft/prompter/goback/webhook"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel"
+)
+
+// Namespace is the namespace of the stored items and of their outbox.
+const Namespace = "core"
+
+// Stack is the Mongo store wrapped in the decorators every request goes
+// through, along with the parts of it the APIs use directly.
+type Stack struct {
+	Store   dal.Store // What the APIs read and write through
+	Mongo   *database.MongoStore
+	History *database.MongoHistory
+}
+
+// New builds the stack on client: logging, telemetry, history, outbox,
+// validation, audit fields, retries and, unless cfg.Cache.Size is 0, a read
+// cache.
+func New(client *mongo.Client, cfg *config.Config) *Stack {
+	mongoStore := database.NewMongoStore(client).(*database.MongoStore)
+	history := database.NewMongoHistory(client)
+	tracedStore := telemetry.NewStore(logging.NewStore(mongoStore), otel.GetTracerProvider(), otel.GetMeterProvider())
+	historyStore := dal.NewHistoryStore(tracedStore, history, mongoStore)
+	outboxStore := outbox.NewStore(historyStore, mongoStore)
+	store := dal.NewAuditingStore(dal.NewValidatingStore(outboxStore))
+	var served dal.Store = dal.NewResilientStore(store, dal.DefaultResilienceOptions())
+	if cfg.Cache.Size > 0 {
+		served = dal.NewCachedStore(served, dal.NewLRUCache(cfg.Cache.Size), dal.CacheOptions{
+			TTL:         cfg.Cache.TTL,
+			NegativeTTL: cfg.Cache.NegativeTTL,
+		})
+	}
+	return &Stack{Store: served, Mongo: mongoStore, History: history}
+}
+
+// EnsureIndexes creates the indexes of every stored item type.
+func EnsureIndexes(ctx context.Context, client *mongo.Client) error {
+	indexed := []dal.Item{&models.User{}, &models.Webhook{}, &models.WebhookDelivery{}, outbox.NewRecordType(Namespace)}
+	if err := database.NewMongoStore(client).EnsureIndexes(ctx, indexed...); err != nil {
+		return fmt.Errorf("ensuring indexes: %w", err)
+	}
+	if err := database.NewMongoHistory(client).EnsureIndexes(ctx, &models.User{}); err != nil {
+		return fmt.Errorf("ensuring history indexes: %w", err)
+	}
+	return nil
+}
+
+// StartRelay publishes outbox events in the background to the partner
+// webhooks and to the configured sinks: outbox.webhookURL posts them to a
+// webhook, outbox.file appends them to a file. Every instance runs a relay;
+// they claim records before publishing them, so each event is published by
+// one at a time. In Lambda a relay only runs while the function is warm, and
+// pending events are picked up on later invocations.
+func (s *Stack) StartRelay(ctx context.Context, cfg *config.Config) {
+	var sinks []outbox.Sink
+	if cfg.Outbox.WebhookURL != "" {
+		sinks = append(sinks, outbox.NewWebhookSink(cfg.Outbox.WebhookURL))
+	}
+	if cfg.Outbox.File != "" {
+		sinks = append(sinks, outbox.NewFileSink(cfg.Outbox.File))
+	}
+	dispatcher := webhook.NewDispatcher(s.Mongo)
+	dispatcher.MaxAttempts = cfg.Webhooks.MaxAttempts
+	sinks = append(sinks, dispatcher)
+
+	go outbox.NewRelay(s.Mongo, Namespace, sinks...).Run(ctx)
+}
@@ -0,0 +1,66 @@
+package telemetry
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware starts a server span per request, continuing the trace of an
+// incoming traceparent header, and records request durations. Spans are named
+// after the route template ("GET /rest/v1/users/:id"), not the raw path, so
+// they group well.
+func Middleware(tp trace.TracerProvider, mp metric.MeterProvider) gin.HandlerFunc {
+	tracer := tp.Tracer(instrumentationName)
+	duration, err := mp.Meter(instrumentationName).Float64Histogram("http.server.request.duration",
+		metric.WithUnit("s"), metric.WithDescription("Duration of HTTP server requests."))
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		ctx := Propagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		spanName := c.Request.Method
+		if route != "" {
+			spanName = fmt.Sprintf("%s %s", c.Request.Method, route)
+		}
+		ctx, span := tracer.Start(ctx, spanName,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.URLPath(c.Request.URL.Path),
+				semconv.HTTPRoute(route),
+			))
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, "")
+		}
+		for _, ginErr := range c.Errors {
+			span.RecordError(ginErr.Err)
+		}
+
+		if duration != nil {
+			duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.HTTPRoute(route),
+				semconv.HTTPResponseStatusCode(status),
+			))
+		}
+	}
+}
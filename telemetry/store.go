@@ -0,0 +1,256 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attributes recorded on Store spans besides the semantic conventions.
+const (
+	FilterShapeKey = attribute.Key("dal.filter.shape")
+	ResultCountKey = attribute.Key("dal.result.count")
+	KeyCountKey    = attribute.Key("dal.key.count")
+)
+
+// store is a dal.Store decorator recording a client span and a duration per
+// operation.
+type store struct {
+	dal.Store
+	tracer   trace.Tracer
+	duration metric.Float64Histogram
+}
+
+// NewStore wraps a Store with tracing and metrics. Spans carry the namespace,
+// item group and, for ReadByFilter, the filter shape: its fields and
+// operators with the values left out.
+func NewStore(inner dal.Store, tp trace.TracerProvider, mp metric.MeterProvider) dal.Store {
+	duration, err := mp.Meter(instrumentationName).Float64Histogram("dal.operation.duration",
+		metric.WithUnit("s"), metric.WithDescription("Duration of Store operations."))
+	if err != nil {
+		otel.Handle(err)
+	}
+	return &store{Store: inner, tracer: tp.Tracer(instrumentationName), duration: duration}
+}
+
+// operation is one traced Store call.
+type operation struct {
+	ctx   context.Context
+	span  trace.Span
+	start time.Time
+	attrs []attribute.KeyValue
+	store *store
+}
+
+func (s *store) start(ctx context.Context, name string, item dal.Item, attrs ...attribute.KeyValue) (context.Context, *operation) {
+	attrs = append([]attribute.KeyValue{
+		semconv.DBOperationName(name),
+		semconv.DBNamespace(item.Namespace()),
+		semconv.DBCollectionName(item.ItemGroup()),
+	}, attrs...)
+	ctx, span := s.tracer.Start(ctx, name+" "+item.ItemGroup(),
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return ctx, &operation{ctx: ctx, span: span, start: time.Now(), attrs: attrs[:3:3], store: s}
+}
+
+// end finishes the operation. Not found is an expected outcome, not an error.
+func (op *operation) end(err error, attrs ...attribute.KeyValue) {
+	op.span.SetAttributes(attrs...)
+	failed := err != nil && !errors.Is(err, dal.ErrNotFound)
+	if failed {
+		op.span.RecordError(err)
+		op.span.SetStatus(codes.Error, err.Error())
+	}
+	op.span.End()
+
+	if op.store.duration != nil {
+		metricAttrs := append(op.attrs, attribute.Bool("error", failed))
+		op.store.duration.Record(op.ctx, time.Since(op.start).Seconds(), metric.WithAttributes(metricAttrs...))
+	}
+}
+
+func (s *store) Create(ctx context.Context, item dal.Item) (dal.Item, error) {
+	ctx, op := s.start(ctx, "Create", item)
+	created, err := s.Store.Create(ctx, item)
+	op.end(err)
+	return created, err
+}
+
+func (s *store) ReadByKey(ctx context.Context, key interface{}, item dal.Item) error {
+	ctx, op := s.start(ctx, "ReadByKey", item)
+	err := s.Store.ReadByKey(ctx, key, item)
+	found := 1
+	if err != nil {
+		found = 0
+	}
+	op.end(err, ResultCountKey.Int(found))
+	return err
+}
+
+func (s *store) ReadByKeys(ctx context.Context, keys []interface{}, itemType dal.Item) ([]dal.Item, error) {
+	ctx, op := s.start(ctx, "ReadByKeys", itemType, KeyCountKey.Int(len(keys)))
+	items, err := s.Store.ReadByKeys(ctx, keys, itemType)
+	found := 0
+	for _, item := range items {
+		if item != nil {
+			found++
+		}
+	}
+	op.end(err, ResultCountKey.Int(found))
+	return items, err
+}
+
+// ReadByFilter's span stays open while the caller iterates, so it covers the
+// whole query and records how many items were read.
+func (s *store) ReadByFilter(ctx context.Context, opts dal.QueryOptions, itemType dal.Item) (dal.ItemIterator, error) {
+	var attrs []attribute.KeyValue
+	if opts != nil && opts.GetFilter() != nil {
+		attrs = append(attrs, FilterShapeKey.String(FilterShape(opts.GetFilter().ToNative())))
+	}
+	ctx, op := s.start(ctx, "ReadByFilter", itemType, attrs...)
+	iter, err := s.Store.ReadByFilter(ctx, opts, itemType)
+	if err != nil {
+		op.end(err)
+		return nil, err
+	}
+	return &countingIterator{ItemIterator: iter, op: op}, nil
+}
+
+func (s *store) UpdateByKey(ctx context.Context, key interface{}, item dal.Item) (int64, error) {
+	ctx, op := s.start(ctx, "UpdateByKey", item)
+	count, err := s.Store.UpdateByKey(ctx, key, item)
+	op.end(err, ResultCountKey.Int64(count))
+	return count, err
+}
+
+func (s *store) DeleteByKey(ctx context.Context, key interface{}, itemType dal.Item) (int64, error) {
+	ctx, op := s.start(ctx, "DeleteByKey", itemType)
+	count, err := s.Store.DeleteByKey(ctx, key, itemType)
+	op.end(err, ResultCountKey.Int64(count))
+	return count, err
+}
+
+func (s *store) RestoreByKey(ctx context.Context, key interface{}, itemType dal.Item) (int64, error) {
+	ctx, op := s.start(ctx, "RestoreByKey", itemType)
+	count, err := s.Store.RestoreByKey(ctx, key, itemType)
+	op.end(err, ResultCountKey.Int64(count))
+	return count, err
+}
+
+func (s *store) PurgeByKey(ctx context.Context, key interface{}, itemType dal.Item) (int64, error) {
+	ctx, op := s.start(ctx, "PurgeByKey", itemType)
+	count, err := s.Store.PurgeByKey(ctx, key, itemType)
+	op.end(err, ResultCountKey.Int64(count))
+	return count, err
+}
+
+// countingIterator ends the ReadByFilter span when the iterator is closed.
+type countingIterator struct {
+	dal.ItemIterator
+	op    *operation
+	count int
+	ended bool
+}
+
+func (it *countingIterator) Next(ctx context.Context) bool {
+	if it.ItemIterator.Next(ctx) {
+		it.count++
+		return true
+	}
+	return false
+}
+
+func (it *countingIterator) Close(ctx context.Context) error {
+	err := it.ItemIterator.Close(ctx)
+	if !it.ended {
+		it.ended = true
+		iterErr := it.ItemIterator.Err()
+		if iterErr == nil {
+			iterErr = err
+		}
+		it.op.end(iterErr, ResultCountKey.Int(it.count))
+	}
+	return err
+}
+
+// FilterShape renders a native filter with every value replaced by "?", e.g.
+// {"age":{"$gte":"?"},"username":"?"}. Shapes identify a query without
+// leaking the data it was run with.
+func FilterShape(filter interface{}) string {
+	data, err := json.Marshal(shape(filter))
+	if err != nil {
+		return "?"
+	}
+	return string(data)
+}
+
+func shape(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return map[string]interface{}{}
+	case bson.M:
+		return shapeMap(v)
+	case map[string]interface{}:
+		return shapeMap(v)
+	case bson.D:
+		m := make(map[string]interface{}, len(v))
+		for _, elem := range v {
+			m[elem.Key] = elem.Value
+		}
+		return shapeMap(m)
+	case []bson.M:
+		shaped := make([]interface{}, len(v))
+		for i, elem := range v {
+			shaped[i] = shapeMap(elem)
+		}
+		return shaped
+	case bson.A:
+		return shapeList(v)
+	case []interface{}:
+		return shapeList(v)
+	}
+	return "?"
+}
+
+func shapeMap(m map[string]interface{}) map[string]interface{} {
+	shaped := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		if strings.HasPrefix(key, "$") {
+			switch key {
+			case "$and", "$or", "$nor", "$not", "$elemMatch":
+				shaped[key] = shape(value)
+			default:
+				shaped[key] = "?"
+			}
+			continue
+		}
+		switch value.(type) {
+		case bson.M, map[string]interface{}, bson.D:
+			shaped[key] = shape(value)
+		default:
+			shaped[key] = "?"
+		}
+	}
+	return shaped
+}
+
+// shapeList shapes the clauses of $and/$or; plain value lists ($in) are
+// collapsed by shapeMap before they get here.
+func shapeList(list []interface{}) []interface{} {
+	shaped := make([]interface{}, len(list))
+	for i, elem := range list {
+		shaped[i] = shape(elem)
+	}
+	return shaped
+}
@@ -0,0 +1,126 @@
+// Package telemetry traces and measures REST requests and Store operations
+// with OpenTelemetry.
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// instrumentationName identifies the tracers and meters of this package.
+const instrumentationName = "github.com/seebasoft/prompter/goback/telemetry"
+
+// Propagator reads and writes W3C trace context and baggage headers.
+var Propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Providers holds the SDK providers installed by Setup. A nil provider means
+// that signal is switched off.
+type Providers struct {
+	TracerProvider *sdktrace.TracerProvider
+	MeterProvider  *sdkmetric.MeterProvider
+}
+
+// Setup installs global tracer and meter providers. The exporters are picked
+// with the standard OTEL_TRACES_EXPORTER and OTEL_METRICS_EXPORTER variables:
+// "otlp" (configured through the OTEL_EXPORTER_OTLP_* variables), "console"
+// or "none", the default. OTEL_SERVICE_NAME overrides serviceName.
+func Setup(ctx context.Context, serviceName string) (*Providers, error) {
+	otel.SetTextMapPropagator(Propagator)
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("building resource: %w", err)
+	}
+	if res, err = resource.Merge(res, resource.Environment()); err != nil {
+		return nil, fmt.Errorf("building resource: %w", err)
+	}
+
+	providers := &Providers{}
+	switch exporter := os.Getenv("OTEL_TRACES_EXPORTER"); exporter {
+	case "", "none":
+	case "otlp", "console":
+		spanExporter, err := newSpanExporter(ctx, exporter)
+		if err != nil {
+			return nil, err
+		}
+		providers.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithBatcher(spanExporter), sdktrace.WithResource(res))
+		otel.SetTracerProvider(providers.TracerProvider)
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q", exporter)
+	}
+
+	switch exporter := os.Getenv("OTEL_METRICS_EXPORTER"); exporter {
+	case "", "none":
+	case "otlp", "console":
+		metricExporter, err := newMetricExporter(ctx, exporter)
+		if err != nil {
+			return nil, err
+		}
+		reader := sdkmetric.NewPeriodicReader(metricExporter)
+		providers.MeterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithResource(res))
+		otel.SetMeterProvider(providers.MeterProvider)
+	default:
+		return nil, fmt.Errorf("unknown OTEL_METRICS_EXPORTER %q", exporter)
+	}
+	return providers, nil
+}
+
+func newSpanExporter(ctx context.Context, name string) (sdktrace.SpanExporter, error) {
+	if name == "console" {
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	}
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("creating OTLP trace exporter: %w", err)
+	}
+	return exporter, nil
+}
+
+func newMetricExporter(ctx context.Context, name string) (sdkmetric.Exporter, error) {
+	if name == "console" {
+		return stdoutmetric.New()
+	}
+	exporter, err := otlpmetrichttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("creating OTLP metric exporter: %w", err)
+	}
+	return exporter, nil
+}
+
+// ForceFlush exports everything recorded so far. Lambda calls it after each
+// invocation, since a frozen function can't export in the background.
+func (p *Providers) ForceFlush(ctx context.Context) error {
+	var errs []error
+	if p.TracerProvider != nil {
+		errs = append(errs, p.TracerProvider.ForceFlush(ctx))
+	}
+	if p.MeterProvider != nil {
+		errs = append(errs, p.MeterProvider.ForceFlush(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// Shutdown flushes and stops the providers.
+func (p *Providers) Shutdown(ctx context.Context) error {
+	var errs []error
+	if p.TracerProvider != nil {
+		errs = append(errs, p.TracerProvider.Shutdown(ctx))
+	}
+	if p.MeterProvider != nil {
+		errs = append(errs, p.MeterProvider.Shutdown(ctx))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,89 @@
+package telemetry_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/seebasoft/prompter/goback/database"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/seebasoft/prompter/goback/telemetry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newProviders() (*tracetest.InMemoryExporter, *sdktrace.TracerProvider, *sdkmetric.ManualReader, *sdkmetric.MeterProvider) {
+	spans := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	return spans, tp, reader, mp
+}
+
+func attributeValue(attrs []attribute.KeyValue, key attribute.Key) (attribute.Value, bool) {
+	for _, attr := range attrs {
+		if attr.Key == key {
+			return attr.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestMiddlewareContinuesIncomingTrace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	spans, tp, reader, mp := newProviders()
+	engine := gin.New()
+	engine.Use(telemetry.Middleware(tp, mp))
+	engine.GET("/rest/v1/users/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	req := httptest.NewRequest(http.MethodGet, "/rest/v1/users/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+
+	recorded := spans.GetSpans()
+	require.Len(t, recorded, 1)
+	span := recorded[0]
+	assert.Equal(t, "GET /rest/v1/users/:id", span.Name)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String())
+	status, ok := attributeValue(span.Attributes, "http.response.status_code")
+	require.True(t, ok)
+	assert.Equal(t, int64(http.StatusNoContent), status.AsInt64())
+
+	var metrics metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &metrics))
+	require.Len(t, metrics.ScopeMetrics, 1)
+	assert.Equal(t, "http.server.request.duration", metrics.ScopeMetrics[0].Metrics[0].Name)
+}
+
+func TestStoreRecordsOperations(t *testing.T) {
+	ctx := context.Background()
+	spans, tp, _, mp := newProviders()
+	store := telemetry.NewStore(database.NewMemoryStore(), tp, mp)
+
+	_, err := store.Create(ctx, &models.User{ID: primitive.NewObjectID(), Username: "alice"})
+	require.NoError(t, err)
+	filter := bson.M{"username": "alice", "email": bson.M{"$ne": "bob@example.com"}}
+	iter, err := store.ReadByFilter(ctx, database.NewMongoDalQueryOptions(database.NewMongoFilter(filter), bson.D{}, 0, 0), &models.User{})
+	require.NoError(t, err)
+	for iter.Next(ctx) {
+	}
+	require.NoError(t, iter.Close(ctx))
+
+	recorded := spans.GetSpans()
+	require.Len(t, recorded, 2)
+	assert.Equal(t, "Create users", recorded[0].Name)
+	assert.Equal(t, "ReadByFilter users", recorded[1].Name)
+	shape, _ := attributeValue(recorded[1].Attributes, telemetry.FilterShapeKey)
+	assert.Equal(t, `{"email":{"$ne":"?"},"username":"?"}`, shape.AsString())
+	count, _ := attributeValue(recorded[1].Attributes, telemetry.ResultCountKey)
+	assert.Equal(t, int64(1), count.AsInt64())
+}
@@ -0,0 +1,248 @@
+// Package webhook delivers resource change events from the outbox to partner
+// webhooks registered as models.Webhook items.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/dal"
+	"github.com/seebasoft/prompter/goback/database"
+	"github.com/seebasoft/prompter/goback/internal/netguard"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/seebasoft/prompter/goback/outbox"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Headers sent with every delivery.
+const (
+	HeaderEventID   = "X-Webhook-Id"
+	HeaderEventType = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Event is the JSON payload posted to webhooks. The ID stays the same when a
+// delivery is retried. Data is left out for deletes, restores and purges.
+type Event struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Key        string          `json:"key"`
+	OccurredAt time.Time       `json:"occurredAt"`
+	Data       json.RawMessage `json:"data,omitempty"`
+}
+
+// Sign returns the signature header value for a payload: the hex HMAC-SHA256
+// of "<timestamp>.<body>" keyed with the webhook secret. Including the
+// timestamp lets receivers reject replayed deliveries.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header in constant time.
+func Verify(secret string, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Dispatcher is an outbox.Sink delivering events to the webhooks subscribed
+// to them. Every attempt is logged as a models.WebhookDelivery; a webhook's
+// last failed attempt is stored as "dead". Failed deliveries are retried by
+// the outbox relay, which skips the webhooks the log shows are done, so
+// retries back off and survive restarts like any other outbox event.
+type Dispatcher struct {
+	store  dal.Store
+	client *http.Client
+
+	MaxAttempts int // Attempts per webhook and event
+}
+
+// NewDispatcher creates a dispatcher reading subscriptions from store and
+// logging deliveries to it. Its HTTP client refuses to connect to addresses
+// that aren't public.
+func NewDispatcher(store dal.Store) *Dispatcher {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{Timeout: 5 * time.Second, Control: netguard.Control}).DialContext
+	return &Dispatcher{
+		store:       store,
+		client:      &http.Client{Timeout: 10 * time.Second, Transport: transport},
+		MaxAttempts: 5,
+	}
+}
+
+// SetClient replaces the HTTP client used for deliveries.
+func (d *Dispatcher) SetClient(client *http.Client) {
+	d.client = client
+}
+
+// Name implements outbox.Named.
+func (d *Dispatcher) Name() string {
+	return "webhooks"
+}
+
+// Publish delivers an outbox event to its subscribers. It fails while any of
+// them has a failed delivery with attempts left, so the relay retries the
+// event. Changes to webhooks themselves are not announced.
+func (d *Dispatcher) Publish(ctx context.Context, event outbox.Event) error {
+	if event.ItemGroup == (&models.Webhook{}).ItemGroup() || event.ItemGroup == (&models.WebhookDelivery{}).ItemGroup() {
+		return nil
+	}
+	hooks, err := d.subscribers(ctx, event.Type)
+	if err != nil {
+		return fmt.Errorf("finding webhook subscribers: %w", err)
+	}
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	payload := Event{ID: event.ID, Type: event.Type, Key: event.Key, OccurredAt: event.OccurredAt, Data: event.Data}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encoding webhook event: %w", err)
+	}
+
+	errs := make([]error, len(hooks))
+	var wg sync.WaitGroup
+	for i, hook := range hooks {
+		wg.Add(1)
+		go func(i int, hook *models.Webhook) {
+			defer wg.Done()
+			errs[i] = d.deliver(ctx, hook, payload, body)
+		}(i, hook)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// subscribers returns the active webhooks subscribed to an event type.
+func (d *Dispatcher) subscribers(ctx context.Context, eventType string) ([]*models.Webhook, error) {
+	group := eventType
+	for i := len(eventType) - 1; i >= 0; i-- {
+		if eventType[i] == '.' {
+			group = eventType[:i]
+			break
+		}
+	}
+	filter := bson.M{"active": true, "events": bson.M{"$in": bson.A{eventType, group + ".*", "*"}}}
+	opts := database.NewMongoDalQueryOptions(database.NewMongoFilter(filter), bson.D{}, 0, 0)
+
+	iter, err := d.store.ReadByFilter(ctx, opts, &models.Webhook{})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close(ctx)
+
+	hooks := make([]*models.Webhook, 0)
+	for iter.Next(ctx) {
+		hook := &models.Webhook{}
+		if err := iter.Decode(hook); err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, iter.Err()
+}
+
+// attempts returns how often an event was posted to a webhook so far, and
+// whether it was delivered or dead-lettered.
+func (d *Dispatcher) attempts(ctx context.Context, hook *models.Webhook, eventID string) (int, bool, error) {
+	filter := bson.M{"webhookId": hook.ID, "eventId": eventID}
+	opts := database.NewMongoDalQueryOptions(database.NewMongoFilter(filter), bson.D{}, 0, 0)
+	iter, err := d.store.ReadByFilter(ctx, opts, &models.WebhookDelivery{})
+	if err != nil {
+		return 0, false, fmt.Errorf("reading webhook deliveries: %w", err)
+	}
+	defer iter.Close(ctx)
+
+	attempts, done := 0, false
+	for iter.Next(ctx) {
+		delivery := &models.WebhookDelivery{}
+		if err := iter.Decode(delivery); err != nil {
+			return 0, false, fmt.Errorf("reading webhook deliveries: %w", err)
+		}
+		attempts++
+		done = done || delivery.Status != models.DeliveryFailed
+	}
+	return attempts, done, iter.Err()
+}
+
+// deliver makes the next attempt to post an event to one webhook, unless an
+// earlier one already delivered it or gave up. It returns an error when the
+// attempt failed and will be retried.
+func (d *Dispatcher) deliver(ctx context.Context, hook *models.Webhook, event Event, body []byte) error {
+	previous, done, err := d.attempts(ctx, hook, event.ID)
+	if err != nil || done {
+		return err
+	}
+
+	attempt := previous + 1
+	statusCode, err := d.post(ctx, hook, event, body)
+	delivery := &models.WebhookDelivery{
+		ID:          primitive.NewObjectID(),
+		WebhookID:   hook.ID,
+		EventID:     event.ID,
+		EventType:   event.Type,
+		Attempt:     attempt,
+		Status:      models.DeliveryDelivered,
+		StatusCode:  statusCode,
+		Payload:     string(body),
+		AttemptedAt: time.Now().UTC(),
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+		delivery.Status = models.DeliveryFailed
+		if attempt >= d.MaxAttempts {
+			delivery.Status = models.DeliveryDead
+		}
+	}
+	if _, logErr := d.store.Create(ctx, delivery); logErr != nil {
+		// Unlogged attempts aren't counted; retrying may deliver the event
+		// again, which receivers dedupe on its ID
+		return fmt.Errorf("logging webhook delivery: %w", logErr)
+	}
+	if delivery.Status == models.DeliveryFailed {
+		return fmt.Errorf("delivering %s to webhook %s: %w", event.ID, hook.ID.Hex(), err)
+	}
+	return nil
+}
+
+func (d *Dispatcher) post(ctx context.Context, hook *models.Webhook, event Event, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("building request: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventID, event.ID)
+	req.Header.Set(HeaderEventType, event.Type)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,144 @@
+package webhook_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/seebasoft/prompter/goback/database"
+	"github.com/seebasoft/prompter/goback/models"
+	"github.com/seebasoft/prompter/goback/outbox"
+	"github.com/seebasoft/prompter/goback/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const secret = "0123456789abcdef"
+
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+	verified int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	if webhook.Verify(secret, req.Header.Get(webhook.HeaderTimestamp), body, req.Header.Get(webhook.HeaderSignature)) {
+		r.verified++
+	}
+	if r.calls <= r.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deliveries returns the logged attempts for a webhook in order.
+func deliveries(t *testing.T, store *database.MemoryStore, hook *models.Webhook) []*models.WebhookDelivery {
+	t.Helper()
+	ctx := context.Background()
+	opts := database.NewMongoDalQueryOptions(database.NewMongoFilter(bson.M{"webhookId": hook.ID}), bson.D{{Key: "attempt", Value: 1}}, 0, 0)
+	iter, err := store.ReadByFilter(ctx, opts, &models.WebhookDelivery{})
+	require.NoError(t, err)
+	result := make([]*models.WebhookDelivery, 0)
+	for iter.Next(ctx) {
+		delivery := &models.WebhookDelivery{}
+		require.NoError(t, iter.Decode(delivery))
+		result = append(result, delivery)
+	}
+	return result
+}
+
+func subscribe(t *testing.T, store *database.MemoryStore, url string, events ...string) *models.Webhook {
+	t.Helper()
+	hook := &models.Webhook{ID: primitive.NewObjectID(), URL: url, Events: events, Secret: secret, Active: true}
+	_, err := store.Create(context.Background(), hook)
+	require.NoError(t, err)
+	return hook
+}
+
+// newRelay writes a user through the outbox and returns a relay publishing
+// its event to dispatcher, retrying right away.
+func newRelay(t *testing.T, store *database.MemoryStore, dispatcher *webhook.Dispatcher) *outbox.Relay {
+	t.Helper()
+	_, err := outbox.NewStore(store, store).Create(context.Background(), &models.User{ID: primitive.NewObjectID(), Username: "alice"})
+	require.NoError(t, err)
+	relay := outbox.NewRelay(store, "core", dispatcher)
+	relay.BaseBackoff = time.Millisecond
+	relay.MaxBackoff = time.Millisecond
+	return relay
+}
+
+func TestDispatcherDeliversSignedEventsWithRetries(t *testing.T) {
+	ctx := context.Background()
+	recv := &receiver{failures: 1}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	store := database.NewMemoryStore()
+	hook := subscribe(t, store, server.URL, "users.*")
+	dead := subscribe(t, store, broken.URL, "*")
+
+	dispatcher := webhook.NewDispatcher(store)
+	dispatcher.MaxAttempts = 3
+	// the default client refuses the test servers' loopback addresses
+	dispatcher.SetClient(http.DefaultClient)
+	relay := newRelay(t, store, dispatcher)
+
+	for _, want := range []int{0, 0, 1, 0} {
+		published, err := relay.ProcessOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, want, published)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// delivered on the second attempt and skipped after that
+	assert.Equal(t, 2, recv.calls)
+	assert.Equal(t, 2, recv.verified)
+	logged := deliveries(t, store, hook)
+	require.Len(t, logged, 2)
+	assert.Equal(t, models.DeliveryFailed, logged[0].Status)
+	assert.Equal(t, http.StatusServiceUnavailable, logged[0].StatusCode)
+	assert.Equal(t, models.DeliveryDelivered, logged[1].Status)
+	assert.Equal(t, "users.created", logged[1].EventType)
+	assert.Equal(t, logged[0].EventID, logged[1].EventID)
+
+	// the broken webhook is dead-lettered instead of holding the event back
+	logged = deliveries(t, store, dead)
+	require.Len(t, logged, 3)
+	assert.Equal(t, models.DeliveryDead, logged[2].Status)
+}
+
+func TestDispatcherRefusesInternalAddresses(t *testing.T) {
+	ctx := context.Background()
+	recv := &receiver{}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	store := database.NewMemoryStore()
+	hook := subscribe(t, store, server.URL, "*")
+	dispatcher := webhook.NewDispatcher(store)
+	dispatcher.MaxAttempts = 1
+	_, err := newRelay(t, store, dispatcher).ProcessOnce(ctx)
+	require.NoError(t, err)
+
+	assert.Zero(t, recv.calls)
+	logged := deliveries(t, store, hook)
+	require.Len(t, logged, 1)
+	assert.Contains(t, logged[0].Error, "isn't public")
+	assert.ErrorContains(t, hook.Validate(ctx), "url must point to a public host")
+}